@@ -2,17 +2,27 @@ package agent
 
 import (
 	"context"
+	"fmt"
 	"reflect"
 	"time"
 
 	"github.com/go-logr/logr"
 	v1alpha1 "github.com/skillz/opvic/agent/api/v1alpha1"
+	"github.com/skillz/opvic/utils"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/discovery"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
 
+// Finalizer removes the subject from the control plane before the VersionTracker is deleted
+const Finalizer = "opvic.skillz.com/finalizer"
+
 type Config struct {
 	// The interval between individual synchronizations
 	Interval time.Duration
@@ -32,6 +42,14 @@ type VersionTrackerReconciler struct {
 	Log    logr.Logger
 	Scheme *runtime.Scheme
 	Config *Config
+	// Ships the versions to the control plane. Nil if no control plane is configured
+	Shipper *Shipper
+	// Resolves the running images for the ImageDigest strategy
+	Images *ImageResolver
+	// Gets the version of the API server for the ClusterVersion resources strategy
+	Discovery discovery.ServerVersionInterface
+	// Lists the resources with a field selector from the API server since the cache doesn't support them
+	APIReader client.Reader
 }
 
 //+kubebuilder:rbac:groups=vt.skillz.com,resources=versiontrackers,verbs=get;list;watch;create;update;patch;delete
@@ -55,6 +73,18 @@ func (r *VersionTrackerReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 		reconciliationErrorsTotal.Inc()
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
+	if !v.ObjectMeta.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, r.finalize(ctx, &v)
+	}
+	// the finalizer is only needed to remove the subject from the control plane
+	if r.Shipper != nil && !controllerutil.ContainsFinalizer(&v, Finalizer) {
+		controllerutil.AddFinalizer(&v, Finalizer)
+		if err := r.Update(ctx, &v); err != nil {
+			log.Error(err, "failed to add the finalizer")
+			reconciliationErrorsTotal.Inc()
+			return ctrl.Result{}, err
+		}
+	}
 	// Set defaults
 	v.SetDefaults()
 	// Validate the VersionTracker
@@ -65,34 +95,16 @@ func (r *VersionTrackerReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 		return ctrl.Result{}, err
 	}
 
-	// Prepare options fro getting resources defined in the VersionTracker
-	var opts []client.ListOption
-	if len(v.Spec.Resources.Namespaces) > 0 {
-		for _, ns := range v.Spec.Resources.Namespaces {
-			opts = append(opts, client.InNamespace(ns))
-		}
-	}
-	selector, err := metav1.LabelSelectorAsSelector(v.Spec.Resources.Selector)
-	if err != nil {
-		log.Error(err, "failed to convert label selector to selector")
-		reconciliationErrorsTotal.Inc()
-		return ctrl.Result{}, err
-	}
-	opts = append(opts, client.MatchingLabelsSelector{Selector: selector})
-
-	// Get the resource object type based on the resource strategy of the VersionTracker
-	resources, err := v.GetObjectList()
-	if err != nil {
-		log.Error(err, "failed to get resource ObjectList")
-		reconciliationErrorsTotal.Inc()
-		return ctrl.Result{}, err
+	// Get the items to extract the versions from based on the resource strategy of the VersionTracker
+	var items []interface{}
+	if v.Spec.Resources.Strategy == v1alpha1.ClusterVersion {
+		items, err = r.getClusterVersion()
+	} else {
+		items, err = r.listResources(ctx, v)
 	}
-
-	// Get all resources
-	err = r.List(ctx, resources, opts...)
 	if err != nil {
 		reconciliationErrorsTotal.Inc()
-		log.Error(err, "failed to list pods")
+		log.Error(err, "failed to get the resources")
 		return ctrl.Result{}, err
 	}
 
@@ -101,15 +113,13 @@ func (r *VersionTrackerReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 	status.LocalVersion = &v.Spec.LocalVersion
 	status.RemoteVersion = &v.Spec.RemoteVersion
 
-	// Get items based on the resource type
-	items := GetItems(resources)
 	if len(items) == 0 {
 		log.Info("no resources found")
 		count := 0
 		status.TotalResourceCount = &count
 	} else {
 		// Extract versions from resources
-		sv = r.ExtractSubjectVersion(v, items)
+		sv = r.ExtractSubjectVersion(ctx, v, items)
 		var uniqVersions []*string
 		for _, v := range sv.UniqVersions {
 			uniqVersions = append(uniqVersions, &v)
@@ -132,10 +142,10 @@ func (r *VersionTrackerReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 	}
 
 	// Ship the version information to the Control Plane
-	if len(sv.Versions) > 0 && r.Config.ControlPlaneUrl != "" {
+	if len(sv.Versions) > 0 && r.Shipper != nil {
 		err := r.ShipToControlPlane(sv)
 		if err != nil {
-			log.Error(err, "failed to ship the version to control plane")
+			log.Error(err, "failed to queue the version for the control plane")
 			reconciliationErrorsTotal.Inc()
 			return ctrl.Result{}, err
 		}
@@ -151,6 +161,131 @@ func (r *VersionTrackerReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 	}, nil
 }
 
+// listResources lists the resources defined in the VersionTracker and returns their items
+func (r *VersionTrackerReconciler) listResources(ctx context.Context, v v1alpha1.VersionTracker) ([]interface{}, error) {
+	// Prepare options fro getting resources defined in the VersionTracker
+	var opts []client.ListOption
+	if len(v.Spec.Resources.Namespaces) > 0 {
+		for _, ns := range v.Spec.Resources.Namespaces {
+			opts = append(opts, client.InNamespace(ns))
+		}
+	}
+	selector, err := metav1.LabelSelectorAsSelector(v.Spec.Resources.Selector)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert label selector to selector: %w", err)
+	}
+	fieldSelector, err := fields.ParseSelector(v.Spec.Resources.FieldSelector)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the field selector: %w", err)
+	}
+	if v.Spec.Resources.Strategy == v1alpha1.HelmReleases {
+		// only the deployed revision of each release is tracked, not its history
+		requirements, _ := labels.SelectorFromSet(helmReleaseLabels).Requirements()
+		selector = selector.Add(requirements...)
+		typeSelector := fields.OneTermEqualSelector("type", HelmReleaseSecretType)
+		if fieldSelector.Empty() {
+			fieldSelector = typeSelector
+		} else {
+			fieldSelector = fields.AndSelectors(fieldSelector, typeSelector)
+		}
+	}
+	opts = append(opts, client.MatchingLabelsSelector{Selector: selector})
+	if !fieldSelector.Empty() {
+		opts = append(opts, client.MatchingFieldsSelector{Selector: fieldSelector})
+	}
+
+	// the cache doesn't support the field selectors
+	reader := client.Reader(r.Client)
+	if v.Spec.Resources.FieldSelector != "" {
+		if r.APIReader == nil {
+			return nil, fmt.Errorf("the field selectors require the API reader")
+		}
+		reader = r.APIReader
+	}
+
+	// Get the resource object type based on the resource strategy of the VersionTracker
+	resources, err := v.GetObjectList()
+	if err != nil {
+		return nil, err
+	}
+	if err := reader.List(ctx, resources, opts...); err != nil {
+		return nil, err
+	}
+	if secrets, ok := resources.(*corev1.SecretList); ok && v.Spec.Resources.Strategy == v1alpha1.HelmReleases {
+		return r.getHelmReleases(secrets, v.Spec.Resources.Chart), nil
+	}
+	// Get items based on the resource type
+	return filterItems(v.Spec.Resources, GetItems(resources)), nil
+}
+
+// getHelmReleases decodes the releases stored in the secrets and returns the releases of the chart as items
+func (r *VersionTrackerReconciler) getHelmReleases(secrets *corev1.SecretList, chart string) []interface{} {
+	items := []interface{}{}
+	for _, secret := range secrets.Items {
+		release, err := DecodeHelmRelease(secret)
+		if err != nil {
+			r.Log.Error(err, "skipping the helm release")
+			reconciliationErrorsTotal.Inc()
+			continue
+		}
+		if chart == "" || release.Chart.Metadata.Name == chart {
+			items = append(items, *release)
+		}
+	}
+	return items
+}
+
+// getClusterVersion returns the version of the API server from the discovery API as the only item
+func (r *VersionTrackerReconciler) getClusterVersion() ([]interface{}, error) {
+	if r.Discovery == nil {
+		return nil, fmt.Errorf("the discovery client is not configured")
+	}
+	info, err := r.Discovery.ServerVersion()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the version of the API server: %w", err)
+	}
+	return []interface{}{*info}, nil
+}
+
+// finalize removes the subject of the deleted VersionTracker from the control plane and then removes the finalizer.
+// If the control plane can't be reached, the subject is removed by the next batch that doesn't list it.
+func (r *VersionTrackerReconciler) finalize(ctx context.Context, v *v1alpha1.VersionTracker) error {
+	if !controllerutil.ContainsFinalizer(v, Finalizer) {
+		return nil
+	}
+	log := r.Log.WithValues("versiontracker", fmt.Sprintf("%s/%s", v.Namespace, v.Name))
+	if r.Shipper != nil {
+		subjects, err := r.TrackedSubjects(ctx)
+		if err != nil {
+			return err
+		}
+		// another VersionTracker may report the same subject
+		if !utils.Contains(subjects, v.Spec.Name) {
+			log.Info("removing the subject from the control plane")
+			if err := r.Shipper.Delete(ctx, v.Namespace, v.Spec.Name); err != nil {
+				log.Error(err, "failed to remove the subject from the control plane, the next batch will remove it")
+			}
+		}
+	}
+	controllerutil.RemoveFinalizer(v, Finalizer)
+	return client.IgnoreNotFound(r.Update(ctx, v))
+}
+
+// TrackedSubjects returns the identifiers of all the VersionTrackers watched by the agent that are not being deleted
+func (r *VersionTrackerReconciler) TrackedSubjects(ctx context.Context) ([]string, error) {
+	var list v1alpha1.VersionTrackerList
+	if err := r.List(ctx, &list); err != nil {
+		return nil, err
+	}
+	subjects := []string{}
+	for _, v := range list.Items {
+		if v.ObjectMeta.DeletionTimestamp.IsZero() && !utils.Contains(subjects, v.Spec.Name) {
+			subjects = append(subjects, v.Spec.Name)
+		}
+	}
+	return subjects, nil
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *VersionTrackerReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
@@ -18,25 +18,52 @@ package v1alpha1
 
 import (
 	"fmt"
+	"regexp"
 
 	appsv1 "k8s.io/api/apps/v1"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 type LocalStrategy string
 type RemoteStrategy string
+type ContainerType string
 
 const (
 	FieldSelection LocalStrategy = "FieldSelection"
 	ImageTag       LocalStrategy = "ImageTag"
+	// ImageDigest reads a label of the image config that the running digest of the pod containers points to
+	ImageDigest LocalStrategy = "ImageDigest"
+
+	// Presets that extract the versions of the node components from `status.nodeInfo`
+	KubeletVersion          LocalStrategy = "KubeletVersion"
+	ContainerRuntimeVersion LocalStrategy = "ContainerRuntimeVersion"
+	KernelVersion           LocalStrategy = "KernelVersion"
+	OSImage                 LocalStrategy = "OSImage"
+
+	// CustomResources lists the resources of the kind set in `resources.custom`
+	CustomResources = "Custom"
+	// ClusterVersion reads the version of the API server from the discovery API
+	ClusterVersion = "ClusterVersion"
+	// HelmReleases decodes the deployed releases from the Helm 3 storage secrets
+	HelmReleases = "HelmReleases"
+
+	Containers          ContainerType = "containers"
+	InitContainers      ContainerType = "initContainers"
+	EphemeralContainers ContainerType = "ephemeralContainers"
 
 	HelmStrategyChartVersion RemoteStrategy = "chartVersion"
 	HelmStrategyAppVersion   RemoteStrategy = "appVersion"
 	GithubStrategyReleases   RemoteStrategy = "releases"
 	GithubStrategyTags       RemoteStrategy = "tags"
+	GitlabStrategyReleases   RemoteStrategy = "releases"
+	GitlabStrategyTags       RemoteStrategy = "tags"
+	RegistryStrategyTags     RemoteStrategy = "tags"
 )
 
 var (
@@ -49,8 +76,95 @@ var (
 			},
 		},
 	}
+	ImageDigestDefaults = LocalVersion{
+		ImageLabel: "org.opencontainers.image.version",
+		Extraction: Extraction{
+			Regex: Regex{
+				Pattern: `^(.*)$`,
+				Result:  "$1",
+			},
+		},
+	}
+
+	// ResourcePresets are the defaults of the resources strategies that only support the FieldSelection strategy
+	ResourcePresets = map[string]Preset{
+		// the fieldSelector is applied to the version.Info of the API server
+		ClusterVersion: {
+			LocalVersion: LocalVersion{
+				FieldSelector: ".gitVersion",
+				// e.g. v1.21.5-eks-bc4871b
+				Extraction: Extraction{Regex: Regex{Pattern: `^v([0-9]+\.[0-9]+\.[0-9]+)`, Result: "$1"}},
+			},
+			RemoteVersion: RemoteVersion{
+				Provider:   "github",
+				Strategy:   GithubStrategyTags,
+				Repo:       "kubernetes/kubernetes",
+				Extraction: Extraction{Regex: Regex{Pattern: `^v([0-9]+\.[0-9]+\.[0-9]+)$`, Result: "$1"}},
+			},
+		},
+		// the fieldSelector is applied to the decoded release (e.g. `.chart.metadata.appVersion`)
+		HelmReleases: {
+			LocalVersion: LocalVersion{
+				FieldSelector: ".chart.metadata.version",
+				Extraction:    Extraction{Regex: Regex{Pattern: `^(.*)$`, Result: "$1"}},
+			},
+		},
+	}
+
+	// NodePresets are the defaults of the node component strategies. They require the `Nodes` resources strategy
+	NodePresets = map[LocalStrategy]Preset{
+		KubeletVersion: {
+			LocalVersion: LocalVersion{
+				FieldSelector: ".status.nodeInfo.kubeletVersion",
+				// e.g. v1.21.5-eks-bc4871b
+				Extraction: Extraction{Regex: Regex{Pattern: `^v([0-9]+\.[0-9]+\.[0-9]+)`, Result: "$1"}},
+			},
+			RemoteVersion: RemoteVersion{
+				Provider:   "github",
+				Strategy:   GithubStrategyTags,
+				Repo:       "kubernetes/kubernetes",
+				Extraction: Extraction{Regex: Regex{Pattern: `^v([0-9]+\.[0-9]+\.[0-9]+)$`, Result: "$1"}},
+			},
+		},
+		ContainerRuntimeVersion: {
+			LocalVersion: LocalVersion{
+				FieldSelector: ".status.nodeInfo.containerRuntimeVersion",
+				// e.g. containerd://1.4.6. Only containerd matches the default remote version,
+				// so the versions of the other runtimes are not extracted unless the extraction is overridden
+				Extraction: Extraction{Regex: Regex{Pattern: `^containerd://v?([0-9]+\.[0-9]+\.[0-9]+)`, Result: "$1"}},
+			},
+			RemoteVersion: RemoteVersion{
+				Provider:   "github",
+				Strategy:   GithubStrategyTags,
+				Repo:       "containerd/containerd",
+				Extraction: Extraction{Regex: Regex{Pattern: `^v([0-9]+\.[0-9]+\.[0-9]+)$`, Result: "$1"}},
+			},
+		},
+		KernelVersion: {
+			LocalVersion: LocalVersion{
+				FieldSelector: ".status.nodeInfo.kernelVersion",
+				// e.g. 5.4.0-1045-aws
+				Extraction: Extraction{Regex: Regex{Pattern: `^([0-9]+\.[0-9]+\.[0-9]+)`, Result: "$1"}},
+			},
+		},
+		OSImage: {
+			LocalVersion: LocalVersion{
+				FieldSelector: ".status.nodeInfo.osImage",
+				// e.g. Ubuntu 20.04.3 LTS or Amazon Linux 2
+				Extraction: Extraction{Regex: Regex{Pattern: `^[^0-9]*([0-9]+(\.[0-9]+)*)`, Result: "$1"}},
+			},
+		},
+	}
 )
 
+// Preset is the default configuration of a node component strategy or of a resources strategy
+// +kubebuilder:object:generate=false
+type Preset struct {
+	LocalVersion LocalVersion
+	// Upstream releases of the component. Empty if the component has no release list
+	RemoteVersion RemoteVersion
+}
+
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 
 // VersionTrackerSpec defines the desired state of VersionTracker
@@ -75,21 +189,65 @@ type VersionTrackerSpec struct {
 type Resources struct {
 
 	// +kubebuilder:default=Pods
-	// +kubebuilder:validation:Enum = [Nodes, Pods, Deployments, DaemonSets, StatefulSets, ReplicaSets, CronJobs, Jobs]
+	// +kubebuilder:validation:Enum = [Nodes, Pods, Deployments, DaemonSets, StatefulSets, ReplicaSets, CronJobs, Jobs, Custom, ClusterVersion, HelmReleases]
 	// Specifies the strategy to find the resources to track.(Default: `Pods`)
 	// +optional
 	Strategy string `json:"strategy"`
 
+	// Kind of the resources to track when the strategy is `Custom` (e.g. a CRD like IstioOperator)
+	// +optional
+	Custom *CustomResource `json:"custom,omitempty"`
+
+	// Name of the chart of the releases to track when the strategy is `HelmReleases` (Default to track all the charts)
+	// +optional
+	Chart string `json:"chart,omitempty"`
+
 	// List of Namespaces to use when querying for resources (Default to query all namespaces)
 	// +optional
 	Namespaces []string `json:"namespaces"`
 
 	// Label selector to use when querying for resources
 	Selector *metav1.LabelSelector `json:"selector"`
+
+	// Field selector to use when querying for resources (e.g. `status.successful=1` for the completed Jobs).
+	// The resources are listed from the API server instead of the cache of the agent
+	// +optional
+	FieldSelector string `json:"fieldSelector,omitempty"`
+
+	// Phases of the pods to track when the strategy is `Pods` (e.g. `Running` to ignore the evicted pods)
+	// +optional
+	PodPhases []corev1.PodPhase `json:"podPhases,omitempty"`
+
+	// Minimum number of desired replicas of the Deployments, StatefulSets, ReplicaSets and DaemonSets to track
+	// (e.g. `1` to ignore the old ReplicaSets scaled down to zero)
+	// +optional
+	MinReplicas *int32 `json:"minReplicas,omitempty"`
+
+	// Counts the workloads that own the pods instead of the pods when the strategy is `Pods`
+	// +optional
+	GroupByOwner bool `json:"groupByOwner,omitempty"`
+}
+
+// CustomResource is the group, version and kind of the resources listed by the `Custom` strategy
+type CustomResource struct {
+	// API group of the resources. Empty for the core group
+	// +optional
+	Group string `json:"group,omitempty"`
+
+	// +kubebuilder:validation:Required
+	Version string `json:"version"`
+
+	// +kubebuilder:validation:Required
+	Kind string `json:"kind"`
+}
+
+// GroupVersionKind returns the GroupVersionKind of the resources
+func (c *CustomResource) GroupVersionKind() schema.GroupVersionKind {
+	return schema.GroupVersionKind{Group: c.Group, Version: c.Version, Kind: c.Kind}
 }
 
 type LocalVersion struct {
-	// +kubebuilder:validation:Enum = ["ImageTag", "FieldSelection"]
+	// +kubebuilder:validation:Enum = ["ImageTag", "ImageDigest", "FieldSelection", "KubeletVersion", "ContainerRuntimeVersion", "KernelVersion", "OSImage"]
 	// +kubebuilder:default=ImageTag
 	// +kubebuilder:validation:Required
 	Strategy LocalStrategy `json:"strategy"`
@@ -101,10 +259,40 @@ type LocalVersion struct {
 
 	// +optional
 	Extraction Extraction `json:"extraction"`
+
+	// Extracts a version from the image of each selected container of the pod templates instead of the fieldSelector.
+	// Only supported by the ImageTag and ImageDigest strategies
+	// +optional
+	Containers *ContainerSelection `json:"containers,omitempty"`
+
+	// Label of the image config to read the version from with the ImageDigest strategy (Default: `org.opencontainers.image.version`)
+	// +optional
+	ImageLabel string `json:"imageLabel,omitempty"`
+}
+
+// ContainerSelection selects the containers of a pod template to extract the versions from
+type ContainerSelection struct {
+	// Types of containers to extract the versions from (Default: `containers`)
+	// +kubebuilder:validation:Enum = ["containers", "initContainers", "ephemeralContainers"]
+	// +optional
+	Types []ContainerType `json:"types,omitempty"`
+
+	// Regex matched against the container names (e.g. `^app$`). All the containers are selected if empty
+	// +optional
+	NamePattern string `json:"namePattern,omitempty"`
+}
+
+// GetTypes returns the types of containers to extract the versions from
+func (c *ContainerSelection) GetTypes() []ContainerType {
+	if len(c.Types) == 0 {
+		return []ContainerType{Containers}
+	}
+	return c.Types
 }
 
 type RemoteVersion struct {
-	// +kubebuilder:validation:Enum = ["github", "helm-repo"]
+	// Provider registered in the control plane to get the remote versions from.
+	// e.g github, gitlab, helm-repo, registry or a custom provider. The control plane rejects the unknown providers
 	// +kubebuilder:default=github
 	// +kubebuilder:validation:Required
 	Provider string `json:"provider"`
@@ -114,7 +302,7 @@ type RemoteVersion struct {
 	Strategy RemoteStrategy `json:"strategy"`
 
 	// Repository to get the remote version from.
-	// e.g owner/repo or https://charts.bitnami.com/bitnami
+	// e.g owner/repo, group/subgroup/project, https://charts.bitnami.com/bitnami or ghcr.io/owner/image
 	// +kubebuilder:validation:Required
 	Repo string `json:"repo"`
 
@@ -127,6 +315,54 @@ type RemoteVersion struct {
 
 	// +optional
 	Constraint string `json:"constraint,omitempty"`
+
+	// Package of the subject in the security advisory database
+	// +optional
+	Advisory Advisory `json:"advisory,omitempty"`
+
+	// Release cycles and their end of life dates
+	// +optional
+	Lifecycle Lifecycle `json:"lifecycle,omitempty"`
+}
+
+// Advisory identifies a package in an OSV security advisory database.
+// See https://ossf.github.io/osv-schema/#affectedpackage-field
+type Advisory struct {
+	// Ecosystem of the package (e.g. Go, npm, PyPI)
+	// +kubebuilder:validation:Required
+	Ecosystem string `json:"ecosystem"`
+
+	// Name of the package in the ecosystem (e.g. github.com/coredns/coredns)
+	// +kubebuilder:validation:Required
+	Package string `json:"package"`
+}
+
+// Lifecycle is the source of the release cycles of a subject. Only one of url or cycles can be set
+type Lifecycle struct {
+	// URL of an endoflife.date style JSON feed (e.g. https://endoflife.date/api/kubernetes.json)
+	// +optional
+	URL string `json:"url,omitempty"`
+
+	// Inline list of release cycles
+	// +optional
+	Cycles []Cycle `json:"cycles,omitempty"`
+
+	// Number of days before the end of life date that a version is nearing its end of life
+	// +kubebuilder:default=90
+	// +optional
+	NearingEOLDays int `json:"nearingEOLDays,omitempty"`
+}
+
+// Cycle is a release line of a subject
+type Cycle struct {
+	// Release cycle matched against the beginning of the running version (e.g. 1.21 matches 1.21.3)
+	// +kubebuilder:validation:Required
+	Cycle string `json:"cycle"`
+
+	// End of life date in YYYY-MM-DD format
+	// +kubebuilder:validation:Pattern=`^[0-9]{4}-[0-9]{2}-[0-9]{2}$`
+	// +kubebuilder:validation:Required
+	EOL string `json:"eol"`
 }
 
 type Extraction struct {
@@ -150,6 +386,8 @@ type Version struct {
 	ResourceKind  string `json:"resourceKind"`
 	ExtractedFrom string `json:"extractedFrom"`
 	Version       string `json:"version"`
+	// Name of the container the version is extracted from when the containers are selected
+	ContainerName string `json:"containerName,omitempty"`
 }
 
 // VersionTrackerStatus defines the observed state of VersionTracker
@@ -194,19 +432,95 @@ func (v *VersionTracker) GetName() string {
 
 // GetKind returns the kind of the resource based on local version strategy
 func (v *VersionTracker) GetResourceKind() string {
+	if v.Spec.Resources.Strategy == CustomResources && v.Spec.Resources.Custom != nil {
+		return v.Spec.Resources.Custom.Kind
+	}
 	return v.Spec.Resources.Strategy
 }
 
 func (v *VersionTracker) Validate() error {
-	if v.Spec.LocalVersion.Strategy != ImageTag {
+	if _, preset := NodePresets[v.Spec.LocalVersion.Strategy]; preset && v.Spec.Resources.Strategy != "Nodes" {
+		return fmt.Errorf("the %s strategy requires the Nodes resources strategy", v.Spec.LocalVersion.Strategy)
+	}
+	if v.Spec.LocalVersion.Strategy != ImageTag && v.Spec.LocalVersion.Strategy != ImageDigest {
 		if v.Spec.LocalVersion.FieldSelector == "" {
-			return fmt.Errorf("fieldSelector is required when strategy is not ImageTag")
+			return fmt.Errorf("fieldSelector is required when strategy is not ImageTag or ImageDigest")
+		}
+	}
+	if v.Spec.LocalVersion.Strategy == ImageDigest && v.Spec.Resources.Strategy != "Pods" {
+		return fmt.Errorf("the ImageDigest strategy reads the container statuses and requires the Pods resources strategy")
+	}
+	if containers := v.Spec.LocalVersion.Containers; containers != nil {
+		if v.Spec.LocalVersion.Strategy != ImageTag && v.Spec.LocalVersion.Strategy != ImageDigest {
+			return fmt.Errorf("localVersion.containers is only supported by the ImageTag and ImageDigest strategies")
+		}
+		if v.Spec.Resources.Strategy == "Nodes" || v.Spec.Resources.Strategy == CustomResources {
+			return fmt.Errorf("localVersion.containers is not supported by the %s resources strategy", v.Spec.Resources.Strategy)
+		}
+		for _, t := range containers.Types {
+			if t != Containers && t != InitContainers && t != EphemeralContainers {
+				return fmt.Errorf("invalid container type %q: must be %s, %s or %s", t, Containers, InitContainers, EphemeralContainers)
+			}
+		}
+		if _, err := regexp.Compile(containers.NamePattern); err != nil {
+			return fmt.Errorf("invalid localVersion.containers.namePattern: %w", err)
+		}
+	}
+	if _, preset := ResourcePresets[v.Spec.Resources.Strategy]; preset {
+		if lv := v.Spec.LocalVersion; lv.Strategy != FieldSelection || lv.Containers != nil {
+			return fmt.Errorf("the %s resources strategy only supports the FieldSelection strategy", v.Spec.Resources.Strategy)
+		}
+	}
+	if err := v.Spec.Resources.validateFilters(); err != nil {
+		return err
+	}
+	if v.Spec.Resources.Strategy == CustomResources {
+		custom := v.Spec.Resources.Custom
+		if custom == nil || custom.Version == "" || custom.Kind == "" {
+			return fmt.Errorf("resources.custom.version and resources.custom.kind are required when the resources strategy is Custom")
+		}
+	}
+	return nil
+}
+
+// validateFilters checks that the filters of the resources are supported by the strategy
+func (r *Resources) validateFilters() error {
+	if r.FieldSelector != "" {
+		if r.Strategy == ClusterVersion {
+			return fmt.Errorf("resources.fieldSelector is not supported by the ClusterVersion strategy")
+		}
+		if _, err := fields.ParseSelector(r.FieldSelector); err != nil {
+			return fmt.Errorf("invalid resources.fieldSelector: %w", err)
+		}
+	}
+	if (len(r.PodPhases) > 0 || r.GroupByOwner) && r.Strategy != "Pods" {
+		return fmt.Errorf("resources.podPhases and resources.groupByOwner are only supported by the Pods strategy")
+	}
+	if r.MinReplicas != nil {
+		switch r.Strategy {
+		case "Deployments", "StatefulSets", "ReplicaSets", "DaemonSets":
+		default:
+			return fmt.Errorf("resources.minReplicas is not supported by the %s strategy", r.Strategy)
 		}
 	}
 	return nil
 }
+
 func (v *VersionTracker) SetDefaults() VersionTracker {
 	lv := v.Spec.LocalVersion
+	if preset, ok := ResourcePresets[v.Spec.Resources.Strategy]; ok {
+		// the versions of these resources are not read from an image
+		if lv.Strategy == "" || lv.Strategy == ImageTag {
+			lv.Strategy = FieldSelection
+		}
+		if lv.Strategy == FieldSelection {
+			applyPreset(&lv, &v.Spec.RemoteVersion, preset)
+		}
+	}
+	// the versions of the tracked chart are compared with its versions in the helm repository
+	if v.Spec.Resources.Strategy == HelmReleases && v.Spec.RemoteVersion.Chart == "" {
+		v.Spec.RemoteVersion.Chart = v.Spec.Resources.Chart
+	}
 	if lv.Strategy == ImageTag {
 		if lv.FieldSelector == "" {
 			lv.FieldSelector = ImageTagDefaults.FieldSelector
@@ -218,10 +532,46 @@ func (v *VersionTracker) SetDefaults() VersionTracker {
 			lv.Extraction.Regex.Result = ImageTagDefaults.Extraction.Regex.Result
 		}
 	}
+	if lv.Strategy == ImageDigest {
+		if lv.ImageLabel == "" {
+			lv.ImageLabel = ImageDigestDefaults.ImageLabel
+		}
+		if lv.Extraction.Regex.Pattern == "" {
+			lv.Extraction.Regex.Pattern = ImageDigestDefaults.Extraction.Regex.Pattern
+		}
+		if lv.Extraction.Regex.Result == "" {
+			lv.Extraction.Regex.Result = ImageDigestDefaults.Extraction.Regex.Result
+		}
+	}
+	if preset, ok := NodePresets[lv.Strategy]; ok {
+		applyPreset(&lv, &v.Spec.RemoteVersion, preset)
+	}
 	v.Spec.LocalVersion = lv
 	return *v
 }
 
+// applyPreset sets the unset fields of the local version and the remote version from the preset.
+// The upstream releases of the preset are compared when no other repo is configured
+func applyPreset(lv *LocalVersion, rv *RemoteVersion, preset Preset) {
+	if lv.FieldSelector == "" {
+		lv.FieldSelector = preset.LocalVersion.FieldSelector
+	}
+	if lv.Extraction.Regex.Pattern == "" {
+		lv.Extraction.Regex.Pattern = preset.LocalVersion.Extraction.Regex.Pattern
+	}
+	if lv.Extraction.Regex.Result == "" {
+		lv.Extraction.Regex.Result = preset.LocalVersion.Extraction.Regex.Result
+	}
+	if rv.Repo == "" && preset.RemoteVersion.Repo != "" {
+		rv.Provider = preset.RemoteVersion.Provider
+		rv.Strategy = preset.RemoteVersion.Strategy
+		rv.Repo = preset.RemoteVersion.Repo
+		if rv.Extraction.Regex.Pattern == "" {
+			rv.Extraction = preset.RemoteVersion.Extraction
+		}
+	}
+}
+
 func (v *VersionTracker) GetLocalVersion() LocalVersion {
 	return v.Spec.LocalVersion
 }
@@ -246,6 +596,18 @@ func (v *VersionTracker) GetObjectList() (client.ObjectList, error) {
 		return &batchv1.CronJobList{}, nil
 	case "Jobs":
 		return &batchv1.JobList{}, nil
+	case HelmReleases:
+		return &corev1.SecretList{}, nil
+	case CustomResources:
+		if v.Spec.Resources.Custom == nil {
+			return nil, fmt.Errorf("resources.custom is required when the resources strategy is Custom")
+		}
+		// listed with the unstructured client, so the kind doesn't need to be registered in the scheme
+		list := &unstructured.UnstructuredList{}
+		gvk := v.Spec.Resources.Custom.GroupVersionKind()
+		gvk.Kind += "List"
+		list.SetGroupVersionKind(gvk)
+		return list, nil
 	default:
 		return nil, fmt.Errorf("unsupported resource type: %s", v.Spec.Resources.Strategy)
 	}
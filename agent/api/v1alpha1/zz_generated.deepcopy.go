@@ -21,10 +21,76 @@ limitations under the License.
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Advisory) DeepCopyInto(out *Advisory) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Advisory.
+func (in *Advisory) DeepCopy() *Advisory {
+	if in == nil {
+		return nil
+	}
+	out := new(Advisory)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ContainerSelection) DeepCopyInto(out *ContainerSelection) {
+	*out = *in
+	if in.Types != nil {
+		in, out := &in.Types, &out.Types
+		*out = make([]ContainerType, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ContainerSelection.
+func (in *ContainerSelection) DeepCopy() *ContainerSelection {
+	if in == nil {
+		return nil
+	}
+	out := new(ContainerSelection)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CustomResource) DeepCopyInto(out *CustomResource) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CustomResource.
+func (in *CustomResource) DeepCopy() *CustomResource {
+	if in == nil {
+		return nil
+	}
+	out := new(CustomResource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Cycle) DeepCopyInto(out *Cycle) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Cycle.
+func (in *Cycle) DeepCopy() *Cycle {
+	if in == nil {
+		return nil
+	}
+	out := new(Cycle)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Extraction) DeepCopyInto(out *Extraction) {
 	*out = *in
@@ -41,10 +107,35 @@ func (in *Extraction) DeepCopy() *Extraction {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Lifecycle) DeepCopyInto(out *Lifecycle) {
+	*out = *in
+	if in.Cycles != nil {
+		in, out := &in.Cycles, &out.Cycles
+		*out = make([]Cycle, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Lifecycle.
+func (in *Lifecycle) DeepCopy() *Lifecycle {
+	if in == nil {
+		return nil
+	}
+	out := new(Lifecycle)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *LocalVersion) DeepCopyInto(out *LocalVersion) {
 	*out = *in
 	out.Extraction = in.Extraction
+	if in.Containers != nil {
+		in, out := &in.Containers, &out.Containers
+		*out = new(ContainerSelection)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LocalVersion.
@@ -76,6 +167,8 @@ func (in *Regex) DeepCopy() *Regex {
 func (in *RemoteVersion) DeepCopyInto(out *RemoteVersion) {
 	*out = *in
 	out.Extraction = in.Extraction
+	out.Advisory = in.Advisory
+	in.Lifecycle.DeepCopyInto(&out.Lifecycle)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RemoteVersion.
@@ -91,6 +184,11 @@ func (in *RemoteVersion) DeepCopy() *RemoteVersion {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Resources) DeepCopyInto(out *Resources) {
 	*out = *in
+	if in.Custom != nil {
+		in, out := &in.Custom, &out.Custom
+		*out = new(CustomResource)
+		**out = **in
+	}
 	if in.Namespaces != nil {
 		in, out := &in.Namespaces, &out.Namespaces
 		*out = make([]string, len(*in))
@@ -101,6 +199,16 @@ func (in *Resources) DeepCopyInto(out *Resources) {
 		*out = new(v1.LabelSelector)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.PodPhases != nil {
+		in, out := &in.PodPhases, &out.PodPhases
+		*out = make([]corev1.PodPhase, len(*in))
+		copy(*out, *in)
+	}
+	if in.MinReplicas != nil {
+		in, out := &in.MinReplicas, &out.MinReplicas
+		*out = new(int32)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Resources.
@@ -191,8 +299,8 @@ func (in *VersionTrackerList) DeepCopyObject() runtime.Object {
 func (in *VersionTrackerSpec) DeepCopyInto(out *VersionTrackerSpec) {
 	*out = *in
 	in.Resources.DeepCopyInto(&out.Resources)
-	out.LocalVersion = in.LocalVersion
-	out.RemoteVersion = in.RemoteVersion
+	in.LocalVersion.DeepCopyInto(&out.LocalVersion)
+	in.RemoteVersion.DeepCopyInto(&out.RemoteVersion)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VersionTrackerSpec.
@@ -248,12 +356,12 @@ func (in *VersionTrackerStatus) DeepCopyInto(out *VersionTrackerStatus) {
 	if in.LocalVersion != nil {
 		in, out := &in.LocalVersion, &out.LocalVersion
 		*out = new(LocalVersion)
-		**out = **in
+		(*in).DeepCopyInto(*out)
 	}
 	if in.RemoteVersion != nil {
 		in, out := &in.RemoteVersion, &out.RemoteVersion
 		*out = new(RemoteVersion)
-		**out = **in
+		(*in).DeepCopyInto(*out)
 	}
 }
 
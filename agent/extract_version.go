@@ -1,17 +1,30 @@
 package agent
 
 import (
+	"context"
 	"fmt"
+	"regexp"
 	"strings"
 
 	"github.com/skillz/opvic/agent/api/v1alpha1"
+	"github.com/skillz/opvic/oci"
 	"github.com/skillz/opvic/utils"
 	appsv1 "k8s.io/api/apps/v1"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+// extractedField is a field value that a version is extracted from
+type extractedField struct {
+	value string
+	// reported in the ExtractedFrom of the version. Differs from the value when the value is resolved from it
+	from string
+	// name of the container the value is read from, empty when the fieldSelector is used
+	container string
+}
+
 type SubjectVersion struct {
 	ID                 string
 	Namespace          string
@@ -23,10 +36,10 @@ type SubjectVersion struct {
 
 // ExtractSubjectVersion looks at the feild of each individuel resource and extracts the version
 // based on the extraction configuration in the VersionTracker
-func (r *VersionTrackerReconciler) ExtractSubjectVersion(v v1alpha1.VersionTracker, items []interface{}) SubjectVersion {
+func (r *VersionTrackerReconciler) ExtractSubjectVersion(ctx context.Context, v v1alpha1.VersionTracker, items []interface{}) SubjectVersion {
 	log := r.Log.WithName("extractor").WithValues("VersionTracker", fmt.Sprintf("%s/%s", v.ObjectMeta.Namespace, v.ObjectMeta.Name))
 	var version string
-	var versions []string
+	var versions []*v1alpha1.Version
 	uniqueVersions := []string{}
 	lv := v.GetLocalVersion()
 
@@ -42,63 +55,253 @@ func (r *VersionTrackerReconciler) ExtractSubjectVersion(v v1alpha1.VersionTrack
 	}
 
 	log.V(1).Info("resource count", "count", len(items))
+	// with groupByOwner, each workload is counted once per version instead of each pod
+	var owners []string
+	counted := map[string]bool{}
 	for _, i := range items {
-		valueStrings, err := getFeilds(lv.FieldSelector, i)
-		if err != nil {
-			log.Error(err, "failed to get fields from the resource")
-			reconciliationErrorsTotal.Inc()
-			continue
+		owner := ""
+		if v.Spec.Resources.GroupByOwner {
+			owner = ownerKey(i)
+			if !utils.Contains(owners, owner) {
+				owners = append(owners, owner)
+			}
 		}
-		if len(valueStrings) == 0 || len(valueStrings) > 1 {
-			log.Error(fmt.Errorf("jsonpath returned unexpected number of values: %d", len(valueStrings)), "unexpected number of values", "fieldSelector", lv.FieldSelector)
-			reconciliationErrorsTotal.Inc()
-			continue
+		var fields []extractedField
+		var err error
+		if lv.Strategy == v1alpha1.ImageDigest {
+			fields, err = r.getImageLabels(ctx, lv, i)
+		} else if lv.Containers != nil {
+			fields, err = getContainerImages(lv.Containers, i)
+		} else {
+			fields, err = getField(lv.FieldSelector, i)
 		}
-		fieldValue := valueStrings[0]
-		version, err = utils.GetResultsFromRegex(lv.Extraction.Regex.Pattern, lv.Extraction.Regex.Result, fieldValue)
 		if err != nil {
-			log.Error(fmt.Errorf("failed to extract version from: %s", fieldValue), "invalid regex", "regex", lv.Extraction.Regex.Pattern, "result template", lv.Extraction.Regex.Result)
-			reconciliationErrorsTotal.Inc()
-			continue
-		}
-		if version == "" {
-			log.Error(fmt.Errorf("failed to extract version from: %s", fieldValue), "extraction failed", "regex", lv.Extraction.Regex.Pattern, "result template", lv.Extraction.Regex.Result)
+			log.Error(err, "failed to get fields from the resource", "fieldSelector", lv.FieldSelector)
 			reconciliationErrorsTotal.Inc()
 			continue
 		}
+		for _, field := range fields {
+			version, err = utils.GetResultsFromRegex(lv.Extraction.Regex.Pattern, lv.Extraction.Regex.Result, field.value)
+			if err != nil {
+				log.Error(fmt.Errorf("failed to extract version from: %s", field.value), "invalid regex", "regex", lv.Extraction.Regex.Pattern, "result template", lv.Extraction.Regex.Result)
+				reconciliationErrorsTotal.Inc()
+				continue
+			}
+			if version == "" {
+				log.Error(fmt.Errorf("failed to extract version from: %s", field.value), "extraction failed", "regex", lv.Extraction.Regex.Pattern, "result template", lv.Extraction.Regex.Result)
+				reconciliationErrorsTotal.Inc()
+				continue
+			}
 
-		// add the version to the list of unique versions if it's not already there
-		if !utils.Contains(uniqueVersions, version) {
-			uniqueVersions = append(uniqueVersions, version)
-			appVersion.Versions = append(appVersion.Versions, &v1alpha1.Version{
-				Version:       version,
-				ExtractedFrom: fieldValue,
-				ResourceKind:  v.GetResourceKind(),
-			})
+			if owner != "" {
+				key := strings.Join([]string{version, field.container, owner}, "/")
+				if counted[key] {
+					continue
+				}
+				counted[key] = true
+			}
+
+			// add the version to the list of unique versions if it's not already there
+			if !utils.Contains(uniqueVersions, version) {
+				uniqueVersions = append(uniqueVersions, version)
+			}
+			// each container reports its own version entry
+			found := false
+			for _, t := range versions {
+				if t.Version == version && t.ContainerName == field.container {
+					t.ResourceCount++
+					found = true
+					break
+				}
+			}
+			if !found {
+				versions = append(versions, &v1alpha1.Version{
+					Version:       version,
+					ExtractedFrom: field.from,
+					ResourceKind:  v.GetResourceKind(),
+					ContainerName: field.container,
+					ResourceCount: 1,
+				})
+			}
 		}
-		versions = append(versions, version)
 	}
 	appVersion.TotalResourceCount = len(items)
-	appVersion.UniqVersions = uniqueVersions
-	// Set the number of pods for each version
-	for _, t := range appVersion.Versions {
-		for _, v := range versions {
-			if t.Version == v {
-				t.ResourceCount++
-			}
-		}
+	if v.Spec.Resources.GroupByOwner {
+		appVersion.TotalResourceCount = len(owners)
 	}
+	appVersion.UniqVersions = uniqueVersions
+	appVersion.Versions = versions
 	if len(appVersion.Versions) == 0 {
 		log.Info("could not extract any versions from the resources")
 	} else {
 		log.Info("unique version(s)", "version(s)", strings.Join(uniqueVersions, ", "))
 		for _, v := range appVersion.Versions {
-			log.V(1).Info("extracted version", "version", v.Version, "resource count", v.ResourceCount)
+			log.V(1).Info("extracted version", "version", v.Version, "container", v.ContainerName, "resource count", v.ResourceCount)
 		}
 	}
 	return *appVersion
 }
 
+// getField returns the single value of the fieldSelector in the resource
+func getField(fieldSelector string, item interface{}) ([]extractedField, error) {
+	valueStrings, err := getFeilds(fieldSelector, item)
+	if err != nil {
+		return nil, err
+	}
+	if len(valueStrings) != 1 {
+		return nil, fmt.Errorf("jsonpath returned unexpected number of values: %d", len(valueStrings))
+	}
+	return []extractedField{{value: valueStrings[0], from: valueStrings[0]}}, nil
+}
+
+// getContainerImages returns the image of each selected container in the pod spec of the resource
+func getContainerImages(selection *v1alpha1.ContainerSelection, item interface{}) ([]extractedField, error) {
+	spec := getPodSpec(item)
+	if spec == nil {
+		return nil, fmt.Errorf("containers can only be selected in resources with a pod spec, got %T", item)
+	}
+	namePattern, err := regexp.Compile(selection.NamePattern)
+	if err != nil {
+		return nil, err
+	}
+	var fields []extractedField
+	add := func(name, image string) {
+		if namePattern.MatchString(name) {
+			fields = append(fields, extractedField{value: image, from: image, container: name})
+		}
+	}
+	for _, t := range selection.GetTypes() {
+		switch t {
+		case v1alpha1.Containers:
+			for _, c := range spec.Containers {
+				add(c.Name, c.Image)
+			}
+		case v1alpha1.InitContainers:
+			for _, c := range spec.InitContainers {
+				add(c.Name, c.Image)
+			}
+		case v1alpha1.EphemeralContainers:
+			for _, c := range spec.EphemeralContainers {
+				add(c.Name, c.Image)
+			}
+		}
+	}
+	return fields, nil
+}
+
+// getImageLabels returns the image label of the running image of each selected container in the pod
+func (r *VersionTrackerReconciler) getImageLabels(ctx context.Context, lv v1alpha1.LocalVersion, item interface{}) ([]extractedField, error) {
+	if r.Images == nil {
+		return nil, fmt.Errorf("the image resolver is not configured")
+	}
+	pod, ok := item.(corev1.Pod)
+	if !ok {
+		return nil, fmt.Errorf("the running images can only be resolved from pods, got %T", item)
+	}
+	statuses, err := getContainerStatuses(lv.Containers, pod)
+	if err != nil {
+		return nil, err
+	}
+	var fields []extractedField
+	var platform *oci.Platform
+	for _, status := range statuses {
+		// the image is not pulled yet
+		if status.ImageID == "" {
+			continue
+		}
+		if platform == nil {
+			if platform, err = r.getNodePlatform(ctx, pod.Spec.NodeName); err != nil {
+				return nil, err
+			}
+		}
+		repoDigest, labels, err := r.Images.Labels(status.ImageID, *platform)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve the image of container %s: %w", status.Name, err)
+		}
+		value, found := labels[lv.ImageLabel]
+		if !found {
+			return nil, fmt.Errorf("image %s has no %s label", repoDigest, lv.ImageLabel)
+		}
+		field := extractedField{value: value, from: repoDigest}
+		if lv.Containers != nil {
+			field.container = status.Name
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// getNodePlatform returns the platform of the node, to pick the image that the node runs from a multi-platform index
+func (r *VersionTrackerReconciler) getNodePlatform(ctx context.Context, name string) (*oci.Platform, error) {
+	var node corev1.Node
+	if err := r.Get(ctx, client.ObjectKey{Name: name}, &node); err != nil {
+		return nil, fmt.Errorf("failed to get the node %s: %w", name, err)
+	}
+	return &oci.Platform{
+		OS:           node.Status.NodeInfo.OperatingSystem,
+		Architecture: node.Status.NodeInfo.Architecture,
+	}, nil
+}
+
+// getContainerStatuses returns the statuses of the selected containers of the pod,
+// or the status of its first container when the containers are not selected
+func getContainerStatuses(selection *v1alpha1.ContainerSelection, pod corev1.Pod) ([]corev1.ContainerStatus, error) {
+	if selection == nil {
+		if len(pod.Spec.Containers) == 0 {
+			return nil, nil
+		}
+		for _, status := range pod.Status.ContainerStatuses {
+			if status.Name == pod.Spec.Containers[0].Name {
+				return []corev1.ContainerStatus{status}, nil
+			}
+		}
+		return nil, nil
+	}
+	namePattern, err := regexp.Compile(selection.NamePattern)
+	if err != nil {
+		return nil, err
+	}
+	var statuses []corev1.ContainerStatus
+	for _, t := range selection.GetTypes() {
+		var candidates []corev1.ContainerStatus
+		switch t {
+		case v1alpha1.Containers:
+			candidates = pod.Status.ContainerStatuses
+		case v1alpha1.InitContainers:
+			candidates = pod.Status.InitContainerStatuses
+		case v1alpha1.EphemeralContainers:
+			candidates = pod.Status.EphemeralContainerStatuses
+		}
+		for _, status := range candidates {
+			if namePattern.MatchString(status.Name) {
+				statuses = append(statuses, status)
+			}
+		}
+	}
+	return statuses, nil
+}
+
+// getPodSpec returns the pod spec of a pod or the pod template of a workload
+func getPodSpec(item interface{}) *corev1.PodSpec {
+	switch i := item.(type) {
+	case corev1.Pod:
+		return &i.Spec
+	case appsv1.Deployment:
+		return &i.Spec.Template.Spec
+	case appsv1.DaemonSet:
+		return &i.Spec.Template.Spec
+	case appsv1.ReplicaSet:
+		return &i.Spec.Template.Spec
+	case appsv1.StatefulSet:
+		return &i.Spec.Template.Spec
+	case batchv1.Job:
+		return &i.Spec.Template.Spec
+	case batchv1.CronJob:
+		return &i.Spec.JobTemplate.Spec.Template.Spec
+	}
+	return nil
+}
+
 // Returns the list of items from the resources based on the resource type
 func GetItems(resources client.ObjectList) []interface{} {
 	var items []interface{}
@@ -151,6 +354,12 @@ func GetItems(resources client.ObjectList) []interface{} {
 			items[i] = item
 		}
 		return items
+	case *unstructured.UnstructuredList:
+		items = make([]interface{}, len(resources.(*unstructured.UnstructuredList).Items))
+		for i, item := range resources.(*unstructured.UnstructuredList).Items {
+			items[i] = item.Object
+		}
+		return items
 	}
 	return nil
 }
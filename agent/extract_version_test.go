@@ -0,0 +1,388 @@
+package agent
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/skillz/opvic/agent/api/v1alpha1"
+	"github.com/skillz/opvic/oci"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/version"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	clienttesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestExtractSubjectVersionCustomResource(t *testing.T) {
+	v := v1alpha1.VersionTracker{
+		ObjectMeta: metav1.ObjectMeta{Name: "istio", Namespace: "istio-system"},
+		Spec: v1alpha1.VersionTrackerSpec{
+			Name: "istio",
+			Resources: v1alpha1.Resources{
+				Strategy: v1alpha1.CustomResources,
+				Custom:   &v1alpha1.CustomResource{Group: "install.istio.io", Version: "v1alpha1", Kind: "IstioOperator"},
+			},
+			LocalVersion: v1alpha1.LocalVersion{
+				Strategy:      v1alpha1.FieldSelection,
+				FieldSelector: ".spec.tag",
+				Extraction:    v1alpha1.Extraction{Regex: v1alpha1.Regex{Pattern: `^(.*)$`, Result: "$1"}},
+			},
+		},
+	}
+	if err := v.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	list, err := v.GetObjectList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resources, ok := list.(*unstructured.UnstructuredList)
+	if !ok {
+		t.Fatalf("GetObjectList() = %T, want an unstructured list", list)
+	}
+	if gvk := resources.GroupVersionKind(); gvk.Group != "install.istio.io" || gvk.Version != "v1alpha1" || gvk.Kind != "IstioOperatorList" {
+		t.Errorf("got list kind %v, want install.istio.io/v1alpha1 IstioOperatorList", gvk)
+	}
+	for _, tag := range []string{"1.12.1", "1.12.1", "1.11.4"} {
+		resources.Items = append(resources.Items, unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "install.istio.io/v1alpha1",
+			"kind":       "IstioOperator",
+			"spec":       map[string]interface{}{"tag": tag},
+		}})
+	}
+
+	r := &VersionTrackerReconciler{Log: logr.Discard()}
+	sv := r.ExtractSubjectVersion(context.Background(), v, GetItems(resources))
+	if !reflect.DeepEqual(sv.UniqVersions, []string{"1.12.1", "1.11.4"}) {
+		t.Errorf("got versions %v, want 1.12.1 and 1.11.4", sv.UniqVersions)
+	}
+	for _, version := range sv.Versions {
+		if version.ResourceKind != "IstioOperator" {
+			t.Errorf("got resource kind %s, want IstioOperator", version.ResourceKind)
+		}
+	}
+	if sv.Versions[0].ResourceCount != 2 {
+		t.Errorf("got %d resources for 1.12.1, want 2", sv.Versions[0].ResourceCount)
+	}
+
+	v.Spec.Resources.Custom = &v1alpha1.CustomResource{Group: "install.istio.io"}
+	if err := v.Validate(); err == nil {
+		t.Error("Validate() succeeded without the version and kind of the custom resources")
+	}
+}
+
+func TestExtractSubjectVersionContainers(t *testing.T) {
+	pod := func(app, sidecar string) corev1.Pod {
+		return corev1.Pod{Spec: corev1.PodSpec{
+			InitContainers: []corev1.Container{{Name: "istio-init", Image: "istio/proxyv2:" + sidecar}},
+			Containers: []corev1.Container{
+				{Name: "app", Image: "example/app:" + app},
+				{Name: "istio-proxy", Image: "istio/proxyv2:" + sidecar},
+			},
+		}}
+	}
+	items := []interface{}{pod("1.0.0", "1.12.1"), pod("1.0.0", "1.12.1"), pod("1.1.0", "1.11.4")}
+
+	tests := []struct {
+		name       string
+		containers *v1alpha1.ContainerSelection
+		items      []interface{}
+		want       []v1alpha1.Version
+	}{
+		{
+			name:       "all_containers",
+			containers: &v1alpha1.ContainerSelection{},
+			items:      items,
+			want: []v1alpha1.Version{
+				{Version: "1.0.0", ContainerName: "app", ExtractedFrom: "example/app:1.0.0", ResourceCount: 2},
+				{Version: "1.12.1", ContainerName: "istio-proxy", ExtractedFrom: "istio/proxyv2:1.12.1", ResourceCount: 2},
+				{Version: "1.1.0", ContainerName: "app", ExtractedFrom: "example/app:1.1.0", ResourceCount: 1},
+				{Version: "1.11.4", ContainerName: "istio-proxy", ExtractedFrom: "istio/proxyv2:1.11.4", ResourceCount: 1},
+			},
+		},
+		{
+			name:       "name_pattern",
+			containers: &v1alpha1.ContainerSelection{Types: []v1alpha1.ContainerType{v1alpha1.Containers, v1alpha1.InitContainers}, NamePattern: "^istio-"},
+			items:      items[:1],
+			want: []v1alpha1.Version{
+				{Version: "1.12.1", ContainerName: "istio-proxy", ExtractedFrom: "istio/proxyv2:1.12.1", ResourceCount: 1},
+				{Version: "1.12.1", ContainerName: "istio-init", ExtractedFrom: "istio/proxyv2:1.12.1", ResourceCount: 1},
+			},
+		},
+		{
+			name:       "pod_template",
+			containers: &v1alpha1.ContainerSelection{NamePattern: "^app$"},
+			items: []interface{}{appsv1.Deployment{Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{
+				Spec: pod("2.0.0", "1.12.1").Spec,
+			}}}},
+			want: []v1alpha1.Version{
+				{Version: "2.0.0", ContainerName: "app", ExtractedFrom: "example/app:2.0.0", ResourceCount: 1},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := v1alpha1.VersionTracker{
+				Spec: v1alpha1.VersionTrackerSpec{
+					Name:         "app",
+					Resources:    v1alpha1.Resources{Strategy: "Pods"},
+					LocalVersion: v1alpha1.LocalVersion{Strategy: v1alpha1.ImageTag, Containers: tt.containers},
+				},
+			}
+			if err := v.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			v = v.SetDefaults()
+			r := &VersionTrackerReconciler{Log: logr.Discard()}
+			sv := r.ExtractSubjectVersion(context.Background(), v, tt.items)
+			if sv.TotalResourceCount != len(tt.items) {
+				t.Errorf("got %d resources, want %d", sv.TotalResourceCount, len(tt.items))
+			}
+			got := make([]v1alpha1.Version, len(sv.Versions))
+			for i, version := range sv.Versions {
+				got[i] = *version
+				got[i].ResourceKind = ""
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got versions %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateContainers(t *testing.T) {
+	tests := []struct {
+		name       string
+		strategy   v1alpha1.LocalStrategy
+		resources  string
+		containers v1alpha1.ContainerSelection
+		wantErr    bool
+	}{
+		{name: "valid", strategy: v1alpha1.ImageTag, resources: "Deployments", containers: v1alpha1.ContainerSelection{Types: []v1alpha1.ContainerType{v1alpha1.EphemeralContainers}}},
+		{name: "field_selection", strategy: v1alpha1.FieldSelection, resources: "Pods", wantErr: true},
+		{name: "nodes", strategy: v1alpha1.ImageTag, resources: "Nodes", wantErr: true},
+		{name: "invalid_type", strategy: v1alpha1.ImageTag, resources: "Pods", containers: v1alpha1.ContainerSelection{Types: []v1alpha1.ContainerType{"sidecars"}}, wantErr: true},
+		{name: "invalid_pattern", strategy: v1alpha1.ImageTag, resources: "Pods", containers: v1alpha1.ContainerSelection{NamePattern: "("}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			containers := tt.containers
+			v := v1alpha1.VersionTracker{Spec: v1alpha1.VersionTrackerSpec{
+				Resources:    v1alpha1.Resources{Strategy: tt.resources},
+				LocalVersion: v1alpha1.LocalVersion{Strategy: tt.strategy, FieldSelector: ".spec.version", Containers: &containers},
+			}}
+			if err := v.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExtractSubjectVersionImageDigest(t *testing.T) {
+	const (
+		stable = "docker.io/example/app@sha256:1111"
+		canary = "docker.io/example/app@sha256:2222"
+	)
+	amd64 := oci.Platform{OS: "linux", Architecture: "amd64"}
+	arm64 := oci.Platform{OS: "linux", Architecture: "arm64"}
+	images := NewImageResolver("", "")
+	images.labels[imageKey(stable, amd64)] = map[string]string{"org.opencontainers.image.version": "1.4.0"}
+	images.labels[imageKey(stable, arm64)] = map[string]string{"org.opencontainers.image.version": "1.4.0-arm64"}
+	images.labels[imageKey(canary, amd64)] = map[string]string{"org.opencontainers.image.version": "1.5.0-rc.1"}
+	node := func(name string, platform oci.Platform) *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status: corev1.NodeStatus{NodeInfo: corev1.NodeSystemInfo{
+				OperatingSystem: platform.OS,
+				Architecture:    platform.Architecture,
+			}},
+		}
+	}
+	pod := func(nodeName, imageID string) corev1.Pod {
+		return corev1.Pod{
+			Spec: corev1.PodSpec{NodeName: nodeName, Containers: []corev1.Container{{Name: "app", Image: "example/app:latest"}}},
+			Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{
+				{Name: "app", Image: "example/app:latest", ImageID: imageID},
+			}},
+		}
+	}
+	v := v1alpha1.VersionTracker{
+		Spec: v1alpha1.VersionTrackerSpec{
+			Name:         "app",
+			Resources:    v1alpha1.Resources{Strategy: "Pods"},
+			LocalVersion: v1alpha1.LocalVersion{Strategy: v1alpha1.ImageDigest},
+		},
+	}
+	if err := v.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	v = v.SetDefaults()
+
+	r := &VersionTrackerReconciler{
+		Client: fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(node("amd64", amd64), node("arm64", arm64)).Build(),
+		Log:    logr.Discard(),
+		Images: images,
+	}
+	// the docker runtime prefixes the image ids and a pending pod has no image id yet
+	items := []interface{}{
+		pod("amd64", stable),
+		pod("amd64", "docker-pullable://"+stable),
+		pod("amd64", canary),
+		pod("arm64", stable),
+		pod("", ""),
+	}
+	sv := r.ExtractSubjectVersion(context.Background(), v, items)
+	want := []v1alpha1.Version{
+		{Version: "1.4.0", ExtractedFrom: stable, ResourceKind: "Pods", ResourceCount: 2},
+		{Version: "1.5.0-rc.1", ExtractedFrom: canary, ResourceKind: "Pods", ResourceCount: 1},
+		{Version: "1.4.0-arm64", ExtractedFrom: stable, ResourceKind: "Pods", ResourceCount: 1},
+	}
+	got := make([]v1alpha1.Version, len(sv.Versions))
+	for i, version := range sv.Versions {
+		got[i] = *version
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got versions %+v, want %+v", got, want)
+	}
+
+	v.Spec.Resources.Strategy = "Deployments"
+	if err := v.Validate(); err == nil {
+		t.Error("Validate() succeeded, want the ImageDigest strategy to require pods")
+	}
+}
+
+func TestParseImageID(t *testing.T) {
+	tests := []struct {
+		imageID  string
+		wantRef  string
+		wantFrom string
+		wantErr  bool
+	}{
+		{imageID: "docker.io/library/nginx@sha256:abcd", wantRef: "registry-1.docker.io/library/nginx", wantFrom: "docker.io/library/nginx@sha256:abcd"},
+		{imageID: "docker-pullable://ghcr.io/skillz/opvic@sha256:abcd", wantRef: "ghcr.io/skillz/opvic", wantFrom: "ghcr.io/skillz/opvic@sha256:abcd"},
+		{imageID: "docker://sha256:abcd", wantErr: true},
+		{imageID: "nginx:latest", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.imageID, func(t *testing.T) {
+			from, ref, digest, err := parseImageID(tt.imageID)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseImageID() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if from != tt.wantFrom || ref.String() != tt.wantRef || digest != "sha256:abcd" {
+				t.Errorf("parseImageID() = %s, %s, %s", from, ref, digest)
+			}
+		})
+	}
+}
+
+func TestExtractSubjectVersionNodePresets(t *testing.T) {
+	node := corev1.Node{Status: corev1.NodeStatus{NodeInfo: corev1.NodeSystemInfo{
+		KubeletVersion:          "v1.21.5-eks-bc4871b",
+		ContainerRuntimeVersion: "containerd://1.4.6",
+		KernelVersion:           "5.4.0-1045-aws",
+		OSImage:                 "Ubuntu 20.04.3 LTS",
+	}}}
+	tests := []struct {
+		strategy   v1alpha1.LocalStrategy
+		want       string
+		wantRemote string
+	}{
+		{strategy: v1alpha1.KubeletVersion, want: "1.21.5", wantRemote: "kubernetes/kubernetes"},
+		{strategy: v1alpha1.ContainerRuntimeVersion, want: "1.4.6", wantRemote: "containerd/containerd"},
+		{strategy: v1alpha1.KernelVersion, want: "5.4.0"},
+		{strategy: v1alpha1.OSImage, want: "20.04.3"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.strategy), func(t *testing.T) {
+			v := v1alpha1.VersionTracker{Spec: v1alpha1.VersionTrackerSpec{
+				Name:         "nodes",
+				Resources:    v1alpha1.Resources{Strategy: "Nodes"},
+				LocalVersion: v1alpha1.LocalVersion{Strategy: tt.strategy},
+			}}
+			v = v.SetDefaults()
+			if err := v.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			if v.Spec.RemoteVersion.Repo != tt.wantRemote {
+				t.Errorf("got remote repo %q, want %q", v.Spec.RemoteVersion.Repo, tt.wantRemote)
+			}
+			r := &VersionTrackerReconciler{Log: logr.Discard()}
+			sv := r.ExtractSubjectVersion(context.Background(), v, []interface{}{node})
+			if !reflect.DeepEqual(sv.UniqVersions, []string{tt.want}) {
+				t.Errorf("got versions %v, want %s", sv.UniqVersions, tt.want)
+			}
+		})
+	}
+
+	// the configured remote version is kept
+	v := v1alpha1.VersionTracker{Spec: v1alpha1.VersionTrackerSpec{
+		Resources:     v1alpha1.Resources{Strategy: "Nodes"},
+		LocalVersion:  v1alpha1.LocalVersion{Strategy: v1alpha1.KubeletVersion},
+		RemoteVersion: v1alpha1.RemoteVersion{Provider: "github", Strategy: v1alpha1.GithubStrategyTags, Repo: "example/kubernetes"},
+	}}
+	if v = v.SetDefaults(); v.Spec.RemoteVersion.Repo != "example/kubernetes" {
+		t.Errorf("got remote repo %s, want the configured repo", v.Spec.RemoteVersion.Repo)
+	}
+
+	// the versions of the other runtimes would be compared with the containerd releases
+	v = v1alpha1.VersionTracker{Spec: v1alpha1.VersionTrackerSpec{
+		Name:         "nodes",
+		Resources:    v1alpha1.Resources{Strategy: "Nodes"},
+		LocalVersion: v1alpha1.LocalVersion{Strategy: v1alpha1.ContainerRuntimeVersion},
+	}}
+	v = v.SetDefaults()
+	node.Status.NodeInfo.ContainerRuntimeVersion = "docker://20.10.7"
+	r := &VersionTrackerReconciler{Log: logr.Discard()}
+	if sv := r.ExtractSubjectVersion(context.Background(), v, []interface{}{node}); len(sv.UniqVersions) != 0 {
+		t.Errorf("got versions %v for a docker runtime, want none", sv.UniqVersions)
+	}
+	v.Spec.Resources.Strategy = "Pods"
+	if err := v.Validate(); err == nil {
+		t.Error("Validate() succeeded, want the node presets to require the Nodes resources")
+	}
+}
+
+func TestExtractSubjectVersionClusterVersion(t *testing.T) {
+	discovery := &fakediscovery.FakeDiscovery{
+		Fake:               &clienttesting.Fake{},
+		FakedServerVersion: &version.Info{Major: "1", Minor: "21+", GitVersion: "v1.21.5-eks-bc4871b"},
+	}
+	v := v1alpha1.VersionTracker{Spec: v1alpha1.VersionTrackerSpec{
+		Name:         "kubernetes",
+		Resources:    v1alpha1.Resources{Strategy: v1alpha1.ClusterVersion},
+		LocalVersion: v1alpha1.LocalVersion{Strategy: v1alpha1.ImageTag},
+	}}
+	v = v.SetDefaults()
+	if err := v.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if v.Spec.RemoteVersion.Repo != "kubernetes/kubernetes" {
+		t.Errorf("got remote repo %q, want kubernetes/kubernetes", v.Spec.RemoteVersion.Repo)
+	}
+
+	r := &VersionTrackerReconciler{Log: logr.Discard(), Discovery: discovery}
+	items, err := r.getClusterVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sv := r.ExtractSubjectVersion(context.Background(), v, items)
+	want := []*v1alpha1.Version{{Version: "1.21.5", ExtractedFrom: "v1.21.5-eks-bc4871b", ResourceKind: "ClusterVersion", ResourceCount: 1}}
+	if !reflect.DeepEqual(sv.Versions, want) {
+		t.Errorf("got versions %+v, want %+v", sv.Versions[0], want[0])
+	}
+
+	v.Spec.LocalVersion.Strategy = v1alpha1.ImageDigest
+	if err := v.Validate(); err == nil {
+		t.Error("Validate() succeeded, want the ClusterVersion resources to only support FieldSelection")
+	}
+}
@@ -0,0 +1,73 @@
+package agent
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	// Type of the secrets of the Helm 3 release storage
+	HelmReleaseSecretType = "helm.sh/release.v1"
+	helmReleaseKey        = "release"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b, 0x08}
+	// labels of the secret of the deployed revision of a release
+	helmReleaseLabels = labels.Set{"owner": "helm", "status": "deployed"}
+)
+
+// HelmRelease is a release decoded from the Helm 3 storage.
+// Only the fields that the versions can be extracted from are decoded
+type HelmRelease struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	// Revision of the release
+	Version int `json:"version"`
+	Info    struct {
+		Status string `json:"status"`
+	} `json:"info"`
+	Chart struct {
+		Metadata struct {
+			Name       string `json:"name"`
+			Version    string `json:"version"`
+			AppVersion string `json:"appVersion"`
+		} `json:"metadata"`
+	} `json:"chart"`
+}
+
+// DecodeHelmRelease decodes the release stored in a sh.helm.release.v1 secret.
+// The release is a base64 encoded and gzipped JSON document
+func DecodeHelmRelease(secret corev1.Secret) (*HelmRelease, error) {
+	data, found := secret.Data[helmReleaseKey]
+	if !found {
+		return nil, fmt.Errorf("secret %s/%s has no %s key", secret.Namespace, secret.Name, helmReleaseKey)
+	}
+	b, err := base64.StdEncoding.DecodeString(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode the release of secret %s/%s: %w", secret.Namespace, secret.Name, err)
+	}
+	// the releases of the first Helm 3 versions are not compressed
+	if bytes.HasPrefix(b, gzipMagic) {
+		r, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress the release of secret %s/%s: %w", secret.Namespace, secret.Name, err)
+		}
+		defer r.Close()
+		if b, err = ioutil.ReadAll(r); err != nil {
+			return nil, fmt.Errorf("failed to decompress the release of secret %s/%s: %w", secret.Namespace, secret.Name, err)
+		}
+	}
+	var release HelmRelease
+	if err := json.Unmarshal(b, &release); err != nil {
+		return nil, fmt.Errorf("failed to decode the release of secret %s/%s: %w", secret.Namespace, secret.Name, err)
+	}
+	return &release, nil
+}
@@ -0,0 +1,109 @@
+package agent
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/skillz/opvic/agent/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// helmReleaseSecret encodes a release like the Helm 3 secrets storage driver
+func helmReleaseSecret(t *testing.T, name, chart, version, appVersion string, compress bool) corev1.Secret {
+	release := []byte(fmt.Sprintf(`{"name": %q, "namespace": "default", "version": 2, "info": {"status": "deployed"},
+		"chart": {"metadata": {"name": %q, "version": %q, "appVersion": %q}}, "manifest": "---"}`, name, chart, version, appVersion))
+	if compress {
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(release); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		release = buf.Bytes()
+	}
+	return corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "sh.helm.release.v1." + name + ".v2", Namespace: "default"},
+		Type:       HelmReleaseSecretType,
+		Data:       map[string][]byte{"release": []byte(base64.StdEncoding.EncodeToString(release))},
+	}
+}
+
+func TestDecodeHelmRelease(t *testing.T) {
+	tests := []struct {
+		name    string
+		secret  corev1.Secret
+		wantErr bool
+	}{
+		{name: "gzipped", secret: helmReleaseSecret(t, "ingress", "ingress-nginx", "4.0.6", "1.0.4", true)},
+		{name: "uncompressed", secret: helmReleaseSecret(t, "ingress", "ingress-nginx", "4.0.6", "1.0.4", false)},
+		{name: "missing_release", secret: corev1.Secret{Data: map[string][]byte{}}, wantErr: true},
+		{name: "invalid_base64", secret: corev1.Secret{Data: map[string][]byte{"release": []byte("%%%")}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			release, err := DecodeHelmRelease(tt.secret)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DecodeHelmRelease() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if release.Name != "ingress" || release.Info.Status != "deployed" || release.Chart.Metadata.Name != "ingress-nginx" ||
+				release.Chart.Metadata.Version != "4.0.6" || release.Chart.Metadata.AppVersion != "1.0.4" {
+				t.Errorf("DecodeHelmRelease() = %+v", release)
+			}
+		})
+	}
+}
+
+func TestExtractSubjectVersionHelmReleases(t *testing.T) {
+	secrets := &corev1.SecretList{Items: []corev1.Secret{
+		helmReleaseSecret(t, "ingress", "ingress-nginx", "4.0.6", "1.0.4", true),
+		helmReleaseSecret(t, "internal-ingress", "ingress-nginx", "4.0.1", "1.0.0", true),
+		helmReleaseSecret(t, "redis", "redis", "15.5.5", "6.2.6", true),
+		{Data: map[string][]byte{"release": []byte("broken")}},
+	}}
+	r := &VersionTrackerReconciler{Log: logr.Discard()}
+
+	tests := []struct {
+		name          string
+		fieldSelector string
+		want          []string
+	}{
+		{name: "chart_version", want: []string{"4.0.6", "4.0.1"}},
+		{name: "app_version", fieldSelector: ".chart.metadata.appVersion", want: []string{"1.0.4", "1.0.0"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := v1alpha1.VersionTracker{Spec: v1alpha1.VersionTrackerSpec{
+				Name:          "ingress-nginx",
+				Resources:     v1alpha1.Resources{Strategy: v1alpha1.HelmReleases, Chart: "ingress-nginx"},
+				LocalVersion:  v1alpha1.LocalVersion{Strategy: v1alpha1.ImageTag, FieldSelector: tt.fieldSelector},
+				RemoteVersion: v1alpha1.RemoteVersion{Provider: "helm-repo", Strategy: v1alpha1.HelmStrategyChartVersion, Repo: "https://kubernetes.github.io/ingress-nginx"},
+			}}
+			v = v.SetDefaults()
+			if err := v.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			if v.Spec.RemoteVersion.Chart != "ingress-nginx" {
+				t.Errorf("got remote chart %q, want ingress-nginx", v.Spec.RemoteVersion.Chart)
+			}
+			sv := r.ExtractSubjectVersion(context.Background(), v, r.getHelmReleases(secrets, v.Spec.Resources.Chart))
+			if !reflect.DeepEqual(sv.UniqVersions, tt.want) {
+				t.Errorf("got versions %v, want %v", sv.UniqVersions, tt.want)
+			}
+			if sv.TotalResourceCount != 2 {
+				t.Errorf("got %d releases, want 2", sv.TotalResourceCount)
+			}
+		})
+	}
+}
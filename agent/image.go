@@ -0,0 +1,75 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/skillz/opvic/oci"
+)
+
+// maximum number of image digests whose labels are kept in memory
+const maxCachedImages = 1000
+
+// ImageResolver resolves the image digests of the running containers to the labels of their image config
+type ImageResolver struct {
+	client *oci.Client
+	mutex  sync.Mutex
+	// labels by image digest and platform. A digest always points to the same image so they never expire
+	labels map[string]map[string]string
+}
+
+func NewImageResolver(username, password string) *ImageResolver {
+	return &ImageResolver{
+		client: oci.NewClient(username, password),
+		labels: map[string]map[string]string{},
+	}
+}
+
+// Labels returns the repository digest of the image ID reported in a container status and the labels of its image config.
+// The platform is the one of the node running the container, in case the digest is a multi-platform index
+func (r *ImageResolver) Labels(imageID string, platform oci.Platform) (string, map[string]string, error) {
+	repoDigest, ref, digest, err := parseImageID(imageID)
+	if err != nil {
+		return "", nil, err
+	}
+	key := imageKey(repoDigest, platform)
+	r.mutex.Lock()
+	labels, found := r.labels[key]
+	r.mutex.Unlock()
+	if found {
+		return repoDigest, labels, nil
+	}
+	labels, err = r.client.ImageLabels(ref, digest, platform)
+	if err != nil {
+		return "", nil, err
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if len(r.labels) >= maxCachedImages {
+		r.labels = map[string]map[string]string{}
+	}
+	r.labels[key] = labels
+	return repoDigest, labels, nil
+}
+
+func imageKey(repoDigest string, platform oci.Platform) string {
+	return repoDigest + " " + platform.String()
+}
+
+// parseImageID parses the image ID of a container status. The container runtimes report it as
+// docker.io/library/nginx@sha256:... (containerd, CRI-O) or docker-pullable://nginx@sha256:... (dockershim)
+func parseImageID(imageID string) (string, oci.Reference, string, error) {
+	if parts := strings.SplitN(imageID, "://", 2); len(parts) == 2 {
+		imageID = parts[1]
+	}
+	parts := strings.SplitN(imageID, "@", 2)
+	if len(parts) != 2 || !strings.HasPrefix(parts[1], "sha256:") {
+		return "", oci.Reference{}, "", fmt.Errorf("image id %q has no repository digest", imageID)
+	}
+	ref, err := oci.ParseReference(parts[0])
+	if err != nil {
+		return "", oci.Reference{}, "", err
+	}
+	return imageID, ref, parts[1], nil
+}
@@ -35,6 +35,31 @@ var (
 			Help:      "Duration of last reconciliation",
 		},
 	)
+	shipperQueueDepth = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricNamespace,
+			Subsystem: metricSubsystem,
+			Name:      "shipper_queue_depth",
+			Help:      "Number of payloads waiting to be shipped to the control plane",
+		},
+	)
+	shipperShippedTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: metricNamespace,
+			Subsystem: metricSubsystem,
+			Name:      "shipper_shipped_total",
+			Help:      "Number of payloads shipped to the control plane",
+		},
+	)
+	shipperDroppedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricNamespace,
+			Subsystem: metricSubsystem,
+			Name:      "shipper_dropped_total",
+			Help:      "Number of payloads dropped because the queue was full or the control plane rejected them as invalid",
+		},
+		[]string{"reason"},
+	)
 )
 
 func init() {
@@ -42,5 +67,8 @@ func init() {
 		reconciliationErrorsTotal,
 		lastReconciliationTimestamp,
 		reconciliationDuration,
+		shipperQueueDepth,
+		shipperShippedTotal,
+		shipperDroppedTotal,
 	)
 }
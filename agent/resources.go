@@ -0,0 +1,79 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/skillz/opvic/agent/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// filterItems removes the items that don't match the pod phases and the minimum replicas of the resources
+func filterItems(resources v1alpha1.Resources, items []interface{}) []interface{} {
+	if len(resources.PodPhases) == 0 && resources.MinReplicas == nil {
+		return items
+	}
+	filtered := []interface{}{}
+	for _, item := range items {
+		if pod, ok := item.(corev1.Pod); ok && len(resources.PodPhases) > 0 && !containsPhase(resources.PodPhases, pod.Status.Phase) {
+			continue
+		}
+		if replicas, ok := desiredReplicas(item); ok && resources.MinReplicas != nil && replicas < *resources.MinReplicas {
+			continue
+		}
+		filtered = append(filtered, item)
+	}
+	return filtered
+}
+
+func containsPhase(phases []corev1.PodPhase, phase corev1.PodPhase) bool {
+	for _, p := range phases {
+		if p == phase {
+			return true
+		}
+	}
+	return false
+}
+
+// desiredReplicas returns the number of replicas that the workload should run
+func desiredReplicas(item interface{}) (int32, bool) {
+	// the number of replicas defaults to 1 when it's not set
+	replicas := func(r *int32) int32 {
+		if r == nil {
+			return 1
+		}
+		return *r
+	}
+	switch i := item.(type) {
+	case appsv1.Deployment:
+		return replicas(i.Spec.Replicas), true
+	case appsv1.StatefulSet:
+		return replicas(i.Spec.Replicas), true
+	case appsv1.ReplicaSet:
+		return replicas(i.Spec.Replicas), true
+	case appsv1.DaemonSet:
+		return i.Status.DesiredNumberScheduled, true
+	}
+	return 0, false
+}
+
+// ownerKey returns the workload that owns the pod. The pods of a Deployment are grouped by the Deployment
+// rather than by each of its ReplicaSets. A pod without a controller is its own owner
+func ownerKey(item interface{}) string {
+	pod, ok := item.(corev1.Pod)
+	if !ok {
+		return ""
+	}
+	for _, owner := range pod.OwnerReferences {
+		if owner.Controller == nil || !*owner.Controller {
+			continue
+		}
+		// the ReplicaSets of a Deployment are named after the Deployment and the hash of the pod template
+		if hash := pod.Labels[appsv1.DefaultDeploymentUniqueLabelKey]; owner.Kind == "ReplicaSet" && hash != "" && strings.HasSuffix(owner.Name, "-"+hash) {
+			return fmt.Sprintf("%s/Deployment/%s", pod.Namespace, strings.TrimSuffix(owner.Name, "-"+hash))
+		}
+		return fmt.Sprintf("%s/%s/%s", pod.Namespace, owner.Kind, owner.Name)
+	}
+	return fmt.Sprintf("%s/Pod/%s", pod.Namespace, pod.Name)
+}
@@ -0,0 +1,168 @@
+package agent
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/skillz/opvic/agent/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func int32Ptr(i int32) *int32 {
+	return &i
+}
+
+func TestFilterItems(t *testing.T) {
+	pod := func(name string, phase corev1.PodPhase) corev1.Pod {
+		return corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name}, Status: corev1.PodStatus{Phase: phase}}
+	}
+	replicaSet := func(name string, replicas *int32) appsv1.ReplicaSet {
+		return appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Name: name}, Spec: appsv1.ReplicaSetSpec{Replicas: replicas}}
+	}
+	tests := []struct {
+		name      string
+		resources v1alpha1.Resources
+		items     []interface{}
+		want      []interface{}
+	}{
+		{
+			name:  "no_filters",
+			items: []interface{}{pod("running", corev1.PodRunning), pod("evicted", corev1.PodFailed)},
+			want:  []interface{}{pod("running", corev1.PodRunning), pod("evicted", corev1.PodFailed)},
+		},
+		{
+			name:      "pod_phases",
+			resources: v1alpha1.Resources{PodPhases: []corev1.PodPhase{corev1.PodRunning, corev1.PodPending}},
+			items:     []interface{}{pod("running", corev1.PodRunning), pod("evicted", corev1.PodFailed), pod("pending", corev1.PodPending)},
+			want:      []interface{}{pod("running", corev1.PodRunning), pod("pending", corev1.PodPending)},
+		},
+		{
+			name:      "min_replicas",
+			resources: v1alpha1.Resources{MinReplicas: int32Ptr(1)},
+			items:     []interface{}{replicaSet("current", int32Ptr(3)), replicaSet("old", int32Ptr(0)), replicaSet("default", nil)},
+			want:      []interface{}{replicaSet("current", int32Ptr(3)), replicaSet("default", nil)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := filterItems(tt.resources, tt.items); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("filterItems() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractSubjectVersionGroupByOwner(t *testing.T) {
+	controller := true
+	pod := func(name, owner, hash, image string) corev1.Pod {
+		p := corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: map[string]string{}},
+			Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: image}}},
+		}
+		if owner != "" {
+			p.OwnerReferences = []metav1.OwnerReference{{Kind: "ReplicaSet", Name: owner + "-" + hash, Controller: &controller}}
+			p.Labels[appsv1.DefaultDeploymentUniqueLabelKey] = hash
+		}
+		return p
+	}
+	// a rollout of the app Deployment is in progress and the worker Deployment runs the old version
+	items := []interface{}{
+		pod("app-5d9c-1", "app", "5d9c", "example/app:1.1.0"),
+		pod("app-5d9c-2", "app", "5d9c", "example/app:1.1.0"),
+		pod("app-7f4b-1", "app", "7f4b", "example/app:1.0.0"),
+		pod("worker-6c8d-1", "worker", "6c8d", "example/app:1.0.0"),
+		pod("worker-6c8d-2", "worker", "6c8d", "example/app:1.0.0"),
+		pod("debug", "", "", "example/app:1.0.0"),
+	}
+	v := v1alpha1.VersionTracker{Spec: v1alpha1.VersionTrackerSpec{
+		Name:         "app",
+		Resources:    v1alpha1.Resources{Strategy: "Pods", GroupByOwner: true},
+		LocalVersion: v1alpha1.LocalVersion{Strategy: v1alpha1.ImageTag},
+	}}
+	if err := v.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	v = v.SetDefaults()
+	r := &VersionTrackerReconciler{Log: logr.Discard()}
+	sv := r.ExtractSubjectVersion(context.Background(), v, items)
+	if sv.TotalResourceCount != 3 {
+		t.Errorf("got %d resources, want the 3 owners", sv.TotalResourceCount)
+	}
+	got := map[string]int{}
+	for _, version := range sv.Versions {
+		got[version.Version] = version.ResourceCount
+	}
+	if want := map[string]int{"1.1.0": 1, "1.0.0": 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got resource counts %v, want %v", got, want)
+	}
+}
+
+func TestListResourcesFieldSelector(t *testing.T) {
+	pod := func(name string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: map[string]string{"app": "example"}},
+			Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: "example/app:1.0.0"}}},
+		}
+	}
+	r := &VersionTrackerReconciler{
+		Client:    fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(pod("cached")).Build(),
+		APIReader: fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(pod("live")).Build(),
+		Log:       logr.Discard(),
+	}
+	tests := []struct {
+		name          string
+		fieldSelector string
+		want          string
+	}{
+		{name: "cache", want: "cached"},
+		{name: "api_reader", fieldSelector: "spec.nodeName=node-1", want: "live"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := v1alpha1.VersionTracker{Spec: v1alpha1.VersionTrackerSpec{Resources: v1alpha1.Resources{
+				Strategy:      "Pods",
+				Selector:      &metav1.LabelSelector{MatchLabels: map[string]string{"app": "example"}},
+				FieldSelector: tt.fieldSelector,
+			}}}
+			items, err := r.listResources(context.Background(), v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(items) != 1 || items[0].(corev1.Pod).Name != tt.want {
+				t.Errorf("listResources() = %v, want the %s pod", items, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateResourceFilters(t *testing.T) {
+	tests := []struct {
+		name      string
+		resources v1alpha1.Resources
+		wantErr   bool
+	}{
+		{name: "pods", resources: v1alpha1.Resources{Strategy: "Pods", FieldSelector: "spec.nodeName=node-1", PodPhases: []corev1.PodPhase{corev1.PodRunning}, GroupByOwner: true}},
+		{name: "replica_sets", resources: v1alpha1.Resources{Strategy: "ReplicaSets", MinReplicas: int32Ptr(1)}},
+		{name: "invalid_field_selector", resources: v1alpha1.Resources{Strategy: "Pods", FieldSelector: "status.phase"}, wantErr: true},
+		{name: "pod_phases_of_deployments", resources: v1alpha1.Resources{Strategy: "Deployments", PodPhases: []corev1.PodPhase{corev1.PodRunning}}, wantErr: true},
+		{name: "group_by_owner_of_nodes", resources: v1alpha1.Resources{Strategy: "Nodes", GroupByOwner: true}, wantErr: true},
+		{name: "min_replicas_of_pods", resources: v1alpha1.Resources{Strategy: "Pods", MinReplicas: int32Ptr(1)}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := v1alpha1.VersionTracker{Spec: v1alpha1.VersionTrackerSpec{
+				Resources:    tt.resources,
+				LocalVersion: v1alpha1.LocalVersion{Strategy: v1alpha1.ImageTag},
+			}}
+			if err := v.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
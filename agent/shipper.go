@@ -1,91 +1,330 @@
 package agent
 
 import (
-	"bytes"
-	"crypto/tls"
-	"encoding/json"
+	"context"
 	"fmt"
-	"net"
-	"net/http"
+	"math/rand"
 	"time"
 
+	"github.com/go-logr/logr"
+	"github.com/skillz/opvic/controlplane/client"
+	"github.com/skillz/opvic/utils"
+
 	controlplane "github.com/skillz/opvic/controlplane/api/v1alpha1"
 )
 
+const (
+	DefaultShipperQueueSize   = 500
+	DefaultShipperMinBackoff  = time.Second
+	DefaultShipperMaxBackoff  = 5 * time.Minute
+	DefaultShipperBatchWindow = 5 * time.Second
+	DefaultShipperBatchSize   = 100
+
+	dropReasonQueueFull = "queue_full"
+	dropReasonRejected  = "rejected"
+	dropReasonUntracked = "untracked"
+)
+
 type ShipperConfig struct {
+	// Identifier of the agent
+	AgentID   string
 	URL       string
 	Token     string
 	TLSVerify bool
 	Timeout   time.Duration
+	// CA bundle used to verify the control plane certificate. The system roots are used if empty
+	CAFile string
+	// Client certificate and key presented to the control plane instead of the token
+	CertFile string
+	KeyFile  string
+	// Directory where the payloads waiting to be shipped are persisted. If empty, they are only kept in memory
+	SpoolDir string
+	// Maximum number of subjects waiting to be shipped. The oldest payload is dropped when the queue is full
+	QueueSize int
+	// Backoff after a failed shipment. It doubles on every failure up to MaxBackoff
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// Time to wait after a payload is queued so the payloads queued in the meantime are shipped in the same batch
+	BatchWindow time.Duration
+	// Maximum number of payloads in a batch
+	BatchSize int
+	// Returns the identifiers of all the subjects tracked by the agent. It's sent with each batch
+	// so the control plane removes the subjects of deleted VersionTrackers. If nil, no subject is removed
+	Subjects func(ctx context.Context) ([]string, error)
+	Log      logr.Logger
 }
 
+// Shipper queues the payloads of the reconciler and ships them to the control plane in batches in the background.
+// Only the latest payload of each subject is kept and the failed shipments are retried with an exponential backoff.
 type Shipper struct {
-	Client    *http.Client
-	BaseURL   string
-	AuthToken string
+	agentID     string
+	client      *client.Client
+	queue       *spool
+	wakeup      chan struct{}
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
+	batchWindow time.Duration
+	batchSize   int
+	subjects    func(ctx context.Context) ([]string, error)
+	log         logr.Logger
 }
 
-func NewShipper(config *ShipperConfig) *Shipper {
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: !config.TLSVerify,
-		},
+func NewShipper(config *ShipperConfig) (*Shipper, error) {
+	c, err := client.New(client.Config{
+		URL:       config.URL,
+		Token:     config.Token,
+		TLSVerify: config.TLSVerify,
+		CAFile:    config.CAFile,
+		CertFile:  config.CertFile,
+		KeyFile:   config.KeyFile,
+		Timeout:   config.Timeout,
+		// the shipper retries with its own backoff
+		Retries: -1,
+		Logger:  config.Log,
+	})
+	if err != nil {
+		return nil, err
 	}
-	if config.Timeout > 0 {
-		tr.DialContext = (&net.Dialer{
-			Timeout: config.Timeout,
-		}).DialContext
+	size := config.QueueSize
+	if size <= 0 {
+		size = DefaultShipperQueueSize
 	}
-	return &Shipper{
-		Client: &http.Client{
-			Transport: tr,
-		},
-		BaseURL:   config.URL,
-		AuthToken: config.Token,
+	minBackoff := config.MinBackoff
+	if minBackoff <= 0 {
+		minBackoff = DefaultShipperMinBackoff
+	}
+	maxBackoff := config.MaxBackoff
+	if maxBackoff < minBackoff {
+		maxBackoff = DefaultShipperMaxBackoff
 	}
+	batchWindow := config.BatchWindow
+	if batchWindow < 0 {
+		batchWindow = 0
+	} else if batchWindow == 0 {
+		batchWindow = DefaultShipperBatchWindow
+	}
+	batchSize := config.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultShipperBatchSize
+	}
+	queue, err := newSpool(config.SpoolDir, size, config.Log)
+	if err != nil {
+		return nil, err
+	}
+	shipperQueueDepth.Set(float64(queue.Len()))
+	return &Shipper{
+		agentID:     config.AgentID,
+		client:      c,
+		queue:       queue,
+		wakeup:      make(chan struct{}, 1),
+		minBackoff:  minBackoff,
+		maxBackoff:  maxBackoff,
+		batchWindow: batchWindow,
+		batchSize:   batchSize,
+		subjects:    config.Subjects,
+		log:         config.Log,
+	}, nil
 }
 
-func (s *Shipper) Post(payload controlplane.AgentPayload) error {
-	agentsEndpoint := fmt.Sprintf("%s%s", s.BaseURL, controlplane.AgentsAPIEndpoint)
-	var buf bytes.Buffer
-	if err := json.NewEncoder(&buf).Encode(payload); err != nil {
-		return err
+// Enqueue replaces the queued payload of the subject and wakes up the shipper
+func (s *Shipper) Enqueue(payload controlplane.AgentPayload) error {
+	evicted, err := s.queue.Put(spoolKey(payload), payload, time.Now())
+	if evicted {
+		shipperDroppedTotal.WithLabelValues(dropReasonQueueFull).Inc()
 	}
-	req, err := http.NewRequest("POST", agentsEndpoint, &buf)
+	shipperQueueDepth.Set(float64(s.queue.Len()))
 	if err != nil {
 		return err
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", s.AuthToken))
-	resp, err := s.Client.Do(req)
-	if err != nil {
-		return err
+	select {
+	case s.wakeup <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Start ships the queued payloads until the context is done. It implements manager.Runnable
+func (s *Shipper) Start(ctx context.Context) error {
+	s.log.Info("starting the shipper", "queued", s.queue.Len())
+	var backoff time.Duration
+	for {
+		if err := s.flush(ctx); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			backoff = s.nextBackoff(backoff)
+			wait := jitter(backoff)
+			s.log.Error(err, "failed to ship the version info to the control plane", "queued", s.queue.Len(), "retryIn", wait.String())
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(wait):
+			}
+			continue
+		}
+		backoff = 0
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-s.wakeup:
+		}
+		// coalesce the payloads queued by the following reconciles
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(s.batchWindow):
+		}
+	}
+}
+
+// Delete drops the queued payload of the subject and removes the subject from the control plane
+func (s *Shipper) Delete(ctx context.Context, namespace, id string) error {
+	if err := s.queue.Delete(subjectKey(namespace, id)); err != nil {
+		s.log.Error(err, "failed to remove the payload from the spool", "VersionTracker", subjectKey(namespace, id))
+	}
+	shipperQueueDepth.Set(float64(s.queue.Len()))
+	err := s.client.DeleteSubjectVersion(ctx, s.agentID, id)
+	if client.IsNotFound(err) {
+		// the subject expired or was never shipped
+		return nil
+	}
+	return err
+}
+
+// NeedLeaderElection returns false so every agent replica ships its payloads
+func (s *Shipper) NeedLeaderElection() bool {
+	return false
+}
+
+// flush ships the queued payloads in batches from the oldest to the newest and stops at the first error that keeps the payloads queued
+func (s *Shipper) flush(ctx context.Context) error {
+	entries := s.queue.Entries()
+	if len(entries) == 0 {
+		return nil
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusAlreadyReported {
-		return fmt.Errorf("unexpected status code: %d status: %s", resp.StatusCode, resp.Status)
+	subjects := s.trackedSubjects(ctx)
+	if subjects != nil {
+		tracked := []spoolEntry{}
+		for _, entry := range entries {
+			if utils.Contains(subjects, entry.Payload.Version.ID) {
+				tracked = append(tracked, entry)
+				continue
+			}
+			// the VersionTracker was deleted while its payload was queued
+			shipperDroppedTotal.WithLabelValues(dropReasonUntracked).Inc()
+			s.remove(entry)
+		}
+		entries = tracked
+	}
+	for len(entries) > 0 {
+		n := s.batchSize
+		if n > len(entries) {
+			n = len(entries)
+		}
+		if err := s.shipBatch(ctx, entries[:n], subjects); err != nil {
+			return err
+		}
+		entries = entries[n:]
 	}
 	return nil
 }
 
-func (r *VersionTrackerReconciler) ShipToControlPlane(ver SubjectVersion) error {
-	log := r.Log.WithName("shipper").WithValues("VersionTracker", fmt.Sprintf("%s/%s", ver.Namespace, ver.ID))
-	log.Info("sending version info to the control plane")
-	shipperConf := &ShipperConfig{
-		URL:       r.Config.ControlPlaneUrl,
-		Token:     r.Config.ControlPlaneAuthToken,
-		Timeout:   time.Second * 10,
-		TLSVerify: true,
-	}
-	shipper := NewShipper(shipperConf)
-	err := shipper.Post(r.PrepareThePayload(ver))
+// shipBatch ships the entries in a single request. If the control plane rejects the batch as invalid or doesn't
+// support it, the entries are shipped one by one so only the invalid payloads are dropped.
+func (s *Shipper) shipBatch(ctx context.Context, entries []spoolEntry, subjects []string) error {
+	latest := entries[len(entries)-1].Payload
+	batch := controlplane.AgentBatchPayload{
+		AgentTags: latest.AgentTags,
+		Versions:  make([]controlplane.SubjectVersion, 0, len(entries)),
+		Subjects:  subjects,
+	}
+	for _, entry := range entries {
+		batch.Versions = append(batch.Versions, entry.Payload.Version)
+	}
+	err := s.client.PostAgentBatch(ctx, latest.AgentID, batch)
+	if client.IsBadRequest(err) || client.IsNotFound(err) {
+		s.log.V(1).Info("the control plane didn't accept the batch, shipping the payloads one by one", "error", err.Error())
+		return s.shipEach(ctx, entries)
+	}
 	if err != nil {
 		return err
 	}
-	log.Info("successfully sent version info to the control plane")
+	s.log.Info("successfully sent version info to the control plane", "count", len(entries))
+	shipperShippedTotal.Add(float64(len(entries)))
+	for _, entry := range entries {
+		s.remove(entry)
+	}
+	return nil
+}
+
+// shipEach ships the entries one by one and drops the payloads that the control plane rejects as invalid since
+// retrying them would fail again. The other errors keep the payloads queued: an authentication failure after
+// a token or certificate rotation is an outage like any other
+func (s *Shipper) shipEach(ctx context.Context, entries []spoolEntry) error {
+	for _, entry := range entries {
+		log := s.log.WithValues("VersionTracker", entry.Key)
+		err := s.client.PostAgent(ctx, entry.Payload)
+		if err != nil && !client.IsBadRequest(err) {
+			return err
+		}
+		if err != nil {
+			log.Error(err, "the control plane rejected the version info, dropping it")
+			shipperDroppedTotal.WithLabelValues(dropReasonRejected).Inc()
+		} else {
+			log.Info("successfully sent version info to the control plane")
+			shipperShippedTotal.Inc()
+		}
+		s.remove(entry)
+	}
 	return nil
 }
 
+func (s *Shipper) remove(entry spoolEntry) {
+	if err := s.queue.Remove(entry); err != nil {
+		s.log.Error(err, "failed to remove the payload from the spool", "VersionTracker", entry.Key)
+	}
+	shipperQueueDepth.Set(float64(s.queue.Len()))
+}
+
+// trackedSubjects returns the subjects tracked by the agent or nil if they can't be listed
+func (s *Shipper) trackedSubjects(ctx context.Context) []string {
+	if s.subjects == nil {
+		return nil
+	}
+	subjects, err := s.subjects(ctx)
+	if err != nil {
+		s.log.Error(err, "failed to list the tracked subjects, the batch won't remove the deleted subjects")
+		return nil
+	}
+	if subjects == nil {
+		subjects = []string{}
+	}
+	return subjects
+}
+
+func (s *Shipper) nextBackoff(backoff time.Duration) time.Duration {
+	if backoff == 0 {
+		return s.minBackoff
+	}
+	backoff *= 2
+	if backoff > s.maxBackoff {
+		return s.maxBackoff
+	}
+	return backoff
+}
+
+// jitter returns a random duration between half and all of d so the agents don't retry at the same time
+func jitter(d time.Duration) time.Duration {
+	half := int64(d / 2)
+	return time.Duration(half + rand.Int63n(half+1))
+}
+
+// ShipToControlPlane queues the version to be shipped to the control plane
+func (r *VersionTrackerReconciler) ShipToControlPlane(ver SubjectVersion) error {
+	r.Log.WithName("shipper").V(1).Info("queueing version info for the control plane", "VersionTracker", fmt.Sprintf("%s/%s", ver.Namespace, ver.ID))
+	return r.Shipper.Enqueue(r.PrepareThePayload(ver))
+}
+
 func (r *VersionTrackerReconciler) PrepareThePayload(sv SubjectVersion) controlplane.AgentPayload {
 	payload := controlplane.AgentPayload{}
 	payload.AgentID = r.Config.ID
@@ -97,6 +336,7 @@ func (r *VersionTrackerReconciler) PrepareThePayload(sv SubjectVersion) controlp
 			ResourceCount:  v.ResourceCount,
 			ResourceKind:   v.ResourceKind,
 			ExtractedFrom:  v.ExtractedFrom,
+			ContainerName:  v.ContainerName,
 		})
 	}
 	payload.Version = controlplane.SubjectVersion{
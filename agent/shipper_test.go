@@ -0,0 +1,369 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	controlplane "github.com/skillz/opvic/controlplane/api/v1alpha1"
+)
+
+func testPayload(id, version string) controlplane.AgentPayload {
+	return controlplane.AgentPayload{
+		AgentID: "test-agent",
+		Version: controlplane.SubjectVersion{
+			ID:              id,
+			NameSpace:       "default",
+			RunningVersions: []string{version},
+		},
+	}
+}
+
+func TestSpool(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	s, err := newSpool(dir, 2, logr.Discard())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []controlplane.AgentPayload{
+		testPayload("a", "1.0.0"),
+		testPayload("b", "1.0.0"),
+		// replaces the payload of a
+		testPayload("a", "1.1.0"),
+	} {
+		if evicted, err := s.Put(spoolKey(p), p, now); err != nil || evicted {
+			t.Fatalf("Put() = %v, %v, want no eviction", evicted, err)
+		}
+	}
+	// b is the oldest entry
+	c := testPayload("c", "1.0.0")
+	if evicted, err := s.Put(spoolKey(c), c, now); err != nil || !evicted {
+		t.Fatalf("Put() = %v, %v, want an eviction", evicted, err)
+	}
+
+	// the entries survive a restart
+	s, err = newSpool(dir, 2, logr.Discard())
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := s.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	got := map[string]string{}
+	for _, entry := range entries {
+		got[entry.Key] = entry.Payload.Version.RunningVersions[0]
+	}
+	if got["default/a"] != "1.1.0" || got["default/c"] != "1.0.0" {
+		t.Errorf("got entries %v, want the latest payloads of a and c", got)
+	}
+
+	// a replaced entry is not removed
+	a := testPayload("a", "1.2.0")
+	if _, err := s.Put(spoolKey(a), a, now); err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if err := s.Remove(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if entries := s.Entries(); len(entries) != 1 || entries[0].Payload.Version.RunningVersions[0] != "1.2.0" {
+		t.Errorf("got entries %v, want the latest payload of a", entries)
+	}
+
+	// a lower queue size drops the oldest entries on restart
+	if err := s.Remove(s.Entries()[0]); err != nil {
+		t.Fatal(err)
+	}
+	for i, id := range []string{"x", "y", "z"} {
+		p := testPayload(id, "1.0.0")
+		if _, err := s.Put(spoolKey(p), p, now.Add(time.Duration(i)*time.Second)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s, err = newSpool(dir, 1, logr.Discard())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries := s.Entries(); len(entries) != 1 || entries[0].Key != "default/z" {
+		t.Errorf("got entries %v, want the newest payload of z", entries)
+	}
+
+	// the order of the queue survives a restart
+	dir = t.TempDir()
+	s, err = newSpool(dir, 10, logr.Discard())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []string{"e", "b", "d", "a", "c"}
+	for i, id := range ids {
+		p := testPayload(id, "1.0.0")
+		if _, err := s.Put(spoolKey(p), p, now.Add(time.Duration(i)*time.Second)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s, err = newSpool(dir, 10, logr.Discard())
+	if err != nil {
+		t.Fatal(err)
+	}
+	order := []string{}
+	for _, entry := range s.Entries() {
+		order = append(order, entry.Payload.Version.ID)
+	}
+	if !reflect.DeepEqual(order, ids) {
+		t.Errorf("got entries %v after a restart, want %v", order, ids)
+	}
+}
+
+// testControlPlane records the versions received by the batch and single payload endpoints
+type testControlPlane struct {
+	mutex  sync.Mutex
+	outage int
+	// statuses of the responses to the first requests
+	failures []int
+	// the control plane doesn't have the batch endpoint
+	noBatch  bool
+	batches  []controlplane.AgentBatchPayload
+	received map[string]int
+	deleted  []string
+}
+
+func (cp *testControlPlane) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	cp.mutex.Lock()
+	defer cp.mutex.Unlock()
+	if cp.outage > 0 {
+		cp.outage--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	if len(cp.failures) > 0 {
+		w.WriteHeader(cp.failures[0])
+		cp.failures = cp.failures[1:]
+		return
+	}
+	if r.Method == http.MethodDelete {
+		if r.URL.Path != "/api/v1alpha1/agents/test-agent/a" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		cp.deleted = append(cp.deleted, r.URL.Path)
+		return
+	}
+	var versions []controlplane.SubjectVersion
+	switch r.URL.Path {
+	case "/api/v1alpha1/agents/test-agent/batch":
+		if cp.noBatch {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var batch controlplane.AgentBatchPayload
+		if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		cp.batches = append(cp.batches, batch)
+		versions = batch.Versions
+	case "/api/v1alpha1/agents":
+		var payload controlplane.AgentPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		versions = []controlplane.SubjectVersion{payload.Version}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	for _, v := range versions {
+		if v.ID == "invalid" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid remoteVersion"}`)) // nolint: errcheck
+			return
+		}
+	}
+	for _, v := range versions {
+		cp.received[v.ID]++
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func startTestShipper(t *testing.T, conf *ShipperConfig) (*Shipper, func()) {
+	conf.MinBackoff = time.Millisecond
+	conf.MaxBackoff = 10 * time.Millisecond
+	conf.Log = logr.Discard()
+	shipper, err := NewShipper(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- shipper.Start(ctx)
+	}()
+	return shipper, func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Start() error = %v", err)
+		}
+	}
+}
+
+func waitForEmptyQueue(t *testing.T, shipper *Shipper) {
+	deadline := time.Now().Add(5 * time.Second)
+	for shipper.queue.Len() > 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if shipper.queue.Len() != 0 {
+		t.Fatalf("got %d queued payloads, want the queue to be flushed", shipper.queue.Len())
+	}
+}
+
+func TestShipper(t *testing.T) {
+	cp := &testControlPlane{outage: 2, received: map[string]int{}}
+	server := httptest.NewServer(cp)
+	defer server.Close()
+
+	// the payloads queued before the start are shipped right away
+	conf := &ShipperConfig{URL: server.URL, SpoolDir: t.TempDir(), BatchWindow: time.Hour}
+	shipper, err := NewShipper(&ShipperConfig{URL: server.URL, SpoolDir: conf.SpoolDir, Log: logr.Discard()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []controlplane.AgentPayload{testPayload("a", "1.0.0"), testPayload("invalid", "1.0.0"), testPayload("b", "1.0.0")} {
+		if err := shipper.Enqueue(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	shipper, stop := startTestShipper(t, conf)
+	defer stop()
+	waitForEmptyQueue(t, shipper)
+
+	cp.mutex.Lock()
+	defer cp.mutex.Unlock()
+	// the rejected batch is shipped one by one to drop the invalid payload only
+	if len(cp.batches) != 1 || len(cp.batches[0].Versions) != 3 {
+		t.Errorf("got batches %v, want a single batch of 3 versions", cp.batches)
+	}
+	if cp.received["a"] != 1 || cp.received["b"] != 1 || cp.received["invalid"] != 0 {
+		t.Errorf("got payloads %v, want a and b once", cp.received)
+	}
+}
+
+func TestShipperKeepsPayloads(t *testing.T) {
+	tests := []struct {
+		name string
+		cp   *testControlPlane
+	}{
+		// e.g. the token was rotated before the agent reloaded it
+		{name: "unauthorized", cp: &testControlPlane{failures: []int{http.StatusUnauthorized, http.StatusUnauthorized}}},
+		{name: "forbidden", cp: &testControlPlane{failures: []int{http.StatusForbidden}}},
+		// the payloads are shipped one by one and the single payload endpoint is not found either
+		{name: "not_found", cp: &testControlPlane{failures: []int{http.StatusNotFound, http.StatusNotFound}}},
+		{name: "without_batch_endpoint", cp: &testControlPlane{noBatch: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cp.received = map[string]int{}
+			server := httptest.NewServer(tt.cp)
+			defer server.Close()
+			shipper, stop := startTestShipper(t, &ShipperConfig{URL: server.URL, BatchWindow: time.Millisecond})
+			defer stop()
+			for _, p := range []controlplane.AgentPayload{testPayload("a", "1.0.0"), testPayload("b", "1.0.0")} {
+				if err := shipper.Enqueue(p); err != nil {
+					t.Fatal(err)
+				}
+			}
+			waitForEmptyQueue(t, shipper)
+
+			tt.cp.mutex.Lock()
+			defer tt.cp.mutex.Unlock()
+			if tt.cp.received["a"] != 1 || tt.cp.received["b"] != 1 {
+				t.Errorf("got payloads %v, want a and b once", tt.cp.received)
+			}
+		})
+	}
+}
+
+func TestShipperBatch(t *testing.T) {
+	cp := &testControlPlane{received: map[string]int{}}
+	server := httptest.NewServer(cp)
+	defer server.Close()
+
+	shipper, stop := startTestShipper(t, &ShipperConfig{
+		URL:         server.URL,
+		BatchWindow: 50 * time.Millisecond,
+		Subjects: func(ctx context.Context) ([]string, error) {
+			return []string{"a", "b", "c"}, nil
+		},
+	})
+	defer stop()
+	for _, p := range []controlplane.AgentPayload{testPayload("a", "1.0.0"), testPayload("b", "1.0.0"), testPayload("deleted", "1.0.0")} {
+		if err := shipper.Enqueue(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitForEmptyQueue(t, shipper)
+
+	cp.mutex.Lock()
+	defer cp.mutex.Unlock()
+	if len(cp.batches) != 1 {
+		t.Fatalf("got %d batches, want the payloads to be coalesced", len(cp.batches))
+	}
+	batch := cp.batches[0]
+	if len(batch.Versions) != 2 || batch.Versions[0].ID != "a" || batch.Versions[1].ID != "b" {
+		t.Errorf("got versions %v, want a and b without the untracked subject", batch.Versions)
+	}
+	if !reflect.DeepEqual(batch.Subjects, []string{"a", "b", "c"}) {
+		t.Errorf("got subjects %v, want all the tracked subjects", batch.Subjects)
+	}
+}
+
+func TestShipperDelete(t *testing.T) {
+	cp := &testControlPlane{received: map[string]int{}}
+	server := httptest.NewServer(cp)
+	defer server.Close()
+
+	shipper, err := NewShipper(&ShipperConfig{AgentID: "test-agent", URL: server.URL, Log: logr.Discard()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := shipper.Enqueue(testPayload("a", "1.0.0")); err != nil {
+		t.Fatal(err)
+	}
+	if err := shipper.Delete(context.Background(), "default", "a"); err != nil {
+		t.Errorf("Delete() error = %v", err)
+	}
+	if shipper.queue.Len() != 0 {
+		t.Error("the queued payload of the deleted subject was not dropped")
+	}
+	if len(cp.deleted) != 1 {
+		t.Errorf("got %d delete requests, want 1", len(cp.deleted))
+	}
+	// a subject unknown to the control plane is already deleted
+	if err := shipper.Delete(context.Background(), "default", "b"); err != nil {
+		t.Errorf("Delete() error = %v, want nil for an unknown subject", err)
+	}
+}
+
+func TestNextBackoff(t *testing.T) {
+	s := &Shipper{minBackoff: time.Second, maxBackoff: 5 * time.Second}
+	var backoff time.Duration
+	for _, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		backoff = s.nextBackoff(backoff)
+		if backoff != want {
+			t.Errorf("nextBackoff() = %s, want %s", backoff, want)
+		}
+		if wait := jitter(backoff); wait < backoff/2 || wait > backoff {
+			t.Errorf("jitter(%s) = %s, want between half and all of it", backoff, wait)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package agent
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	controlplane "github.com/skillz/opvic/controlplane/api/v1alpha1"
+)
+
+const spoolFileExt = ".json"
+
+// spoolEntry is a payload waiting to be shipped to the control plane
+type spoolEntry struct {
+	// namespace/id of the subject
+	Key        string                    `json:"key"`
+	EnqueuedAt time.Time                 `json:"enqueuedAt"`
+	Payload    controlplane.AgentPayload `json:"payload"`
+	// incremented every time the entry is replaced so a shipped entry is not removed if it changed in the meantime
+	seq uint64
+}
+
+// spool is a bounded queue that keeps the latest payload of each subject.
+// When dir is set, the entries are persisted as one file per subject so they survive restarts.
+type spool struct {
+	dir     string
+	size    int
+	entries map[string]*spoolEntry
+	seq     uint64
+	mutex   sync.Mutex
+	log     logr.Logger
+}
+
+func newSpool(dir string, size int, log logr.Logger) (*spool, error) {
+	s := &spool{
+		dir:     dir,
+		size:    size,
+		entries: map[string]*spoolEntry{},
+		log:     log,
+	}
+	if dir == "" {
+		return s, nil
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create the spool directory: %w", err)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*"+spoolFileExt))
+	if err != nil {
+		return nil, err
+	}
+	loaded := []*spoolEntry{}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var entry spoolEntry
+		if err := json.Unmarshal(data, &entry); err != nil || entry.Key == "" {
+			log.Error(err, "removing invalid spool file", "file", file)
+			os.Remove(file) // nolint: errcheck
+			continue
+		}
+		loaded = append(loaded, &entry)
+	}
+	// the files are named after the hash of the key so the order of the queue is restored from the enqueue times
+	sort.SliceStable(loaded, func(i, j int) bool {
+		return loaded[i].EnqueuedAt.Before(loaded[j].EnqueuedAt)
+	})
+	for _, entry := range loaded {
+		s.seq++
+		entry.seq = s.seq
+		s.entries[entry.Key] = entry
+	}
+	// the queue size may have been lowered since the entries were persisted
+	for len(s.entries) > s.size {
+		if _, err := s.evictOldest(); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Put replaces the payload of the subject. If the spool is full, the oldest entry of another subject is evicted.
+// It returns true when an entry was evicted.
+func (s *spool) Put(key string, payload controlplane.AgentPayload, now time.Time) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var evicted bool
+	if _, found := s.entries[key]; !found && len(s.entries) >= s.size {
+		oldest, err := s.evictOldest()
+		if err != nil {
+			return false, err
+		}
+		s.log.Info("spool is full, dropped the oldest payload", "subject", oldest)
+		evicted = true
+	}
+	s.seq++
+	entry := &spoolEntry{Key: key, EnqueuedAt: now, Payload: payload, seq: s.seq}
+	if err := s.write(entry); err != nil {
+		return evicted, err
+	}
+	s.entries[key] = entry
+	return evicted, nil
+}
+
+// Entries returns a copy of the entries ordered from the oldest to the newest
+func (s *spool) Entries() []spoolEntry {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	entries := make([]spoolEntry, 0, len(s.entries))
+	for _, entry := range s.entries {
+		entries = append(entries, *entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].seq < entries[j].seq
+	})
+	return entries
+}
+
+// Remove deletes the entry unless it was replaced after it was read
+func (s *spool) Remove(entry spoolEntry) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	current, found := s.entries[entry.Key]
+	if !found || current.seq != entry.seq {
+		return nil
+	}
+	delete(s.entries, entry.Key)
+	return s.delete(entry.Key)
+}
+
+// Delete removes the entry of the subject
+func (s *spool) Delete(key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, found := s.entries[key]; !found {
+		return nil
+	}
+	delete(s.entries, key)
+	return s.delete(key)
+}
+
+func (s *spool) Len() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.entries)
+}
+
+func (s *spool) evictOldest() (string, error) {
+	var oldest *spoolEntry
+	for _, entry := range s.entries {
+		if oldest == nil || entry.seq < oldest.seq {
+			oldest = entry
+		}
+	}
+	if oldest == nil {
+		return "", nil
+	}
+	delete(s.entries, oldest.Key)
+	return oldest.Key, s.delete(oldest.Key)
+}
+
+func (s *spool) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:])[:16]+spoolFileExt)
+}
+
+// write persists the entry with a rename so a crash never leaves a partial file
+func (s *spool) write(entry *spoolEntry) error {
+	if s.dir == "" {
+		return nil
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(s.dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // nolint: errcheck
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path(entry.Key))
+}
+
+func (s *spool) delete(key string) error {
+	if s.dir == "" {
+		return nil
+	}
+	if err := os.Remove(s.path(key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// spoolKey is the identifier of the subject of a payload
+func spoolKey(payload controlplane.AgentPayload) string {
+	return subjectKey(payload.Version.NameSpace, payload.Version.ID)
+}
+
+func subjectKey(namespace, id string) string {
+	return strings.Join([]string{namespace, id}, "/")
+}
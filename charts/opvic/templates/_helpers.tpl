@@ -56,6 +56,8 @@ Shared Auth secret name
 {{- printf "%s-shared-auth-token" (include "opvic.fullname" .) }}
 {{- else if .Values.sharedAuthentication.existingSecret }}
 {{- .Values.sharedAuthentication.existingSecret }}
+{{- else if and .Values.agent.tls.clientCert (not .Values.controlplane.enabled) }}
+{{- /* the agent authenticates with its client certificate */}}
 {{- else }}
 {{- fail "sharedAuthentication.token or sharedAuthentication.existingSecret must be set" }}
 {{- end }}
@@ -100,6 +102,17 @@ Control Plane Githu Provider secret name
 {{- end }}
 {{- end }}
 
+{{/*
+Control Plane Gitlab Provider secret name
+*/}}
+{{- define "opvic.controlplane.providers.gitlab.secretName" -}}
+{{- if .Values.controlplane.providers.gitlab.createSecret }}
+{{- printf "%s-control-plane-provider-gitlab-secrets" (include "opvic.fullname" .)}}
+{{- else if .Values.controlplane.providers.gitlab.existingSecret }}
+{{- .Values.controlplane.providers.gitlab.existingSecret }}
+{{- end }}
+{{- end }}
+
 {{/*
 Agent labels
 */}}
@@ -132,7 +145,8 @@ Control Plane URL
 */}}
 {{- define "opvic.agent.controlPlaneURL" -}}
 {{- if and (not .Values.agent.controlPlaneURL) (.Values.controlplane.enabled) }}
-{{- default (printf "http://%s-control-plane" (include "opvic.fullname" .)) .Values.agent.controlPlaneURL }}
+{{- $scheme := ternary "https" "http" (not (empty .Values.controlplane.tls.existingSecret)) }}
+{{- printf "%s://%s-control-plane" $scheme (include "opvic.fullname" .) }}
 {{- else }}
 {{- .Values.agent.controlPlaneURL }}
 {{- end }}
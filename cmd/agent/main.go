@@ -20,16 +20,20 @@ import (
 	"fmt"
 	"os"
 	"regexp"
+	"strconv"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
 	zaplib "go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/discovery"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
@@ -57,7 +61,20 @@ var (
 	agentInterval         = kingpin.Flag("agent.interval", "Agent reconciliation interval").Envar("AGENT_INTERVAL").Default("60s").Duration()
 	agentTags             = kingpin.Flag("agent.tags", "key:value pair to add to the agent tags. (you can pass this flag multiple times").Envar("AGENT_TAGS").PlaceHolder("KEY:VALUE").StringMap()
 	controlPlaneUrl       = kingpin.Flag("controlplane.url", "Control Plane URL").Envar("CONTROLPLANE_URL").PlaceHolder("http(s)://CONTROLPLANE-ADDRESS").String()
-	controlPlaneAuthToken = kingpin.Flag("controlplane.auth-token", "Control Plane Shared Auth Token").Envar("CONTROLPLANE_AUTH_TOKEN").String()
+	controlPlaneAuthToken = kingpin.Flag("controlplane.auth-token", "Control Plane Auth Token. Not required when the agent authenticates with a client certificate").Envar("CONTROLPLANE_AUTH_TOKEN").String()
+	controlPlaneCAFile    = kingpin.Flag("controlplane.ca-file", "CA bundle to verify the control plane certificate. The system roots are used if empty").Envar("CONTROLPLANE_CA_FILE").String()
+	controlPlaneCertFile  = kingpin.Flag("controlplane.cert-file", "Client certificate presented to the control plane. Its common name must be the agent identifier").Envar("CONTROLPLANE_CERT_FILE").String()
+	controlPlaneKeyFile   = kingpin.Flag("controlplane.key-file", "Key of the client certificate").Envar("CONTROLPLANE_KEY_FILE").String()
+	controlPlaneSkipTLS   = kingpin.Flag("controlplane.insecure-skip-tls-verify", "Skip the verification of the control plane certificate").Envar("CONTROLPLANE_INSECURE_SKIP_TLS_VERIFY").Bool()
+	registryUsername      = kingpin.Flag("registry.username", "Username to pull the image manifests of the ImageDigest strategy").Envar("REGISTRY_USERNAME").String()
+	registryPassword      = kingpin.Flag("registry.password", "Password or token to pull the image manifests of the ImageDigest strategy").Envar("REGISTRY_PASSWORD").String()
+	shipperSpoolDir       = kingpin.Flag("shipper.spool-dir", "Directory where the payloads waiting to be shipped to the control plane are persisted. If empty, they are only kept in memory").Envar("SHIPPER_SPOOL_DIR").String()
+	shipperQueueSize      = kingpin.Flag("shipper.queue-size", "Maximum number of subjects waiting to be shipped to the control plane").Envar("SHIPPER_QUEUE_SIZE").Default(strconv.Itoa(agent.DefaultShipperQueueSize)).Int()
+	shipperTimeout        = kingpin.Flag("shipper.timeout", "Timeout of the requests to the control plane").Envar("SHIPPER_TIMEOUT").Default("10s").Duration()
+	shipperMinBackoff     = kingpin.Flag("shipper.min-backoff", "Backoff after a failed shipment to the control plane").Envar("SHIPPER_MIN_BACKOFF").Default(agent.DefaultShipperMinBackoff.String()).Duration()
+	shipperMaxBackoff     = kingpin.Flag("shipper.max-backoff", "Maximum backoff between retries of the failed shipments").Envar("SHIPPER_MAX_BACKOFF").Default(agent.DefaultShipperMaxBackoff.String()).Duration()
+	shipperBatchWindow    = kingpin.Flag("shipper.batch-window", "Time to wait after a version is queued so the versions queued in the meantime are shipped in the same request").Envar("SHIPPER_BATCH_WINDOW").Default(agent.DefaultShipperBatchWindow.String()).Duration()
+	shipperBatchSize      = kingpin.Flag("shipper.batch-size", "Maximum number of versions shipped in a single request").Envar("SHIPPER_BATCH_SIZE").Default(strconv.Itoa(agent.DefaultShipperBatchSize)).Int()
 	logLevel              = kingpin.Flag("log.level", "The verbosity of the logging. Valid values are `debug`, `info`, `warn`, `error`").Envar("LOG_LEVEL").Default("info").String()
 )
 
@@ -96,6 +113,8 @@ func main() {
 		MetricsBindAddress:     *metricsAddr,
 		Port:                   9443,
 		HealthProbeBindAddress: *probeAddr,
+		// the secrets are only read by the HelmReleases strategy, so they are not cached and watched
+		ClientDisableCacheFor: []client.Object{&corev1.Secret{}},
 	})
 	if err != nil {
 		setupLog.Error(err, "unable to start agent")
@@ -115,12 +134,49 @@ func main() {
 		ControlPlaneAuthToken: *controlPlaneAuthToken,
 		Tags:                  *agentTags,
 	}
-	if err = (&agent.VersionTrackerReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("opvic-agent"),
-		Scheme: mgr.GetScheme(),
-		Config: conf,
-	}).SetupWithManager(mgr); err != nil {
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(mgr.GetConfig())
+	if err != nil {
+		setupLog.Error(err, "unable to create the discovery client")
+		os.Exit(1)
+	}
+	reconciler := &agent.VersionTrackerReconciler{
+		Client:    mgr.GetClient(),
+		Log:       ctrl.Log.WithName("opvic-agent"),
+		Scheme:    mgr.GetScheme(),
+		Config:    conf,
+		Images:    agent.NewImageResolver(*registryUsername, *registryPassword),
+		Discovery: discoveryClient,
+		APIReader: mgr.GetAPIReader(),
+	}
+	if *controlPlaneUrl != "" {
+		reconciler.Shipper, err = agent.NewShipper(&agent.ShipperConfig{
+			AgentID:     *agentID,
+			URL:         *controlPlaneUrl,
+			Token:       *controlPlaneAuthToken,
+			TLSVerify:   !*controlPlaneSkipTLS,
+			CAFile:      *controlPlaneCAFile,
+			CertFile:    *controlPlaneCertFile,
+			KeyFile:     *controlPlaneKeyFile,
+			Timeout:     *shipperTimeout,
+			SpoolDir:    *shipperSpoolDir,
+			QueueSize:   *shipperQueueSize,
+			MinBackoff:  *shipperMinBackoff,
+			MaxBackoff:  *shipperMaxBackoff,
+			BatchWindow: *shipperBatchWindow,
+			BatchSize:   *shipperBatchSize,
+			Subjects:    reconciler.TrackedSubjects,
+			Log:         ctrl.Log.WithName("opvic-agent").WithName("shipper"),
+		})
+		if err != nil {
+			setupLog.Error(err, "unable to create the shipper")
+			os.Exit(1)
+		}
+		if err := mgr.Add(reconciler.Shipper); err != nil {
+			setupLog.Error(err, "unable to add the shipper")
+			os.Exit(1)
+		}
+	}
+	if err = reconciler.SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "VersionTracker")
 		os.Exit(1)
 	}
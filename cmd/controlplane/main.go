@@ -23,7 +23,16 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/skillz/opvic/controlplane"
+	"github.com/skillz/opvic/controlplane/advisory"
+	"github.com/skillz/opvic/controlplane/auth"
+	"github.com/skillz/opvic/controlplane/notifier"
+	"github.com/skillz/opvic/controlplane/providers"
 	"github.com/skillz/opvic/controlplane/providers/github"
+	"github.com/skillz/opvic/controlplane/providers/gitlab"
+	"github.com/skillz/opvic/controlplane/providers/helm"
+	"github.com/skillz/opvic/controlplane/providers/registry"
+	"github.com/skillz/opvic/controlplane/storage"
+	"github.com/skillz/opvic/controlplane/tlsconfig"
 	"github.com/skillz/opvic/utils"
 	zaplib "go.uber.org/zap"
 	"gopkg.in/alecthomas/kingpin.v2"
@@ -39,15 +48,45 @@ const (
 
 var (
 	controlPlaneBindAddr         = kingpin.Flag("controlplane.bind-address", "The address the metric endpoint binds to.").Envar("CONTROLPLANE_BIND_ADDRESS").Default(":8080").String()
-	controlPlaneAuthToken        = kingpin.Flag("controlplane.auth-token", "Control Plane Shared Auth Token").Envar("CONTROLPLANE_AUTH_TOKEN").Required().String()
+	controlPlaneAuthToken        = kingpin.Flag("controlplane.auth-token", "Control Plane Shared Auth Token with read and write access to all the agents").Envar("CONTROLPLANE_AUTH_TOKEN").String()
+	tlsCertFile                  = kingpin.Flag("controlplane.tls.cert-file", "TLS certificate of the control plane. It's reloaded when the file changes. Plain HTTP is served if empty").Envar("CONTROLPLANE_TLS_CERT_FILE").String()
+	tlsKeyFile                   = kingpin.Flag("controlplane.tls.key-file", "TLS key of the control plane").Envar("CONTROLPLANE_TLS_KEY_FILE").String()
+	tlsClientCAFile              = kingpin.Flag("controlplane.tls.client-ca-file", "CA bundle to verify the client certificates. The agents with a valid certificate don't need a token").Envar("CONTROLPLANE_TLS_CLIENT_CA_FILE").String()
+	tlsRequireClientCert         = kingpin.Flag("controlplane.tls.require-client-cert", "Reject the connections without a valid client certificate").Envar("CONTROLPLANE_TLS_REQUIRE_CLIENT_CERT").Bool()
+	jwtIssuer                    = kingpin.Flag("controlplane.jwt.issuer", "Issuer of the JWTs accepted alongside the static tokens. The JWT authentication is disabled if empty").Envar("CONTROLPLANE_JWT_ISSUER").String()
+	jwtAudience                  = kingpin.Flag("controlplane.jwt.audience", "Expected audience of the JWTs").Envar("CONTROLPLANE_JWT_AUDIENCE").String()
+	jwtJWKSURL                   = kingpin.Flag("controlplane.jwt.jwks-url", "URL of the JSON Web Key Set of the issuer. Discovered from the OpenID configuration of the issuer if empty").Envar("CONTROLPLANE_JWT_JWKS_URL").String()
+	jwtJWKSFile                  = kingpin.Flag("controlplane.jwt.jwks-file", "JSON Web Key Set file, instead of the JWKS url").Envar("CONTROLPLANE_JWT_JWKS_FILE").String()
+	jwtJWKSRefreshInterval       = kingpin.Flag("controlplane.jwt.jwks-refresh-interval", "Interval between two refreshes of the JSON Web Key Set").Envar("CONTROLPLANE_JWT_JWKS_REFRESH_INTERVAL").Default(auth.DefaultJWKSRefreshInterval.String()).Duration()
+	jwtUsernameClaim             = kingpin.Flag("controlplane.jwt.username-claim", "Claim with the name of the identity").Envar("CONTROLPLANE_JWT_USERNAME_CLAIM").Default(auth.DefaultUsernameClaim).String()
+	jwtGroupsClaim               = kingpin.Flag("controlplane.jwt.groups-claim", "Claim with the groups of the identity").Envar("CONTROLPLANE_JWT_GROUPS_CLAIM").Default(auth.DefaultGroupsClaim).String()
+	jwtGroupScopes               = kingpin.Flag("controlplane.jwt.group-scope", "Scope granted to the members of a group (e.g. sre=read). Can be repeated").Envar("CONTROLPLANE_JWT_GROUP_SCOPES").PlaceHolder("GROUP=SCOPE").Strings()
+	credentialsFile              = kingpin.Flag("controlplane.credentials-file", "YAML file that maps tokens to identities and scopes (read, write, agent:<id>:write)").Envar("CONTROLPLANE_CREDENTIALS_FILE").String()
+	credentialsReloadInterval    = kingpin.Flag("controlplane.credentials-reload-interval", "Interval between two reloads of the credentials file").Envar("CONTROLPLANE_CREDENTIALS_RELOAD_INTERVAL").Default("30s").Duration()
 	providerGithubToken          = kingpin.Flag("provider.github.token", "Github PAT for the github provider").Envar("PROVIDER_GITHUB_TOKEN").String()
 	providerGithubAppID          = kingpin.Flag("provider.github.app-id", "Github App ID for the github provider").Envar("PROVIDER_GITHUB_APP_ID").Int64()
 	providerGithubInstallationID = kingpin.Flag("provider.github.app-installation-id", "Github App ID for the github provider").Envar("PROVIDER_GITHUB_APP_INSTALLATION_ID").Int64()
 	providerGithubAppPrivateKey  = kingpin.Flag("provider.github.app-private-key", "Github APP Private Key for github provider").Envar("PROVIDER_GITHUB_APP_PRIVATE_KEY").Default("").String()
+	providerGitlabBaseURL        = kingpin.Flag("provider.gitlab.base-url", "Base URL of the Gitlab instance for the gitlab provider").Envar("PROVIDER_GITLAB_BASE_URL").Default(gitlab.DefaultBaseURL).String()
+	providerGitlabToken          = kingpin.Flag("provider.gitlab.token", "Gitlab access token for the gitlab provider").Envar("PROVIDER_GITLAB_TOKEN").Default("").String()
+	providerRegistryUsername     = kingpin.Flag("provider.registry.username", "Username for the registry provider").Envar("PROVIDER_REGISTRY_USERNAME").Default("").String()
+	providerRegistryPassword     = kingpin.Flag("provider.registry.password", "Password or token for the registry provider").Envar("PROVIDER_REGISTRY_PASSWORD").Default("").String()
 	cacheExpiration              = kingpin.Flag("cache.expiration", "Cache expiration duration").Envar("CACHE_EXPIRATION").Default("1h").Duration()
 	cacheReconcilerInterval      = kingpin.Flag("cache.reconciler-interval", "Cache reconciler interval").Envar("CACHE_RECONCILER_INTERVAL").Default("30s").Duration()
+	storageBackend               = kingpin.Flag("storage.backend", "Storage backend for the control plane state. Valid values are `memory`, `bolt`, `redis`").Envar("STORAGE_BACKEND").Default(storage.Memory).Enum(storage.Memory, storage.Bolt, storage.Redis)
+	storageBoltPath              = kingpin.Flag("storage.bolt.path", "Path of the database file for the bolt storage backend").Envar("STORAGE_BOLT_PATH").Default("/var/lib/opvic/opvic.db").String()
+	storageRedisAddress          = kingpin.Flag("storage.redis.address", "Address of the Redis server (host:port) for the redis storage backend").Envar("STORAGE_REDIS_ADDRESS").String()
+	storageRedisPassword         = kingpin.Flag("storage.redis.password", "Password of the Redis server").Envar("STORAGE_REDIS_PASSWORD").String()
+	storageRedisDB               = kingpin.Flag("storage.redis.db", "Redis database number").Envar("STORAGE_REDIS_DB").Default("0").Int()
+	storageRedisPrefix           = kingpin.Flag("storage.redis.prefix", "Prefix of the keys stored in Redis").Envar("STORAGE_REDIS_PREFIX").Default(storage.DefaultRedisPrefix).String()
+	notifierWebhookURLs          = kingpin.Flag("notifier.webhook-url", "URL that receives the version transitions as JSON. Can be repeated").Envar("NOTIFIER_WEBHOOK_URLS").Strings()
+	notifierSlackWebhookURLs     = kingpin.Flag("notifier.slack-webhook-url", "Slack incoming webhook URL that receives the version transitions. Can be repeated").Envar("NOTIFIER_SLACK_WEBHOOK_URLS").Strings()
+	notifierTimeout              = kingpin.Flag("notifier.timeout", "Timeout of the notification requests").Envar("NOTIFIER_TIMEOUT").Default("10s").Duration()
+	advisoryDirectory            = kingpin.Flag("advisory.directory", "Directory of OSV JSON files to look up the security advisories of the running versions").Envar("ADVISORY_DIRECTORY").String()
+	advisoryURL                  = kingpin.Flag("advisory.url", "Base URL of an OSV compatible API to look up the security advisories of the running versions (e.g. https://api.osv.dev)").Envar("ADVISORY_URL").String()
 	logLevel                     = kingpin.Flag("log.level", "The verbosity of the logging. Valid values are `debug`, `info`, `warn`, `error`").Envar("LOG_LEVEL").Default("info").String()
 	logHttpRequests              = kingpin.Flag("log.http-requests", "Enable HTTP request logging").Envar("LOG_HTTP_REQUESTS").Default("false").Bool()
+	dashboardEnabled             = kingpin.Flag("dashboard.enabled", "Serve the web dashboard at /").Envar("DASHBOARD_ENABLED").Default("true").Bool()
 )
 
 func main() {
@@ -80,13 +119,82 @@ func main() {
 		AppPrivateKey:     *providerGithubAppPrivateKey,
 	}
 
+	gitlabConf := gitlab.Config{
+		BaseURL: *providerGitlabBaseURL,
+		Token:   *providerGitlabToken,
+	}
+
+	registryConf := registry.Config{
+		Username: *providerRegistryUsername,
+		Password: *providerRegistryPassword,
+	}
+
+	// Register the built-in remote providers
+	providers.Register(github.Name, ghConf.Factory())
+	providers.Register(gitlab.Name, gitlabConf.Factory())
+	providers.Register(helm.Name, helm.Factory())
+	providers.Register(helm.RepoAlias, helm.Factory())
+	providers.Register(registry.Name, registryConf.Factory())
+
+	storageConf := storage.Config{
+		Backend: *storageBackend,
+		Path:    *storageBoltPath,
+		Redis: storage.RedisConfig{
+			Address:  *storageRedisAddress,
+			Password: *storageRedisPassword,
+			DB:       *storageRedisDB,
+			Prefix:   *storageRedisPrefix,
+		},
+	}
+
+	notifierConf := notifier.Config{
+		WebhookURLs:      *notifierWebhookURLs,
+		SlackWebhookURLs: *notifierSlackWebhookURLs,
+		Timeout:          *notifierTimeout,
+	}
+
+	advisoryConf := advisory.Config{
+		Directory: *advisoryDirectory,
+		URL:       *advisoryURL,
+	}
+
+	groupScopes, err := auth.ParseGroupScopes(*jwtGroupScopes)
+	if err != nil {
+		logger.Error(err, "invalid JWT group scopes")
+		os.Exit(1)
+	}
+	jwtConf := auth.JWTConfig{
+		Issuer:          *jwtIssuer,
+		Audience:        *jwtAudience,
+		JWKSURL:         *jwtJWKSURL,
+		JWKSFile:        *jwtJWKSFile,
+		RefreshInterval: *jwtJWKSRefreshInterval,
+		UsernameClaim:   *jwtUsernameClaim,
+		GroupsClaim:     *jwtGroupsClaim,
+		GroupScopes:     groupScopes,
+	}
+
+	tlsConf := tlsconfig.ServerConfig{
+		CertFile:          *tlsCertFile,
+		KeyFile:           *tlsKeyFile,
+		ClientCAFile:      *tlsClientCAFile,
+		RequireClientCert: *tlsRequireClientCert,
+	}
+
 	conf := controlplane.Config{
 		BindAddr:                *controlPlaneBindAddr,
+		TLS:                     &tlsConf,
 		Token:                   controlPlaneAuthToken,
-		GithubConfig:            &ghConf,
+		CredentialsFile:         *credentialsFile,
+		CredentialsReload:       *credentialsReloadInterval,
+		JWT:                     &jwtConf,
 		CacheExpiration:         *cacheExpiration,
+		StorageConfig:           &storageConf,
+		NotifierConfig:          &notifierConf,
+		AdvisoryConfig:          &advisoryConf,
 		CacheReconcilerInterval: *cacheReconcilerInterval,
 		LogHttpRequests:         *logHttpRequests,
+		Dashboard:               *dashboardEnabled,
 		Logger:                  logger.WithName("opvic-control-plane"),
 	}
 	cp, err := conf.NewControlPlane()
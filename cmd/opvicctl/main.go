@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/skillz/opvic/controlplane/client"
+	"github.com/skillz/opvic/utils"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"sigs.k8s.io/yaml"
+
+	api "github.com/skillz/opvic/controlplane/api/v1alpha1"
+)
+
+const (
+	levelMajor = "major"
+	levelMinor = "minor"
+	levelPatch = "patch"
+)
+
+var (
+	configFile            = kingpin.Flag("config", "Path of the config file. Defaults to ~/.opvic/config.yaml").Envar("OPVIC_CONFIG").String()
+	controlPlaneURL       = kingpin.Flag("url", "Control Plane URL").Envar("OPVIC_URL").PlaceHolder("http(s)://CONTROLPLANE-ADDRESS").String()
+	controlPlaneAuthToken = kingpin.Flag("token", "Control Plane Auth Token. Either the shared token, a token of the credentials file or a JWT of the OIDC issuer").Envar("OPVIC_TOKEN").String()
+	insecureSkipTLSVerify = kingpin.Flag("insecure-skip-tls-verify", "Skip the verification of the control plane certificate").Envar("OPVIC_INSECURE_SKIP_TLS_VERIFY").Bool()
+	caFile                = kingpin.Flag("ca-file", "CA bundle to verify the control plane certificate. The system roots are used if empty").Envar("OPVIC_CA_FILE").String()
+	certFile              = kingpin.Flag("cert-file", "Client certificate presented to the control plane").Envar("OPVIC_CERT_FILE").String()
+	keyFile               = kingpin.Flag("key-file", "Key of the client certificate").Envar("OPVIC_KEY_FILE").String()
+	timeout               = kingpin.Flag("timeout", "Timeout of the requests to the control plane").Envar("OPVIC_TIMEOUT").Default("30s").Duration()
+	output                = kingpin.Flag("output", "Output format. Valid values are `table`, `json`, `yaml`").Short('o').Envar("OPVIC_OUTPUT").Default(outputTable).Enum(outputTable, outputJSON, outputYAML)
+
+	agentsCmd        = kingpin.Command("agents", "Query the agents")
+	agentsListCmd    = agentsCmd.Command("list", "List the agents that reported to the control plane")
+	agentsGetCmd     = agentsCmd.Command("get", "List the subjects reported by an agent")
+	agentsGetAgentID = agentsGetCmd.Arg("agent", "Agent identifier").Required().String()
+
+	subjectsCmd          = kingpin.Command("subjects", "Query the subjects")
+	subjectsGetCmd       = subjectsCmd.Command("get", "Show the running and available versions of a subject")
+	subjectsGetAgentID   = subjectsGetCmd.Arg("agent", "Agent identifier").Required().String()
+	subjectsGetSubjectID = subjectsGetCmd.Arg("id", "Subject identifier").Required().String()
+
+	overviewCmd = kingpin.Command("overview", "Show the versions of all the subjects across all agents")
+
+	outdatedCmd   = kingpin.Command("outdated", "Show the subjects running a version with an available upgrade")
+	outdatedLevel = outdatedCmd.Flag("level", "Minimum upgrade level. `major` only shows major upgrades, `minor` shows major and minor upgrades").Default(levelPatch).Enum(levelMajor, levelMinor, levelPatch)
+)
+
+// Config is the content of the config file. The flags and environment variables take precedence.
+type Config struct {
+	URL                   string `json:"url"`
+	Token                 string `json:"token"`
+	InsecureSkipTLSVerify bool   `json:"insecureSkipTLSVerify"`
+	CAFile                string `json:"caFile"`
+	CertFile              string `json:"certFile"`
+	KeyFile               string `json:"keyFile"`
+}
+
+func main() {
+	kingpin.HelpFlag.Short('h')
+	kingpin.Version(fmt.Sprintf("%s\n%s", utils.VersionInfo(), utils.BuildContext()))
+	cmd := kingpin.Parse()
+
+	c, err := newClient()
+	kingpin.FatalIfError(err, "")
+	ctx := context.Background()
+
+	switch cmd {
+	case agentsListCmd.FullCommand():
+		agents, err := c.Agents(ctx)
+		kingpin.FatalIfError(err, "")
+		err = render(agents, agentsTable(agents))
+		kingpin.FatalIfError(err, "")
+	case agentsGetCmd.FullCommand():
+		versions, err := c.Agent(ctx, *agentsGetAgentID)
+		kingpin.FatalIfError(err, "")
+		err = render(versions, subjectVersionsTable(versions))
+		kingpin.FatalIfError(err, "")
+	case subjectsGetCmd.FullCommand():
+		infos, err := c.SubjectVersionInfos(ctx, *subjectsGetAgentID, *subjectsGetSubjectID)
+		kingpin.FatalIfError(err, "")
+		err = render(infos, versionInfoTable(infos))
+		kingpin.FatalIfError(err, "")
+	case overviewCmd.FullCommand():
+		overview, err := c.Overview(ctx)
+		kingpin.FatalIfError(err, "")
+		err = render(overview, versionInfosTable(flatten(overview)))
+		kingpin.FatalIfError(err, "")
+	case outdatedCmd.FullCommand():
+		overview, err := c.Overview(ctx)
+		kingpin.FatalIfError(err, "")
+		outdated := filterOutdated(flatten(overview), *outdatedLevel)
+		err = render(outdated, versionInfosTable(outdated))
+		kingpin.FatalIfError(err, "")
+	}
+}
+
+func newClient() (*client.Client, error) {
+	conf, err := loadConfig(*configFile)
+	if err != nil {
+		return nil, err
+	}
+	if *controlPlaneURL != "" {
+		conf.URL = *controlPlaneURL
+	}
+	if *controlPlaneAuthToken != "" {
+		conf.Token = *controlPlaneAuthToken
+	}
+	if *insecureSkipTLSVerify {
+		conf.InsecureSkipTLSVerify = true
+	}
+	if *caFile != "" {
+		conf.CAFile = *caFile
+	}
+	if *certFile != "" {
+		conf.CertFile = *certFile
+	}
+	if *keyFile != "" {
+		conf.KeyFile = *keyFile
+	}
+	if conf.URL == "" {
+		return nil, errors.New("missing control plane url: use --url, OPVIC_URL or the config file")
+	}
+	return client.New(client.Config{
+		URL:       conf.URL,
+		Token:     conf.Token,
+		TLSVerify: !conf.InsecureSkipTLSVerify,
+		CAFile:    conf.CAFile,
+		CertFile:  conf.CertFile,
+		KeyFile:   conf.KeyFile,
+		Timeout:   *timeout,
+	})
+}
+
+// loadConfig reads the config file. The default config file is optional.
+func loadConfig(path string) (Config, error) {
+	var conf Config
+	optional := path == ""
+	if optional {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return conf, nil
+		}
+		path = filepath.Join(home, ".opvic", "config.yaml")
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if optional && os.IsNotExist(err) {
+			return conf, nil
+		}
+		return conf, err
+	}
+	if err := yaml.UnmarshalStrict(data, &conf); err != nil {
+		return conf, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return conf, nil
+}
+
+// flatten returns the version infos of the overview sorted by subject and agent
+func flatten(overview []api.OverallVersionInfos) []api.VersionInfos {
+	infos := []api.VersionInfos{}
+	for _, subjects := range overview {
+		for _, subjectInfos := range subjects {
+			infos = append(infos, subjectInfos...)
+		}
+	}
+	sort.SliceStable(infos, func(i, j int) bool {
+		if infos[i].ID != infos[j].ID {
+			return infos[i].ID < infos[j].ID
+		}
+		return infos[i].AgentID < infos[j].AgentID
+	})
+	return infos
+}
+
+// filterOutdated returns the version infos with at least one running version that has an upgrade of the given level or higher
+func filterOutdated(infos []api.VersionInfos, level string) []api.VersionInfos {
+	outdated := []api.VersionInfos{}
+	for _, info := range infos {
+		for _, v := range info.Versions {
+			if v.MajorAvailable ||
+				(v.MinorAvailable && level != levelMajor) ||
+				(v.PatchAvailable && level == levelPatch) {
+				outdated = append(outdated, info)
+				break
+			}
+		}
+	}
+	return outdated
+}
+
+// upgrades returns the levels of the available upgrades (e.g. major,patch)
+func upgrades(versions ...api.VersionInfo) string {
+	var major, minor, patch bool
+	for _, v := range versions {
+		major = major || v.MajorAvailable
+		minor = minor || v.MinorAvailable
+		patch = patch || v.PatchAvailable
+	}
+	levels := []string{}
+	if major {
+		levels = append(levels, levelMajor)
+	}
+	if minor {
+		levels = append(levels, levelMinor)
+	}
+	if patch {
+		levels = append(levels, levelPatch)
+	}
+	if len(levels) == 0 {
+		return "-"
+	}
+	return strings.Join(levels, ",")
+}
+
+func formatTags(tags map[string]string) string {
+	if len(tags) == 0 {
+		return "-"
+	}
+	pairs := make([]string, 0, len(tags))
+	for k, v := range tags {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func formatTime(unix int64) string {
+	if unix == 0 {
+		return "-"
+	}
+	return time.Unix(unix, 0).UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"sigs.k8s.io/yaml"
+
+	api "github.com/skillz/opvic/controlplane/api/v1alpha1"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+type table struct {
+	header []string
+	rows   [][]string
+}
+
+// render writes the data in the output format selected with --output
+func render(data interface{}, t table) error {
+	switch *output {
+	case outputJSON:
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(data)
+	case outputYAML:
+		out, err := yaml.Marshal(data)
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(out)
+		return err
+	default:
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(w, strings.Join(t.header, "\t"))
+		for _, row := range t.rows {
+			fmt.Fprintln(w, strings.Join(row, "\t"))
+		}
+		return w.Flush()
+	}
+}
+
+func agentsTable(agents api.Agents) table {
+	t := table{header: []string{"ID", "TAGS", "LAST HEARTBEAT"}}
+	for _, agent := range agents {
+		t.rows = append(t.rows, []string{agent.ID, formatTags(agent.Tags), formatTime(agent.LastHeartbeat)})
+	}
+	return t
+}
+
+func subjectVersionsTable(versions api.SubjectVersions) table {
+	t := table{header: []string{"ID", "NAMESPACE", "RESOURCES", "RUNNING VERSIONS", "PROVIDER", "REPO"}}
+	for _, v := range versions {
+		t.rows = append(t.rows, []string{
+			v.ID,
+			v.NameSpace,
+			strconv.Itoa(v.ResourceCount),
+			strings.Join(v.RunningVersions, ","),
+			v.RemoteVersion.Provider,
+			v.RemoteVersion.Repo,
+		})
+	}
+	return t
+}
+
+func versionInfoTable(infos api.VersionInfos) table {
+	t := table{header: []string{"VERSION", "KIND", "CONTAINER", "RESOURCES", "LATEST", "UPGRADES", "DAYS BEHIND", "SUPPORT", "ADVISORIES"}}
+	for _, v := range infos.Versions {
+		support := v.SupportStatus
+		if support == "" {
+			support = "-"
+		} else if v.EOLDate != "" {
+			support = fmt.Sprintf("%s (%s)", support, v.EOLDate)
+		}
+		container := v.ContainerName
+		if container == "" {
+			container = "-"
+		}
+		advisories := "-"
+		if v.Advisories != nil {
+			advisories = strconv.Itoa(len(v.Advisories))
+		}
+		t.rows = append(t.rows, []string{
+			v.RunningVersion,
+			v.ResourceKind,
+			container,
+			strconv.Itoa(v.ResourceCount),
+			v.LatestVersion,
+			upgrades(v),
+			strconv.Itoa(v.DaysBehindLatest),
+			support,
+			advisories,
+		})
+	}
+	return t
+}
+
+func versionInfosTable(infos []api.VersionInfos) table {
+	t := table{header: []string{"SUBJECT", "AGENT", "RESOURCES", "RUNNING VERSIONS", "LATEST", "UPGRADES", "DAYS BEHIND"}}
+	for _, info := range infos {
+		t.rows = append(t.rows, []string{
+			info.ID,
+			info.AgentID,
+			strconv.Itoa(info.ResourceCount),
+			strings.Join(info.RunningVersions, ","),
+			info.LatestVersion,
+			upgrades(info.Versions...),
+			strconv.Itoa(info.DaysBehindLatest),
+		})
+	}
+	return t
+}
@@ -0,0 +1,236 @@
+package advisory
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/hashicorp/go-version"
+	api "github.com/skillz/opvic/controlplane/api/v1alpha1"
+	"github.com/skillz/opvic/controlplane/storage"
+	"github.com/skillz/opvic/utils"
+)
+
+// Result holds the advisories of a running version
+type Result struct {
+	Advisories []api.Advisory
+	// Versions greater than the running version that fix at least one of the advisories
+	FixedIn []string
+}
+
+// Source finds the vulnerabilities that affect a version of a package
+type Source interface {
+	Query(ecosystem, name, version string) ([]Vulnerability, error)
+}
+
+// Config contains the configuration of the advisory source
+type Config struct {
+	// Directory of OSV JSON files
+	Directory string
+	// Base URL of an OSV compatible API (e.g. https://api.osv.dev)
+	URL     string
+	Timeout time.Duration
+	Logger  logr.Logger
+}
+
+// NewSource creates the configured source. It returns nil if no source is configured
+func (c *Config) NewSource(store storage.Store) (Source, error) {
+	switch {
+	case c.Directory != "" && c.URL != "":
+		return nil, fmt.Errorf("only one of the advisory directory or url can be set")
+	case c.Directory != "":
+		source, err := NewDirectorySource(c.Directory, c.Logger)
+		if err != nil {
+			return nil, err
+		}
+		return source, nil
+	case c.URL != "":
+		timeout := c.Timeout
+		if timeout == 0 {
+			timeout = 30 * time.Second
+		}
+		return NewHTTPSource(c.URL, &http.Client{Timeout: timeout}, store), nil
+	default:
+		return nil, nil
+	}
+}
+
+// Lookup returns the advisories of the running version of the package and the versions that fix them
+func Lookup(source Source, ecosystem, name, running string) (Result, error) {
+	result := Result{Advisories: []api.Advisory{}, FixedIn: []string{}}
+	ver, err := version.NewVersion(running)
+	if err != nil {
+		return result, err
+	}
+	vulns, err := source.Query(ecosystem, name, running)
+	if err != nil {
+		return result, err
+	}
+	for _, v := range vulns {
+		result.Advisories = append(result.Advisories, api.Advisory{
+			ID:      v.ID,
+			Summary: v.Summary,
+			Aliases: v.Aliases,
+		})
+		for _, fixed := range v.fixedIn(ecosystem, name, ver) {
+			if !utils.Contains(result.FixedIn, fixed) {
+				result.FixedIn = append(result.FixedIn, fixed)
+			}
+		}
+	}
+	sort.Slice(result.Advisories, func(i, j int) bool {
+		return result.Advisories[i].ID < result.Advisories[j].ID
+	})
+	sort.Slice(result.FixedIn, func(i, j int) bool {
+		a, _ := version.NewVersion(result.FixedIn[i])
+		b, _ := version.NewVersion(result.FixedIn[j])
+		return a.LessThan(b)
+	})
+	return result, nil
+}
+
+// DirectorySource matches the versions against the OSV files of a local directory
+type DirectorySource struct {
+	// vulnerabilities by ecosystem/name
+	vulns map[string][]Vulnerability
+}
+
+func packageKey(ecosystem, name string) string {
+	return fmt.Sprintf("%s/%s", ecosystem, name)
+}
+
+// NewDirectorySource loads all the .json files of the directory and its sub directories
+func NewDirectorySource(dir string, logger logr.Logger) (*DirectorySource, error) {
+	s := &DirectorySource{vulns: map[string][]Vulnerability{}}
+	count := 0
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !strings.HasSuffix(info.Name(), ".json") {
+			return nil
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var v Vulnerability
+		if err := json.Unmarshal(data, &v); err != nil {
+			return fmt.Errorf("failed to parse %s: %v", path, err)
+		}
+		added := map[string]bool{}
+		for _, a := range v.Affected {
+			key := packageKey(a.Package.Ecosystem, a.Package.Name)
+			if !added[key] {
+				s.vulns[key] = append(s.vulns[key], v)
+				added[key] = true
+			}
+		}
+		count++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	logger.WithName("advisory").Info("loaded advisories", "directory", dir, "count", count)
+	return s, nil
+}
+
+func (s *DirectorySource) Query(ecosystem, name, ver string) ([]Vulnerability, error) {
+	parsed, err := version.NewVersion(ver)
+	if err != nil {
+		return nil, err
+	}
+	var vulns []Vulnerability
+	for _, v := range s.vulns[packageKey(ecosystem, name)] {
+		if v.affects(ecosystem, name, parsed) {
+			vulns = append(vulns, v)
+		}
+	}
+	return vulns, nil
+}
+
+// HTTPSource queries an OSV compatible API. The responses are cached in the store
+type HTTPSource struct {
+	url    string
+	client *http.Client
+	store  storage.Store
+}
+
+type osvQuery struct {
+	Version   string  `json:"version"`
+	Package   Package `json:"package"`
+	PageToken string  `json:"page_token,omitempty"`
+}
+
+type osvResponse struct {
+	Vulns         []Vulnerability `json:"vulns"`
+	NextPageToken string          `json:"next_page_token"`
+}
+
+func NewHTTPSource(url string, client *http.Client, store storage.Store) *HTTPSource {
+	return &HTTPSource{
+		url:    strings.TrimSuffix(url, "/"),
+		client: client,
+		store:  store,
+	}
+}
+
+func cacheKey(ecosystem, name, ver string) string {
+	return fmt.Sprintf("advisory/%s/%s/%s", ecosystem, name, ver)
+}
+
+func (s *HTTPSource) Query(ecosystem, name, ver string) ([]Vulnerability, error) {
+	var vulns []Vulnerability
+	if found, err := s.store.Get(cacheKey(ecosystem, name, ver), &vulns); err == nil && found {
+		return vulns, nil
+	}
+	query := osvQuery{
+		Version: ver,
+		Package: Package{Ecosystem: ecosystem, Name: name},
+	}
+	vulns = []Vulnerability{}
+	for {
+		r, err := s.query(query)
+		if err != nil {
+			return nil, err
+		}
+		vulns = append(vulns, r.Vulns...)
+		if r.NextPageToken == "" {
+			break
+		}
+		query.PageToken = r.NextPageToken
+	}
+	if err := s.store.Set(cacheKey(ecosystem, name, ver), vulns); err != nil {
+		return nil, err
+	}
+	return vulns, nil
+}
+
+func (s *HTTPSource) query(query osvQuery) (*osvResponse, error) {
+	body, err := json.Marshal(query)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Post(s.url+"/v1/query", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d from %s", resp.StatusCode, s.url)
+	}
+	r := &osvResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
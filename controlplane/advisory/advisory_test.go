@@ -0,0 +1,224 @@
+package advisory
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/hashicorp/go-version"
+	"github.com/skillz/opvic/controlplane/storage"
+)
+
+const (
+	testEcosystem = "Go"
+	testPackage   = "github.com/coredns/coredns"
+)
+
+var testVulns = []Vulnerability{
+	{
+		ID:      "GHSA-0001",
+		Summary: "fixed in a patch",
+		Aliases: []string{"CVE-2021-0001"},
+		Affected: []Affected{{
+			Package: Package{Ecosystem: testEcosystem, Name: testPackage},
+			Ranges: []Range{{
+				Type:   RangeSemver,
+				Events: []Event{{Introduced: "0"}, {Fixed: "1.7.1"}},
+			}},
+		}},
+	},
+	{
+		ID: "GHSA-0002",
+		Affected: []Affected{{
+			Package: Package{Ecosystem: testEcosystem, Name: testPackage},
+			Ranges: []Range{{
+				Type:   RangeEcosystem,
+				Events: []Event{{Introduced: "1.6.0"}, {Fixed: "1.6.5"}, {Introduced: "1.7.0"}, {Fixed: "1.8.1"}},
+			}},
+		}},
+	},
+	{
+		ID: "GHSA-0003",
+		Affected: []Affected{{
+			Package: Package{Ecosystem: testEcosystem, Name: testPackage},
+			Ranges: []Range{{
+				Type:   RangeSemver,
+				Events: []Event{{Introduced: "1.8.0"}, {LastAffected: "1.8.3"}},
+			}},
+			Versions: []string{"1.5.0"},
+		}},
+	},
+	{
+		ID: "GHSA-0004",
+		Affected: []Affected{{
+			Package: Package{Ecosystem: "npm", Name: "coredns"},
+			Ranges: []Range{{
+				Type:   RangeSemver,
+				Events: []Event{{Introduced: "0"}},
+			}},
+		}},
+	},
+}
+
+func writeTestDirectory(t *testing.T) string {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "go"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range testVulns {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, "go", v.ID+".json"), data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// files that are not json are ignored
+	if err := ioutil.WriteFile(filepath.Join(dir, "README.md"), []byte("# osv"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestRangeAffects(t *testing.T) {
+	tests := []struct {
+		name    string
+		events  []Event
+		version string
+		want    bool
+	}{
+		{name: "introduced_zero", events: []Event{{Introduced: "0"}, {Fixed: "1.0.0"}}, version: "0.9.0", want: true},
+		{name: "fixed", events: []Event{{Introduced: "0"}, {Fixed: "1.0.0"}}, version: "1.0.0", want: false},
+		{name: "before_introduced", events: []Event{{Introduced: "1.0.0"}}, version: "0.9.0", want: false},
+		{name: "open_range", events: []Event{{Introduced: "1.0.0"}}, version: "9.0.0", want: true},
+		{name: "between_intervals", events: []Event{{Introduced: "1.0.0"}, {Fixed: "1.1.0"}, {Introduced: "2.0.0"}, {Fixed: "2.1.0"}}, version: "1.5.0", want: false},
+		{name: "second_interval", events: []Event{{Fixed: "2.1.0"}, {Introduced: "2.0.0"}, {Introduced: "1.0.0"}, {Fixed: "1.1.0"}}, version: "2.0.5", want: true},
+		{name: "last_affected", events: []Event{{Introduced: "1.0.0"}, {LastAffected: "1.2.0"}}, version: "1.2.0", want: true},
+		{name: "after_last_affected", events: []Event{{Introduced: "1.0.0"}, {LastAffected: "1.2.0"}}, version: "1.2.1", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := Range{Type: RangeSemver, Events: tt.events}
+			if got := r.affects(version.Must(version.NewVersion(tt.version))); got != tt.want {
+				t.Errorf("affects() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLookupDirectorySource(t *testing.T) {
+	source, err := NewDirectorySource(writeTestDirectory(t), logr.Discard())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		running    string
+		advisories []string
+		fixedIn    []string
+	}{
+		{running: "1.5.0", advisories: []string{"GHSA-0001", "GHSA-0003"}, fixedIn: []string{"1.7.1"}},
+		{running: "1.6.2", advisories: []string{"GHSA-0001", "GHSA-0002"}, fixedIn: []string{"1.6.5", "1.7.1", "1.8.1"}},
+		{running: "1.7.0", advisories: []string{"GHSA-0001", "GHSA-0002"}, fixedIn: []string{"1.7.1", "1.8.1"}},
+		{running: "1.8.2", advisories: []string{"GHSA-0003"}, fixedIn: []string{}},
+		{running: "1.9.0", advisories: []string{}, fixedIn: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.running, func(t *testing.T) {
+			result, err := Lookup(source, testEcosystem, testPackage, tt.running)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids := []string{}
+			for _, a := range result.Advisories {
+				ids = append(ids, a.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.advisories) {
+				t.Errorf("Advisories = %v, want %v", ids, tt.advisories)
+			}
+			if !reflect.DeepEqual(result.FixedIn, tt.fixedIn) {
+				t.Errorf("FixedIn = %v, want %v", result.FixedIn, tt.fixedIn)
+			}
+		})
+	}
+}
+
+func TestLookupHTTPSource(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/query" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		requests++
+		var q osvQuery
+		if err := json.NewDecoder(r.Body).Decode(&q); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		resp := osvResponse{Vulns: []Vulnerability{}}
+		ver := version.Must(version.NewVersion(q.Version))
+		for _, v := range testVulns {
+			if v.affects(q.Package.Ecosystem, q.Package.Name, ver) {
+				resp.Vulns = append(resp.Vulns, v)
+			}
+		}
+		// return one vulnerability per page
+		if q.PageToken == "" && len(resp.Vulns) > 1 {
+			resp.Vulns = resp.Vulns[:1]
+			resp.NextPageToken = "next"
+		} else if q.PageToken != "" {
+			resp.Vulns = resp.Vulns[1:]
+		}
+		json.NewEncoder(w).Encode(resp) // nolint: errcheck
+	}))
+	defer server.Close()
+
+	source := NewHTTPSource(server.URL+"/", server.Client(), storage.NewMemoryStore(0))
+	for i := 0; i < 2; i++ {
+		result, err := Lookup(source, testEcosystem, testPackage, "1.7.0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Advisories) != 2 || !reflect.DeepEqual(result.FixedIn, []string{"1.7.1", "1.8.1"}) {
+			t.Errorf("Lookup() = %+v", result)
+		}
+	}
+	// the second lookup is served from the cache
+	if requests != 2 {
+		t.Errorf("got %d requests, want 2", requests)
+	}
+}
+
+func TestConfigNewSource(t *testing.T) {
+	tests := []struct {
+		name    string
+		conf    Config
+		wantNil bool
+		wantErr bool
+	}{
+		{name: "disabled", conf: Config{}, wantNil: true},
+		{name: "directory", conf: Config{Directory: writeTestDirectory(t)}},
+		{name: "url", conf: Config{URL: "https://api.osv.dev"}},
+		{name: "both", conf: Config{Directory: "/tmp", URL: "https://api.osv.dev"}, wantErr: true},
+		{name: "missing_directory", conf: Config{Directory: filepath.Join(t.TempDir(), "missing")}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.conf.Logger = logr.Discard()
+			source, err := tt.conf.NewSource(storage.NewMemoryStore(0))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewSource() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (source == nil) != tt.wantNil {
+				t.Errorf("NewSource() = %v, wantNil %v", source, tt.wantNil)
+			}
+		})
+	}
+}
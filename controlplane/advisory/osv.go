@@ -0,0 +1,138 @@
+package advisory
+
+import (
+	"sort"
+
+	"github.com/hashicorp/go-version"
+)
+
+// OSV range types. GIT ranges are ignored since they can't be compared with the running versions
+const (
+	RangeSemver    = "SEMVER"
+	RangeEcosystem = "ECOSYSTEM"
+)
+
+// Vulnerability is an entry of an OSV database. See https://ossf.github.io/osv-schema/
+type Vulnerability struct {
+	ID       string     `json:"id"`
+	Summary  string     `json:"summary,omitempty"`
+	Aliases  []string   `json:"aliases,omitempty"`
+	Affected []Affected `json:"affected"`
+}
+
+type Affected struct {
+	Package  Package  `json:"package"`
+	Ranges   []Range  `json:"ranges,omitempty"`
+	Versions []string `json:"versions,omitempty"`
+}
+
+type Package struct {
+	Ecosystem string `json:"ecosystem"`
+	Name      string `json:"name"`
+}
+
+type Range struct {
+	Type   string  `json:"type"`
+	Events []Event `json:"events"`
+}
+
+// Event is a version where a vulnerability is introduced, fixed or last affected in a range
+type Event struct {
+	Introduced   string `json:"introduced,omitempty"`
+	Fixed        string `json:"fixed,omitempty"`
+	LastAffected string `json:"last_affected,omitempty"`
+}
+
+// affects returns true if the version of the package is affected by the vulnerability
+func (v *Vulnerability) affects(ecosystem, name string, ver *version.Version) bool {
+	for _, a := range v.Affected {
+		if a.Package.Ecosystem != ecosystem || a.Package.Name != name {
+			continue
+		}
+		if a.affects(ver) {
+			return true
+		}
+	}
+	return false
+}
+
+// fixedIn returns the versions greater than ver that fix the vulnerability
+func (v *Vulnerability) fixedIn(ecosystem, name string, ver *version.Version) []string {
+	var fixed []string
+	for _, a := range v.Affected {
+		if a.Package.Ecosystem != ecosystem || a.Package.Name != name {
+			continue
+		}
+		for _, r := range a.Ranges {
+			for _, e := range r.Events {
+				if e.Fixed == "" {
+					continue
+				}
+				if f, err := version.NewVersion(e.Fixed); err == nil && f.GreaterThan(ver) {
+					fixed = append(fixed, e.Fixed)
+				}
+			}
+		}
+	}
+	return fixed
+}
+
+func (a *Affected) affects(ver *version.Version) bool {
+	for _, v := range a.Versions {
+		if parsed, err := version.NewVersion(v); err == nil && parsed.Equal(ver) {
+			return true
+		}
+	}
+	for _, r := range a.Ranges {
+		if (r.Type == RangeSemver || r.Type == RangeEcosystem) && r.affects(ver) {
+			return true
+		}
+	}
+	return false
+}
+
+// affects evaluates the events of the range. The version is affected if it is in [introduced, fixed)
+// or [introduced, last_affected] of any of the intervals of the range
+func (r *Range) affects(ver *version.Version) bool {
+	type point struct {
+		version *version.Version
+		event   Event
+	}
+	var points []point
+	for _, e := range r.Events {
+		raw := e.Introduced + e.Fixed + e.LastAffected
+		// introduced 0 is the start of the version history
+		if e.Introduced == "0" {
+			raw = "0.0.0"
+		}
+		v, err := version.NewVersion(raw)
+		if err != nil {
+			continue
+		}
+		points = append(points, point{version: v, event: e})
+	}
+	sort.SliceStable(points, func(i, j int) bool {
+		return points[i].version.LessThan(points[j].version)
+	})
+	affected := false
+	for _, p := range points {
+		switch {
+		case p.event.Introduced != "":
+			if ver.LessThan(p.version) {
+				return affected
+			}
+			affected = true
+		case p.event.Fixed != "":
+			if ver.LessThan(p.version) {
+				return affected
+			}
+			affected = false
+		case p.event.LastAffected != "":
+			if !ver.GreaterThan(p.version) {
+				return affected
+			}
+			affected = false
+		}
+	}
+	return affected
+}
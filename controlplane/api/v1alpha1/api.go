@@ -14,22 +14,26 @@ const (
 	PingAPIPath = "/ping"
 
 	// Agent endpoints
-	AgentsAPIPath                = "/agents"
-	AgentAPIPath                 = "/agents/:id"
-	AgentsSubjectVersionPath     = "/agents/:id/:versionId"
-	AgentsSubjectVersionInfoPath = "/agents/:id/:versionId/versions"
+	AgentsAPIPath                   = "/agents"
+	AgentAPIPath                    = "/agents/:id"
+	AgentBatchAPIPath               = "/agents/:id/batch"
+	AgentsSubjectVersionPath        = "/agents/:id/:versionId"
+	AgentsSubjectVersionInfoPath    = "/agents/:id/:versionId/versions"
+	AgentsSubjectVersionHistoryPath = "/agents/:id/:versionId/history"
 
 	// Control Plane endpoints
 	OverviewAPIPath = "/overview"
 )
 
 var (
-	APIGroup                         = fmt.Sprintf("/api/%s", APIVersion)
-	PingAPIEndpoint                  = GetAPIEndpoint(PingAPIPath)
-	AgentsAPIEndpoint                = GetAPIEndpoint(AgentsAPIPath)
-	AgentAPIEndpoint                 = GetAPIEndpoint(AgentAPIPath)
-	AgentsSubjectVersionEndpoint     = GetAPIEndpoint(AgentsSubjectVersionPath)
-	AgentsSubjectVersionInfoEndpoint = GetAPIEndpoint(AgentsSubjectVersionInfoPath)
+	APIGroup                            = fmt.Sprintf("/api/%s", APIVersion)
+	PingAPIEndpoint                     = GetAPIEndpoint(PingAPIPath)
+	AgentsAPIEndpoint                   = GetAPIEndpoint(AgentsAPIPath)
+	AgentAPIEndpoint                    = GetAPIEndpoint(AgentAPIPath)
+	AgentBatchAPIEndpoint               = GetAPIEndpoint(AgentBatchAPIPath)
+	AgentsSubjectVersionEndpoint        = GetAPIEndpoint(AgentsSubjectVersionPath)
+	AgentsSubjectVersionInfoEndpoint    = GetAPIEndpoint(AgentsSubjectVersionInfoPath)
+	AgentsSubjectVersionHistoryEndpoint = GetAPIEndpoint(AgentsSubjectVersionHistoryPath)
 )
 
 // gets the end point in `/<path>` format and returns (/api/<version>/<endpoint>)
@@ -65,6 +69,18 @@ type AgentPayload struct {
 	Version SubjectVersion `json:"version" binding:"required"`
 }
 
+// Payload for the /agents/:id/batch endpoint
+type AgentBatchPayload struct {
+	// Tags associated with the agent
+	AgentTags map[string]string `json:"agentTags"`
+	// Version information collected by the agent since the last batch
+	Versions []SubjectVersion `json:"versions" binding:"dive"`
+	// Identifiers of all the subjects tracked by the agent.
+	// The subjects of the agent that are missing from the list and from versions are removed.
+	// If not set, no subject is removed
+	Subjects []string `json:"subjects"`
+}
+
 // SubjectVersion contains all versions collected for a subject
 type SubjectVersion struct {
 	// Identifier of the subject
@@ -94,6 +110,8 @@ type Version struct {
 	ResourceKind string `json:"resourceKind"`
 	// Field value that version is extracted from
 	ExtractedFrom string `json:"extractedFrom"`
+	// Name of the container that version is extracted from when the agent selects the containers of the pods
+	ContainerName string `json:"containerName,omitempty"`
 }
 
 // VersionInfo contains information the running and remote versions of a subject
@@ -106,6 +124,8 @@ type VersionInfo struct {
 	ResourceKind string `json:"resourceKind"`
 	// Field value that the version is extracted from
 	ExtractedFrom string `json:"extractedFrom"`
+	// Name of the container that the version is extracted from
+	ContainerName string `json:"containerName,omitempty"`
 	// Latest version of the remote version
 	LatestVersion string `json:"latestVersion"`
 	// List of all available versions above the running version
@@ -122,6 +142,28 @@ type VersionInfo struct {
 	MinorAvailable bool `json:"minorAvailable"`
 	// Boolean indicating if a newer patch version is available
 	PatchAvailable bool `json:"patchAvailable"`
+	// Number of days since the first newer remote version appeared. Zero if the running version is the latest
+	DaysBehindLatest int `json:"daysBehindLatest"`
+	// Known security advisories of the running version. Null if no advisory package is configured for the subject
+	Advisories []Advisory `json:"advisories"`
+	// Versions greater than the running version that fix at least one of the advisories
+	FixedIn []string `json:"fixedIn,omitempty"`
+	// Support status of the release cycle of the running version (supported, nearingEOL, eol or unknown)
+	SupportStatus string `json:"supportStatus,omitempty"`
+	// End of life date of the release cycle in YYYY-MM-DD format
+	EOLDate string `json:"eolDate,omitempty"`
+	// Days until the end of life date of the release cycle. Negative once the date has passed
+	EOLDays *int `json:"eolDays,omitempty"`
+}
+
+// Advisory is a known vulnerability of a running version
+type Advisory struct {
+	// Identifier of the advisory in the database (e.g. GHSA-xxxx-xxxx-xxxx)
+	ID string `json:"id"`
+	// Short description of the vulnerability
+	Summary string `json:"summary,omitempty"`
+	// Other identifiers of the vulnerability (e.g. CVE-2021-1234)
+	Aliases []string `json:"aliases,omitempty"`
 }
 
 // VersionInfos holds all the information on a subject version
@@ -140,6 +182,8 @@ type VersionInfos struct {
 	RemoteProvider string `json:"remoteProvider"`
 	// Remote repository or extracting remote versions
 	RemoteRepo string `json:"remoteRepo"`
+	// Highest number of days behind the latest version of all the running versions
+	DaysBehindLatest int `json:"daysBehindLatest"`
 	// List of all VersionInfos collected for the subject
 	Versions []VersionInfo `json:"versions"`
 }
@@ -157,3 +201,43 @@ func (a *AgentVersionInfos) VersionIDList() []string {
 
 // OverallVersionInfos has unique version information from all agentss
 type OverallVersionInfos map[string][]VersionInfos
+
+// HistoryEntry is a period of time where a subject was running the same set of versions
+type HistoryEntry struct {
+	// Sorted list of running versions during the period
+	RunningVersions []string `json:"runningVersions"`
+	// Unix time of the first payload reporting the running versions
+	FirstSeen int64 `json:"firstSeen"`
+	// Unix time of the last payload reporting the running versions
+	LastSeen int64 `json:"lastSeen"`
+}
+
+// SubjectVersionHistory holds the changes of the running versions of a subject reported by an agent
+type SubjectVersionHistory struct {
+	// Identifier of the subject
+	ID string `json:"id"`
+	// Agent that reported the versions
+	AgentID string `json:"agentId"`
+	// Entries ordered from the oldest to the newest
+	History []HistoryEntry `json:"history"`
+}
+
+// Between returns a copy of the history with the entries that overlap the [from, to] unix time range.
+// A zero from or to leaves that side of the range open.
+func (h SubjectVersionHistory) Between(from, to int64) SubjectVersionHistory {
+	filtered := SubjectVersionHistory{
+		ID:      h.ID,
+		AgentID: h.AgentID,
+		History: []HistoryEntry{},
+	}
+	for _, entry := range h.History {
+		if from != 0 && entry.LastSeen < from {
+			continue
+		}
+		if to != 0 && entry.FirstSeen > to {
+			continue
+		}
+		filtered.History = append(filtered.History, entry)
+	}
+	return filtered
+}
@@ -0,0 +1,293 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// ScopeRead allows reading the agents, the subject versions and the overview
+	ScopeRead = "read"
+	// ScopeWrite allows writing the subject versions of any agent
+	ScopeWrite = "write"
+
+	// SharedIdentity is the name of the identity of the shared auth token
+	SharedIdentity = "shared"
+
+	DefaultReloadInterval = 30 * time.Second
+)
+
+// AgentWriteScope is the scope that allows writing the subject versions of a single agent
+func AgentWriteScope(agentID string) string {
+	return fmt.Sprintf("agent:%s:write", agentID)
+}
+
+// Identity is the caller of the API
+type Identity struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+// HasScope returns true if the identity was granted the scope
+func (i *Identity) HasScope(scope string) bool {
+	for _, s := range i.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// CanRead returns true if the identity can read the state of the control plane
+func (i *Identity) CanRead() bool {
+	return i.HasScope(ScopeRead)
+}
+
+// CanWriteAgent returns true if the identity can write the subject versions of the agent
+func (i *Identity) CanWriteAgent(agentID string) bool {
+	return i.HasScope(ScopeWrite) || i.HasScope(AgentWriteScope(agentID))
+}
+
+// Credential maps a token to an identity
+type Credential struct {
+	Identity `json:",inline"`
+	Token    string `json:"token"`
+}
+
+// File is the format of the credentials file
+//
+//	tokens:
+//	  - name: prod-agent
+//	    token: "..."
+//	    scopes: ["agent:prod:write"]
+//	  - name: dashboard
+//	    token: "..."
+//	    scopes: ["read"]
+type File struct {
+	Tokens []Credential `json:"tokens"`
+}
+
+// Config contains the configuration of the credential store
+type Config struct {
+	// Shared token with full access (read and write for all the agents)
+	SharedToken string
+	// YAML or JSON credentials file. A mounted Kubernetes Secret is updated in place by the kubelet
+	// and picked up on the next reload
+	File string
+	// Interval between two checks of the credentials file
+	ReloadInterval time.Duration
+	// JWTs of an OIDC issuer accepted alongside the static tokens
+	JWT *JWTConfig
+	// The clients authenticate with a certificate signed by the client CA of the TLS config, so no token is required
+	ClientCertificates bool
+	Logger             logr.Logger
+}
+
+// Store authenticates the tokens against the shared token, the credentials file and the JWT issuer
+type Store struct {
+	path           string
+	jwt            *JWTVerifier
+	reloadInterval time.Duration
+	shared         *Credential
+	credentials    map[string]*Identity
+	checksum       [sha256.Size]byte
+	loaded         bool
+	mutex          sync.RWMutex
+	log            logr.Logger
+}
+
+func (c *Config) NewStore() (*Store, error) {
+	if c.SharedToken == "" && c.File == "" && !c.JWT.Enabled() && !c.ClientCertificates {
+		return nil, fmt.Errorf("a shared auth token, a credentials file, a JWT issuer or a client CA is required")
+	}
+	interval := c.ReloadInterval
+	if interval == 0 {
+		interval = DefaultReloadInterval
+	}
+	s := &Store{
+		path:           c.File,
+		reloadInterval: interval,
+		credentials:    map[string]*Identity{},
+		log:            c.Logger,
+	}
+	if c.SharedToken != "" {
+		s.shared = &Credential{
+			Identity: Identity{Name: SharedIdentity, Scopes: []string{ScopeRead, ScopeWrite}},
+			Token:    c.SharedToken,
+		}
+	}
+	if _, err := s.Reload(); err != nil {
+		return nil, err
+	}
+	if c.JWT.Enabled() {
+		if c.JWT.Logger == nil {
+			c.JWT.Logger = c.Logger
+		}
+		verifier, err := c.JWT.NewVerifier()
+		if err != nil {
+			return nil, err
+		}
+		s.jwt = verifier
+	}
+	return s, nil
+}
+
+// Authenticate returns the identity of a static token or a JWT
+func (s *Store) Authenticate(token string) (*Identity, bool) {
+	if token == "" {
+		return nil, false
+	}
+	s.mutex.RLock()
+	identity, found := s.credentials[token]
+	s.mutex.RUnlock()
+	if found || s.jwt == nil || !isJWT(token) {
+		return identity, found
+	}
+	identity, err := s.jwt.Verify(token)
+	if err != nil {
+		s.log.V(1).Info("rejected the JWT", "reason", err.Error())
+		return nil, false
+	}
+	return identity, true
+}
+
+// Reload reads the credentials file again. It returns true if the credentials changed.
+// The current credentials are kept if the file is invalid
+func (s *Store) Reload() (bool, error) {
+	var data []byte
+	if s.path != "" {
+		var err error
+		data, err = ioutil.ReadFile(s.path)
+		if err != nil {
+			return false, fmt.Errorf("failed to read the credentials file: %w", err)
+		}
+	}
+	checksum := sha256.Sum256(data)
+	s.mutex.RLock()
+	unchanged := s.loaded && checksum == s.checksum
+	s.mutex.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+	credentials, err := parse(data)
+	if err != nil {
+		return false, fmt.Errorf("invalid credentials file %s: %w", s.path, err)
+	}
+	if s.shared != nil {
+		if _, found := credentials[s.shared.Token]; found {
+			return false, fmt.Errorf("invalid credentials file %s: the shared token can't be reused", s.path)
+		}
+		credentials[s.shared.Token] = &s.shared.Identity
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.credentials = credentials
+	s.checksum = checksum
+	s.loaded = true
+	return true, nil
+}
+
+// Watch reloads the credentials file and the JWKS periodically until the context is done
+func (s *Store) Watch(ctx context.Context) {
+	if s.jwt != nil {
+		go s.jwt.Watch(ctx)
+	}
+	if s.path == "" {
+		return
+	}
+	ticker := time.NewTicker(s.reloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			changed, err := s.Reload()
+			if err != nil {
+				s.log.Error(err, "failed to reload the credentials, keeping the current ones")
+				continue
+			}
+			if changed {
+				s.log.Info("reloaded the credentials", "file", s.path, "identities", s.Len())
+			}
+		}
+	}
+}
+
+// Len returns the number of known tokens
+func (s *Store) Len() int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return len(s.credentials)
+}
+
+func parse(data []byte) (map[string]*Identity, error) {
+	credentials := map[string]*Identity{}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return credentials, nil
+	}
+	var file File
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, err
+	}
+	names := map[string]bool{}
+	for i := range file.Tokens {
+		cred := file.Tokens[i]
+		switch {
+		case cred.Name == "":
+			return nil, fmt.Errorf("tokens[%d]: missing name", i)
+		case cred.Token == "":
+			return nil, fmt.Errorf("tokens[%d] (%s): missing token", i, cred.Name)
+		case len(cred.Scopes) == 0:
+			return nil, fmt.Errorf("tokens[%d] (%s): missing scopes", i, cred.Name)
+		case names[cred.Name]:
+			return nil, fmt.Errorf("tokens[%d] (%s): duplicate name", i, cred.Name)
+		}
+		if _, found := credentials[cred.Token]; found {
+			return nil, fmt.Errorf("tokens[%d] (%s): duplicate token", i, cred.Name)
+		}
+		for _, scope := range cred.Scopes {
+			if err := validateScope(scope); err != nil {
+				return nil, fmt.Errorf("tokens[%d] (%s): %w", i, cred.Name, err)
+			}
+		}
+		names[cred.Name] = true
+		identity := cred.Identity
+		credentials[cred.Token] = &identity
+	}
+	return credentials, nil
+}
+
+func validateScope(scope string) error {
+	if scope == ScopeRead || scope == ScopeWrite {
+		return nil
+	}
+	parts := strings.Split(scope, ":")
+	if len(parts) == 3 && parts[0] == "agent" && parts[1] != "" && parts[2] == "write" {
+		return nil
+	}
+	return fmt.Errorf("invalid scope %q: must be %s, %s or %s", scope, ScopeRead, ScopeWrite, AgentWriteScope("<id>"))
+}
+
+// CertificateIdentity returns the identity of an agent authenticated with a verified client certificate.
+// The agent ID is the common name of the certificate, or its first DNS name when the common name is empty
+func CertificateIdentity(cert *x509.Certificate) (*Identity, bool) {
+	agentID := cert.Subject.CommonName
+	if agentID == "" && len(cert.DNSNames) > 0 {
+		agentID = cert.DNSNames[0]
+	}
+	if agentID == "" || strings.Contains(agentID, ":") {
+		return nil, false
+	}
+	return &Identity{Name: agentID, Scopes: []string{AgentWriteScope(agentID)}}, true
+}
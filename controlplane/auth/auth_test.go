@@ -0,0 +1,173 @@
+package auth
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-logr/logr"
+)
+
+const testCredentials = `
+tokens:
+  - name: prod-agent
+    token: prod-token
+    scopes: ["agent:prod:write"]
+  - name: dashboard
+    token: dashboard-token
+    scopes: ["read"]
+`
+
+func writeFile(t *testing.T, path, data string) {
+	if err := ioutil.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.yaml")
+	writeFile(t, path, testCredentials)
+	conf := Config{SharedToken: "shared-token", File: path, Logger: logr.Discard()}
+	s, err := conf.NewStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		token     string
+		wantName  string
+		canRead   bool
+		canWrite  []string
+		cantWrite []string
+	}{
+		{token: "shared-token", wantName: SharedIdentity, canRead: true, canWrite: []string{"prod", "dev"}},
+		{token: "prod-token", wantName: "prod-agent", canWrite: []string{"prod"}, cantWrite: []string{"dev"}},
+		{token: "dashboard-token", wantName: "dashboard", canRead: true, cantWrite: []string{"prod"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.wantName, func(t *testing.T) {
+			identity, found := s.Authenticate(tt.token)
+			if !found {
+				t.Fatalf("Authenticate(%q) not found", tt.token)
+			}
+			if identity.Name != tt.wantName {
+				t.Errorf("got identity %s, want %s", identity.Name, tt.wantName)
+			}
+			if identity.CanRead() != tt.canRead {
+				t.Errorf("CanRead() = %v, want %v", identity.CanRead(), tt.canRead)
+			}
+			for _, agent := range tt.canWrite {
+				if !identity.CanWriteAgent(agent) {
+					t.Errorf("CanWriteAgent(%s) = false, want true", agent)
+				}
+			}
+			for _, agent := range tt.cantWrite {
+				if identity.CanWriteAgent(agent) {
+					t.Errorf("CanWriteAgent(%s) = true, want false", agent)
+				}
+			}
+		})
+	}
+	if _, found := s.Authenticate("unknown"); found {
+		t.Error("Authenticate() found an unknown token")
+	}
+
+	// a revoked token is rejected after the reload
+	writeFile(t, path, `{"tokens": [{"name": "dashboard", "token": "dashboard-token", "scopes": ["read"]}]}`)
+	if changed, err := s.Reload(); err != nil || !changed {
+		t.Fatalf("Reload() = %v, %v, want a change", changed, err)
+	}
+	if _, found := s.Authenticate("prod-token"); found {
+		t.Error("the revoked token is still valid")
+	}
+	if changed, err := s.Reload(); err != nil || changed {
+		t.Errorf("Reload() = %v, %v, want no change", changed, err)
+	}
+
+	// an invalid file keeps the current credentials
+	writeFile(t, path, "tokens: [{name: broken}]")
+	if _, err := s.Reload(); err == nil {
+		t.Error("Reload() of an invalid file succeeded")
+	}
+	if _, found := s.Authenticate("dashboard-token"); !found {
+		t.Error("the credentials were dropped after an invalid reload")
+	}
+}
+
+func TestConfigNewStore(t *testing.T) {
+	tests := []struct {
+		name    string
+		conf    Config
+		wantErr bool
+	}{
+		{name: "shared_token", conf: Config{SharedToken: "shared-token"}},
+		{name: "client_certificates_only", conf: Config{ClientCertificates: true}},
+		{name: "without_auth", conf: Config{}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.conf.Logger = logr.Discard()
+			s, err := tt.conf.NewStore()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewStore() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil {
+				if _, found := s.Authenticate("unknown"); found {
+					t.Error("Authenticate() found an unknown token")
+				}
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr bool
+	}{
+		{name: "empty", data: ""},
+		{name: "valid", data: testCredentials},
+		{name: "unknown_field", data: "tokens: [{name: a, token: a, scopes: [read], admin: true}]", wantErr: true},
+		{name: "missing_token", data: "tokens: [{name: a, scopes: [read]}]", wantErr: true},
+		{name: "missing_scopes", data: "tokens: [{name: a, token: a}]", wantErr: true},
+		{name: "invalid_scope", data: "tokens: [{name: a, token: a, scopes: ['agent::write']}]", wantErr: true},
+		{name: "duplicate_token", data: "tokens: [{name: a, token: a, scopes: [read]}, {name: b, token: a, scopes: [read]}]", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parse([]byte(tt.data)); (err != nil) != tt.wantErr {
+				t.Errorf("parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCertificateIdentity(t *testing.T) {
+	tests := []struct {
+		name     string
+		cert     *x509.Certificate
+		wantName string
+	}{
+		{name: "common_name", cert: &x509.Certificate{Subject: pkix.Name{CommonName: "prod"}, DNSNames: []string{"other"}}, wantName: "prod"},
+		{name: "dns_name", cert: &x509.Certificate{DNSNames: []string{"prod"}}, wantName: "prod"},
+		{name: "no_name", cert: &x509.Certificate{}},
+		{name: "scope_injection", cert: &x509.Certificate{Subject: pkix.Name{CommonName: "prod:write"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identity, ok := CertificateIdentity(tt.cert)
+			if ok != (tt.wantName != "") {
+				t.Fatalf("CertificateIdentity() ok = %v", ok)
+			}
+			if !ok {
+				return
+			}
+			if identity.Name != tt.wantName || !identity.CanWriteAgent(tt.wantName) || identity.CanRead() {
+				t.Errorf("got identity %+v, want write access to agent %s only", identity, tt.wantName)
+			}
+		})
+	}
+}
@@ -0,0 +1,317 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	jose "gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+const (
+	DefaultUsernameClaim       = "sub"
+	DefaultGroupsClaim         = "groups"
+	DefaultJWKSRefreshInterval = time.Hour
+
+	// minimum time between two refreshes of the JWKS triggered by an unknown key id
+	jwksMinRefreshInterval = time.Minute
+	oidcDiscoveryPath      = "/.well-known/openid-configuration"
+)
+
+// asymmetric algorithms accepted in the tokens. HMAC is not supported since the keys are public
+var jwtAlgorithms = map[string]bool{
+	string(jose.RS256): true, string(jose.RS384): true, string(jose.RS512): true,
+	string(jose.PS256): true, string(jose.PS384): true, string(jose.PS512): true,
+	string(jose.ES256): true, string(jose.ES384): true, string(jose.ES512): true,
+	string(jose.EdDSA): true,
+}
+
+// JWTConfig contains the configuration of the JWT verification
+type JWTConfig struct {
+	// Expected iss claim. The JWT verification is disabled if empty
+	Issuer string
+	// Expected aud claim. Not checked if empty
+	Audience string
+	// URL of the JSON Web Key Set of the issuer.
+	// If both the URL and the file are empty, the URL is discovered from the OpenID configuration of the issuer
+	JWKSURL string
+	// JSON Web Key Set file
+	JWKSFile string
+	// Interval between two refreshes of the JSON Web Key Set
+	RefreshInterval time.Duration
+	// Claim with the name of the identity
+	UsernameClaim string
+	// Claim with the groups of the identity. It can be a string or a list of strings
+	GroupsClaim string
+	// Scopes granted to the members of each group
+	GroupScopes map[string][]string
+	HTTPClient  *http.Client
+	Logger      logr.Logger
+}
+
+// Enabled returns true if the JWT verification is configured
+func (c *JWTConfig) Enabled() bool {
+	return c != nil && c.Issuer != ""
+}
+
+// ParseGroupScopes parses a list of GROUP=SCOPE mappings
+func ParseGroupScopes(mappings []string) (map[string][]string, error) {
+	groupScopes := map[string][]string{}
+	for _, mapping := range mappings {
+		parts := strings.SplitN(mapping, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid group scope %q: must be GROUP=SCOPE", mapping)
+		}
+		if err := validateScope(parts[1]); err != nil {
+			return nil, fmt.Errorf("invalid group scope %q: %w", mapping, err)
+		}
+		groupScopes[parts[0]] = append(groupScopes[parts[0]], parts[1])
+	}
+	return groupScopes, nil
+}
+
+// JWTVerifier verifies the JWTs of an issuer and maps their claims to identities
+type JWTVerifier struct {
+	issuer          string
+	audience        string
+	jwksURL         string
+	jwksFile        string
+	refreshInterval time.Duration
+	usernameClaim   string
+	groupsClaim     string
+	groupScopes     map[string][]string
+	httpClient      *http.Client
+	keys            *jose.JSONWebKeySet
+	lastRefresh     time.Time
+	mutex           sync.RWMutex
+	log             logr.Logger
+}
+
+func (c *JWTConfig) NewVerifier() (*JWTVerifier, error) {
+	if c.Issuer == "" {
+		return nil, fmt.Errorf("the JWT issuer is required")
+	}
+	if c.JWKSURL != "" && c.JWKSFile != "" {
+		return nil, fmt.Errorf("only one of the JWKS url or file can be set")
+	}
+	v := &JWTVerifier{
+		issuer:          c.Issuer,
+		audience:        c.Audience,
+		jwksURL:         c.JWKSURL,
+		jwksFile:        c.JWKSFile,
+		refreshInterval: c.RefreshInterval,
+		usernameClaim:   c.UsernameClaim,
+		groupsClaim:     c.GroupsClaim,
+		groupScopes:     c.GroupScopes,
+		httpClient:      c.HTTPClient,
+		log:             c.Logger,
+	}
+	if v.refreshInterval == 0 {
+		v.refreshInterval = DefaultJWKSRefreshInterval
+	}
+	if v.usernameClaim == "" {
+		v.usernameClaim = DefaultUsernameClaim
+	}
+	if v.groupsClaim == "" {
+		v.groupsClaim = DefaultGroupsClaim
+	}
+	if v.httpClient == nil {
+		v.httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	if v.log == nil {
+		v.log = logr.Discard()
+	}
+	if v.jwksURL == "" && v.jwksFile == "" {
+		jwksURL, err := v.discoverJWKSURL()
+		if err != nil {
+			return nil, err
+		}
+		v.jwksURL = jwksURL
+	}
+	if err := v.Refresh(); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Verify checks the signature and the claims of the token and returns its identity
+func (v *JWTVerifier) Verify(raw string) (*Identity, error) {
+	token, err := jwt.ParseSigned(raw)
+	if err != nil {
+		return nil, err
+	}
+	if len(token.Headers) != 1 {
+		return nil, fmt.Errorf("the token must have a single signature")
+	}
+	header := token.Headers[0]
+	if !jwtAlgorithms[header.Algorithm] {
+		return nil, fmt.Errorf("unsupported signing algorithm %q", header.Algorithm)
+	}
+	keys := v.candidateKeys(header.KeyID)
+	if len(keys) == 0 {
+		// the issuer may have rotated its keys
+		v.refreshForUnknownKey()
+		keys = v.candidateKeys(header.KeyID)
+	}
+	var claims jwt.Claims
+	claimsMap := map[string]interface{}{}
+	err = fmt.Errorf("no key of the JWKS matches the key id %q", header.KeyID)
+	for _, key := range keys {
+		if err = token.Claims(key.Key, &claims, &claimsMap); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	expected := jwt.Expected{Issuer: v.issuer, Time: time.Now()}
+	if v.audience != "" {
+		expected.Audience = jwt.Audience{v.audience}
+	}
+	if err := claims.Validate(expected); err != nil {
+		return nil, err
+	}
+	// the expiration is only validated when it is set, a leaked token without it would never expire
+	if claims.Expiry == nil {
+		return nil, fmt.Errorf("missing exp claim")
+	}
+	name, _ := claimsMap[v.usernameClaim].(string)
+	if name == "" {
+		return nil, fmt.Errorf("missing %s claim", v.usernameClaim)
+	}
+	identity := &Identity{Name: name, Scopes: []string{}}
+	for _, group := range stringsClaim(claimsMap[v.groupsClaim]) {
+		for _, scope := range v.groupScopes[group] {
+			if !identity.HasScope(scope) {
+				identity.Scopes = append(identity.Scopes, scope)
+			}
+		}
+	}
+	return identity, nil
+}
+
+// Refresh fetches the JSON Web Key Set from the URL or reads it from the file.
+// The current keys are kept if it fails
+func (v *JWTVerifier) Refresh() error {
+	var data []byte
+	var err error
+	if v.jwksFile != "" {
+		data, err = ioutil.ReadFile(v.jwksFile)
+	} else {
+		data, err = v.fetch(v.jwksURL)
+	}
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	v.lastRefresh = time.Now()
+	if err != nil {
+		return fmt.Errorf("failed to load the JWKS: %w", err)
+	}
+	var keys jose.JSONWebKeySet
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return fmt.Errorf("invalid JWKS: %w", err)
+	}
+	if len(keys.Keys) == 0 {
+		return fmt.Errorf("the JWKS has no keys")
+	}
+	v.keys = &keys
+	return nil
+}
+
+// Watch refreshes the JSON Web Key Set periodically until the context is done
+func (v *JWTVerifier) Watch(ctx context.Context) {
+	ticker := time.NewTicker(v.refreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := v.Refresh(); err != nil {
+				v.log.Error(err, "failed to refresh the JWKS, keeping the current keys")
+			}
+		}
+	}
+}
+
+func (v *JWTVerifier) candidateKeys(keyID string) []jose.JSONWebKey {
+	v.mutex.RLock()
+	defer v.mutex.RUnlock()
+	if v.keys == nil {
+		return nil
+	}
+	if keyID == "" {
+		return v.keys.Keys
+	}
+	return v.keys.Key(keyID)
+}
+
+func (v *JWTVerifier) refreshForUnknownKey() {
+	v.mutex.RLock()
+	recent := time.Since(v.lastRefresh) < jwksMinRefreshInterval
+	v.mutex.RUnlock()
+	if recent {
+		return
+	}
+	if err := v.Refresh(); err != nil {
+		v.log.Error(err, "failed to refresh the JWKS")
+	}
+}
+
+func (v *JWTVerifier) discoverJWKSURL() (string, error) {
+	data, err := v.fetch(strings.TrimSuffix(v.issuer, "/") + oidcDiscoveryPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to discover the JWKS url of the issuer: %w", err)
+	}
+	var config struct {
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return "", fmt.Errorf("invalid OpenID configuration: %w", err)
+	}
+	if config.JWKSURI == "" {
+		return "", fmt.Errorf("the OpenID configuration of the issuer has no jwks_uri")
+	}
+	return config.JWKSURI, nil
+}
+
+func (v *JWTVerifier) fetch(url string) ([]byte, error) {
+	resp, err := v.httpClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: unexpected status %d", url, resp.StatusCode)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// stringsClaim returns the values of a claim that can be a string or a list of strings
+func stringsClaim(claim interface{}) []string {
+	switch value := claim.(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		values := make([]string, 0, len(value))
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
+
+// isJWT returns true if the token has the three dot separated parts of a JWS
+func isJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
@@ -0,0 +1,231 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	jose "gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+// testIssuer serves the OpenID configuration and the JWKS of its signing keys
+type testIssuer struct {
+	server *httptest.Server
+	mutex  sync.Mutex
+	keys   map[string]*rsa.PrivateKey
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	issuer := &testIssuer{keys: map[string]*rsa.PrivateKey{}}
+	issuer.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		issuer.mutex.Lock()
+		defer issuer.mutex.Unlock()
+		switch r.URL.Path {
+		case oidcDiscoveryPath:
+			json.NewEncoder(w).Encode(map[string]string{"jwks_uri": issuer.server.URL + "/keys"}) // nolint: errcheck
+		case "/keys":
+			jwks := jose.JSONWebKeySet{}
+			for kid, key := range issuer.keys {
+				jwks.Keys = append(jwks.Keys, jose.JSONWebKey{Key: &key.PublicKey, KeyID: kid, Algorithm: string(jose.RS256), Use: "sig"})
+			}
+			json.NewEncoder(w).Encode(jwks) // nolint: errcheck
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(issuer.server.Close)
+	issuer.addKey(t, "key-1")
+	return issuer
+}
+
+func (i *testIssuer) addKey(t *testing.T, kid string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.keys[kid] = key
+}
+
+func (i *testIssuer) sign(t *testing.T, kid string, claims interface{}) string {
+	i.mutex.Lock()
+	key := i.keys[kid]
+	i.mutex.Unlock()
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: key}, (&jose.SignerOptions{}).WithHeader("kid", kid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := jwt.Signed(signer).Claims(claims).CompactSerialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+type testClaims struct {
+	jwt.Claims
+	Email  string      `json:"email,omitempty"`
+	Groups interface{} `json:"groups,omitempty"`
+}
+
+func TestJWTVerifier(t *testing.T) {
+	issuer := newTestIssuer(t)
+	conf := JWTConfig{
+		Issuer:        issuer.server.URL,
+		Audience:      "opvic",
+		UsernameClaim: "email",
+		GroupScopes:   map[string][]string{"sre": {ScopeRead, ScopeWrite}, "dev": {ScopeRead}},
+	}
+	verifier, err := conf.NewVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	valid := jwt.Claims{Issuer: issuer.server.URL, Audience: jwt.Audience{"opvic"}, Expiry: jwt.NewNumericDate(now.Add(time.Hour))}
+	with := func(update func(c *jwt.Claims)) jwt.Claims {
+		claims := valid
+		update(&claims)
+		return claims
+	}
+
+	tests := []struct {
+		name       string
+		token      string
+		wantScopes []string
+		wantErr    bool
+	}{
+		{
+			name:       "groups_list",
+			token:      issuer.sign(t, "key-1", testClaims{Claims: valid, Email: "jane@example.com", Groups: []string{"dev", "sre"}}),
+			wantScopes: []string{ScopeRead, ScopeWrite},
+		},
+		{
+			name:       "single_group",
+			token:      issuer.sign(t, "key-1", testClaims{Claims: valid, Email: "jane@example.com", Groups: "dev"}),
+			wantScopes: []string{ScopeRead},
+		},
+		{
+			name:       "unknown_group",
+			token:      issuer.sign(t, "key-1", testClaims{Claims: valid, Email: "jane@example.com", Groups: []string{"sales"}}),
+			wantScopes: []string{},
+		},
+		{
+			name:    "expired",
+			token:   issuer.sign(t, "key-1", testClaims{Claims: with(func(c *jwt.Claims) { c.Expiry = jwt.NewNumericDate(now.Add(-time.Hour)) }), Email: "jane@example.com"}),
+			wantErr: true,
+		},
+		{
+			name:    "missing_exp",
+			token:   issuer.sign(t, "key-1", testClaims{Claims: with(func(c *jwt.Claims) { c.Expiry = nil }), Email: "jane@example.com", Groups: "sre"}),
+			wantErr: true,
+		},
+		{
+			name:    "other_issuer",
+			token:   issuer.sign(t, "key-1", testClaims{Claims: with(func(c *jwt.Claims) { c.Issuer = "https://other.example.com" }), Email: "jane@example.com"}),
+			wantErr: true,
+		},
+		{
+			name:    "other_audience",
+			token:   issuer.sign(t, "key-1", testClaims{Claims: with(func(c *jwt.Claims) { c.Audience = jwt.Audience{"other"} }), Email: "jane@example.com"}),
+			wantErr: true,
+		},
+		{
+			name:    "missing_username",
+			token:   issuer.sign(t, "key-1", testClaims{Claims: valid, Groups: "dev"}),
+			wantErr: true,
+		},
+		{
+			name:    "hmac",
+			token:   signHMAC(t, testClaims{Claims: valid, Email: "jane@example.com", Groups: "sre"}),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identity, err := verifier.Verify(tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if identity.Name != "jane@example.com" {
+				t.Errorf("got identity %s, want jane@example.com", identity.Name)
+			}
+			if !reflect.DeepEqual(identity.Scopes, tt.wantScopes) {
+				t.Errorf("got scopes %v, want %v", identity.Scopes, tt.wantScopes)
+			}
+		})
+	}
+
+	// a token signed by a new key of the issuer is accepted after a refresh
+	issuer.addKey(t, "key-2")
+	verifier.lastRefresh = time.Time{}
+	if _, err := verifier.Verify(issuer.sign(t, "key-2", testClaims{Claims: valid, Email: "jane@example.com"})); err != nil {
+		t.Errorf("Verify() error = %v, want the rotated key to be fetched", err)
+	}
+}
+
+func signHMAC(t *testing.T, claims interface{}) string {
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.HS256, Key: []byte("secret")}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := jwt.Signed(signer).Claims(claims).CompactSerialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestStoreWithJWT(t *testing.T) {
+	issuer := newTestIssuer(t)
+	conf := Config{
+		SharedToken: "shared-token",
+		JWT:         &JWTConfig{Issuer: issuer.server.URL, GroupScopes: map[string][]string{"dev": {ScopeRead}}},
+		Logger:      logr.Discard(),
+	}
+	s, err := conf.NewStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity, found := s.Authenticate("shared-token"); !found || identity.Name != SharedIdentity {
+		t.Errorf("the static token was not authenticated")
+	}
+	token := issuer.sign(t, "key-1", testClaims{
+		Claims: jwt.Claims{Issuer: issuer.server.URL, Subject: "jane", Expiry: jwt.NewNumericDate(time.Now().Add(time.Hour))},
+		Groups: []string{"dev"},
+	})
+	identity, found := s.Authenticate(token)
+	if !found || identity.Name != "jane" || !identity.CanRead() || identity.CanWriteAgent("prod") {
+		t.Errorf("Authenticate() = %+v, %v, want jane with the read scope", identity, found)
+	}
+	if _, found := s.Authenticate("a.b.c"); found {
+		t.Error("Authenticate() accepted an invalid JWT")
+	}
+}
+
+func TestParseGroupScopes(t *testing.T) {
+	got, err := ParseGroupScopes([]string{"sre=read", "sre=write", "prod-agents=agent:prod:write"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{"sre": {ScopeRead, ScopeWrite}, "prod-agents": {"agent:prod:write"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseGroupScopes() = %v, want %v", got, want)
+	}
+	for _, invalid := range []string{"sre", "=read", "sre=admin"} {
+		if _, err := ParseGroupScopes([]string{invalid}); err == nil {
+			t.Errorf("ParseGroupScopes(%q) succeeded, want an error", invalid)
+		}
+	}
+}
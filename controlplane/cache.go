@@ -5,14 +5,17 @@ import (
 	"time"
 
 	"github.com/jasonlvhit/gocron"
-	"github.com/patrickmn/go-cache"
+	"github.com/skillz/opvic/agent/api/v1alpha1"
 	api "github.com/skillz/opvic/controlplane/api/v1alpha1"
+	"github.com/skillz/opvic/controlplane/storage"
 	"github.com/skillz/opvic/utils"
 )
 
 const (
 	// holds the list of all the agents that have been registered with the control plane
 	AgentListCacheKey = "agents/list"
+	// name of the lock that elects the replica running the cache reconcile
+	cacheReconcileLock = "cache-reconcile"
 )
 
 // Cach key for storing all the versions recieved from an agent in format:
@@ -39,104 +42,255 @@ func AgentSubjectVersionListCacheKey(agentID string) string {
 	return fmt.Sprintf("%s/versions/list", agentID)
 }
 
+// Cach key for the history of the running versions of a SubjectVersion
+// :agentID/:versionID/history
+func SubjectVersionHistoryCacheKey(agentID, versionID string) string {
+	return fmt.Sprintf("%s/%s/history", agentID, versionID)
+}
+
+// Cach key for the time that each remote version was first seen by the control plane.
+// The charts of a helm repository have their own versions
+// remote/:provider/:repo[/:chart]/:strategy/first-seen
+func RemoteVersionsFirstSeenCacheKey(conf v1alpha1.RemoteVersion) string {
+	repo := conf.Repo
+	if conf.Chart != "" {
+		repo = fmt.Sprintf("%s/%s", repo, conf.Chart)
+	}
+	return fmt.Sprintf("remote/%s/%s/%s/first-seen", conf.Provider, repo, conf.Strategy)
+}
+
+// setState stores the value in the storage backend and logs the failures
+func (cp *ControlPlane) setState(key string, value interface{}) {
+	if err := cp.store.Set(key, value); err != nil {
+		cp.log.WithName("storage").Error(err, "failed to store the value", "key", key)
+	}
+}
+
+// updateState atomically updates the value of the key in the storage backend so the concurrent requests of
+// the agents and the other control plane replicas don't overwrite each other. update returns true if it changed the value
+func (cp *ControlPlane) updateState(key string, value interface{}, update func(found bool) bool) {
+	err := cp.store.Update(key, value, func(found bool) (bool, error) {
+		return update(found), nil
+	})
+	if err != nil {
+		cp.log.WithName("storage").Error(err, "failed to update the value", "key", key)
+	}
+}
+
+// getState decodes the value of the key from the storage backend into value
+func (cp *ControlPlane) getState(key string, value interface{}) bool {
+	found, err := cp.store.Get(key, value)
+	if err != nil {
+		cp.log.WithName("storage").Error(err, "failed to get the value", "key", key)
+		return false
+	}
+	return found
+}
+
 // SetAgentCache put the subjectVersions in the cache in the AgentCacheKey path
 func (cp *ControlPlane) SetAgentCache(agentID string, subjectVersions api.SubjectVersions) {
-	cp.cache.Set(AgentCacheKey(agentID), subjectVersions, cache.DefaultExpiration)
+	cp.setState(AgentCacheKey(agentID), subjectVersions)
 }
 
 // GetAgentCache gets the SubjectVersions for an agent from the AgentCacheKey path cache
 func (cp *ControlPlane) GetAgentCache(agentID string) (api.SubjectVersions, bool) {
-
-	subjectVersions, found := cp.cache.Get(AgentCacheKey(agentID))
-	if !found {
+	subjectVersions := api.SubjectVersions{}
+	if !cp.getState(AgentCacheKey(agentID), &subjectVersions) {
 		return api.SubjectVersions{}, false
 	}
-	return subjectVersions.(api.SubjectVersions), true
+	return subjectVersions, true
 }
 
 // SetAgentCache sets the version in the agent payload in the cache
 func (cp *ControlPlane) SetSubjectVersionCache(agentID, versionID string, subjectVersion api.SubjectVersion) {
-	cp.cache.Set(SubjectVersionCacheKey(agentID, versionID), subjectVersion, cache.DefaultExpiration)
+	cp.setState(SubjectVersionCacheKey(agentID, versionID), subjectVersion)
 }
 
 func (cp *ControlPlane) GetSubjectVersionCache(agent, versionID string) (api.SubjectVersion, bool) {
-	subjectVersion, found := cp.cache.Get(SubjectVersionCacheKey(agent, versionID))
-	if !found {
+	subjectVersion := api.SubjectVersion{}
+	if !cp.getState(SubjectVersionCacheKey(agent, versionID), &subjectVersion) {
 		return api.SubjectVersion{}, false
 	}
-	return subjectVersion.(api.SubjectVersion), true
+	return subjectVersion, true
 }
 
 func (cp *ControlPlane) SetSubjectVersionInfoCache(agentID, versionID string, versionInfo api.VersionInfos) {
-	cp.cache.Set(SubjectVersionInfoCacheKey(agentID, versionID), versionInfo, cache.DefaultExpiration)
+	cp.setState(SubjectVersionInfoCacheKey(agentID, versionID), versionInfo)
 }
 
 func (cp *ControlPlane) GetSubjectVersionInfoCache(agentID, versionID string) (api.VersionInfos, bool) {
-	versionInfo, found := cp.cache.Get(SubjectVersionInfoCacheKey(agentID, versionID))
-	if !found {
+	versionInfo := api.VersionInfos{}
+	if !cp.getState(SubjectVersionInfoCacheKey(agentID, versionID), &versionInfo) {
 		return api.VersionInfos{}, false
 	}
-	return versionInfo.(api.VersionInfos), true
+	return versionInfo, true
 }
 
 func (cp *ControlPlane) SetAgentListCache(agents api.Agents) {
-	cp.cache.Set(AgentListCacheKey, agents, cache.DefaultExpiration)
+	cp.setState(AgentListCacheKey, agents)
 }
 
 func (cp *ControlPlane) GetAgentListCache() api.Agents {
-	agents, found := cp.cache.Get(AgentListCacheKey)
-	if !found {
+	agents := api.Agents{}
+	if !cp.getState(AgentListCacheKey, &agents) {
 		return api.Agents{}
 	}
-	return agents.(api.Agents)
+	return agents
 }
 
 // Check cache and update if necessary
 func (cp *ControlPlane) UpdateAgentListCache(agentId string, agentTags map[string]string) {
-	agents := cp.GetAgentListCache()
-	found := false
-	for _, agent := range agents {
-		if agent.ID == agentId {
-			found = true
-			agent.Tags = agentTags
-			agent.LastHeartbeat = time.Now().Unix()
+	var agents api.Agents
+	cp.updateState(AgentListCacheKey, &agents, func(bool) bool {
+		found := false
+		for _, agent := range agents {
+			if agent.ID == agentId {
+				found = true
+				agent.Tags = agentTags
+				agent.LastHeartbeat = time.Now().Unix()
+			}
 		}
-	}
-	if !found {
-		agents = append(agents, &api.Agent{
-			ID:            agentId,
-			Tags:          agentTags,
-			LastHeartbeat: time.Now().Unix(),
-		})
-	}
-	cp.SetAgentListCache(agents)
+		if !found {
+			agents = append(agents, &api.Agent{
+				ID:            agentId,
+				Tags:          agentTags,
+				LastHeartbeat: time.Now().Unix(),
+			})
+		}
+		return true
+	})
 }
 
 func (cp *ControlPlane) SetAgentSubjectVersionListCache(agentID string, list []string) {
-	cp.cache.Set(AgentSubjectVersionListCacheKey(agentID), list, cache.DefaultExpiration)
+	cp.setState(AgentSubjectVersionListCacheKey(agentID), list)
 }
 
 func (cp *ControlPlane) GetAgentSubjectVersionListCache(agentID string) []string {
-	list, found := cp.cache.Get(AgentSubjectVersionListCacheKey(agentID))
-	if !found {
+	list := []string{}
+	if !cp.getState(AgentSubjectVersionListCacheKey(agentID), &list) {
 		return []string{}
 	}
-	return list.([]string)
+	return list
 }
 
 func (cp *ControlPlane) UpdateAgentSubjectVersionsList(agentId, versionId string) {
-	subjectList := cp.GetAgentSubjectVersionListCache(agentId)
-	if !utils.Contains(subjectList, versionId) {
+	var subjectList []string
+	cp.updateState(AgentSubjectVersionListCacheKey(agentId), &subjectList, func(bool) bool {
+		if utils.Contains(subjectList, versionId) {
+			return false
+		}
 		subjectList = append(subjectList, versionId)
-		cp.SetAgentSubjectVersionListCache(agentId, subjectList)
+		return true
+	})
+}
+
+// SyncAgentSubjectVersionsList adds the versionIDs to the subject list of the agent.
+// If keep is not nil, the subjects that are neither in keep nor in versionIDs are removed. It returns the removed subjects
+func (cp *ControlPlane) SyncAgentSubjectVersionsList(agentID string, versionIDs, keep []string) []string {
+	var subjectList []string
+	var removed []string
+	cp.updateState(AgentSubjectVersionListCacheKey(agentID), &subjectList, func(bool) bool {
+		newList := []string{}
+		removed = []string{}
+		for _, versionID := range subjectList {
+			if keep == nil || utils.Contains(keep, versionID) || utils.Contains(versionIDs, versionID) {
+				newList = append(newList, versionID)
+			} else {
+				removed = append(removed, versionID)
+			}
+		}
+		for _, versionID := range versionIDs {
+			if !utils.Contains(newList, versionID) {
+				newList = append(newList, versionID)
+			}
+		}
+		subjectList = newList
+		return true
+	})
+	for _, versionID := range removed {
+		cp.DeleteSubjectVersionCache(agentID, versionID)
+	}
+	if len(removed) > 0 {
+		cp.removeFromAgentCache(agentID, removed)
+	}
+	return removed
+}
+
+// RemoveAgentSubjectVersion removes the subject from the subject list of the agent and from the cache.
+// It returns false if the agent didn't report the subject
+func (cp *ControlPlane) RemoveAgentSubjectVersion(agentID, versionID string) bool {
+	var subjectList []string
+	reported := false
+	cp.updateState(AgentSubjectVersionListCacheKey(agentID), &subjectList, func(bool) bool {
+		reported = utils.Contains(subjectList, versionID)
+		if !reported {
+			return false
+		}
+		newList := []string{}
+		for _, id := range subjectList {
+			if id != versionID {
+				newList = append(newList, id)
+			}
+		}
+		subjectList = newList
+		return true
+	})
+	if !reported {
+		return false
+	}
+	cp.DeleteSubjectVersionCache(agentID, versionID)
+	cp.removeFromAgentCache(agentID, []string{versionID})
+	return true
+}
+
+// DeleteSubjectVersionCache removes the subject version and its version infos from the cache
+func (cp *ControlPlane) DeleteSubjectVersionCache(agentID, versionID string) {
+	for _, key := range []string{SubjectVersionCacheKey(agentID, versionID), SubjectVersionInfoCacheKey(agentID, versionID)} {
+		if err := cp.store.Delete(key); err != nil {
+			cp.log.WithName("storage").Error(err, "failed to delete the value", "key", key)
+		}
 	}
 }
 
+// removeFromAgentCache removes the subjects from the agent cache without waiting for the next cache reconcile
+func (cp *ControlPlane) removeFromAgentCache(agentID string, versionIDs []string) {
+	var subjectVersions api.SubjectVersions
+	cp.updateState(AgentCacheKey(agentID), &subjectVersions, func(found bool) bool {
+		if !found {
+			return false
+		}
+		kept := api.SubjectVersions{}
+		for _, version := range subjectVersions {
+			if !utils.Contains(versionIDs, version.ID) {
+				kept = append(kept, version)
+			}
+		}
+		subjectVersions = kept
+		return true
+	})
+}
+
 func (cp *ControlPlane) CacheReconcile() {
 	log := cp.log.WithName("cache-reconcile")
+	// with a shared storage only the leader reconciles the cache and hits the remote providers.
+	// the lock outlives the interval so the leader keeps it between runs
+	leader, err := storage.AcquireLock(cp.store, cacheReconcileLock, 2*cp.cacheReconcilerInterval)
+	if err != nil {
+		cp.leader.Set(0)
+		log.Error(err, "failed to acquire the cache reconcile lock")
+		return
+	}
+	if !leader {
+		cp.leader.Set(0)
+		log.V(1).Info("another replica is reconciling the cache, skipping")
+		return
+	}
+	cp.leader.Set(1)
 	log.Info("starting cache reconcile")
 
-	cp.cache.DeleteExpired()
+	if err := cp.store.DeleteExpired(); err != nil {
+		log.Error(err, "failed to delete the expired keys from the storage")
+	}
 	cp.AgentListCacheReconcile()
 	cp.AgentCacheReconcile()
 	cp.SubjectVersionInfoCacheReconcile()
@@ -189,6 +343,9 @@ func (cp *ControlPlane) SubjectVersionInfoCacheReconcile() {
 					continue
 				}
 				cp.SetSubjectVersionInfoCache(agent, ver.ID, verInfos)
+				if cp.notifier != nil && verInfos.LatestVersion != MissingLatest {
+					cp.notifier.Process(verInfos)
+				}
 			}
 		}
 	}
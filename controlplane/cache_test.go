@@ -0,0 +1,142 @@
+package controlplane
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	api "github.com/skillz/opvic/controlplane/api/v1alpha1"
+	"github.com/skillz/opvic/utils"
+)
+
+func TestSyncAgentSubjectVersionsList(t *testing.T) {
+	tests := []struct {
+		name        string
+		versionIDs  []string
+		keep        []string
+		wantList    []string
+		wantRemoved []string
+	}{
+		{
+			name:        "without_subject_list",
+			versionIDs:  []string{"d"},
+			wantList:    []string{"a", "b", "c", "d"},
+			wantRemoved: []string{},
+		},
+		{
+			name:        "prune_untracked_subjects",
+			versionIDs:  []string{"a"},
+			keep:        []string{"a", "c"},
+			wantList:    []string{"a", "c"},
+			wantRemoved: []string{"b"},
+		},
+		{
+			name:        "batch_versions_are_kept",
+			versionIDs:  []string{"d"},
+			keep:        []string{},
+			wantList:    []string{"d"},
+			wantRemoved: []string{"a", "b", "c"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cp := newTestControlPlane()
+			versions := api.SubjectVersions{}
+			for _, id := range []string{"a", "b", "c"} {
+				cp.SetSubjectVersionCache("agent", id, api.SubjectVersion{ID: id})
+				cp.SetSubjectVersionInfoCache("agent", id, api.VersionInfos{ID: id})
+				versions = append(versions, &api.SubjectVersion{ID: id})
+			}
+			cp.SetAgentSubjectVersionListCache("agent", []string{"a", "b", "c"})
+			cp.SetAgentCache("agent", versions)
+
+			removed := cp.SyncAgentSubjectVersionsList("agent", tt.versionIDs, tt.keep)
+			if !reflect.DeepEqual(removed, tt.wantRemoved) {
+				t.Errorf("SyncAgentSubjectVersionsList() = %v, want %v", removed, tt.wantRemoved)
+			}
+			if got := cp.GetAgentSubjectVersionListCache("agent"); !reflect.DeepEqual(got, tt.wantList) {
+				t.Errorf("subject list = %v, want %v", got, tt.wantList)
+			}
+			for _, id := range tt.wantRemoved {
+				if _, found := cp.GetSubjectVersionCache("agent", id); found {
+					t.Errorf("subject version %s was not deleted", id)
+				}
+				if _, found := cp.GetSubjectVersionInfoCache("agent", id); found {
+					t.Errorf("version infos of %s were not deleted", id)
+				}
+			}
+			agentVersions, _ := cp.GetAgentCache("agent")
+			for _, v := range agentVersions {
+				if utils.Contains(tt.wantRemoved, v.ID) {
+					t.Errorf("subject %s is still in the agent cache", v.ID)
+				}
+			}
+		})
+	}
+}
+
+func TestRemoveAgentSubjectVersion(t *testing.T) {
+	cp := newTestControlPlane()
+	cp.SetSubjectVersionCache("agent", "coredns", api.SubjectVersion{ID: "coredns"})
+	cp.SetSubjectVersionInfoCache("agent", "coredns", api.VersionInfos{ID: "coredns"})
+	cp.SetAgentSubjectVersionListCache("agent", []string{"coredns", "istio"})
+	cp.SetAgentCache("agent", api.SubjectVersions{{ID: "coredns"}, {ID: "istio"}})
+
+	if !cp.RemoveAgentSubjectVersion("agent", "coredns") {
+		t.Fatal("RemoveAgentSubjectVersion() = false, want true")
+	}
+	if cp.RemoveAgentSubjectVersion("agent", "coredns") {
+		t.Error("RemoveAgentSubjectVersion() = true for a removed subject, want false")
+	}
+	if got := cp.GetAgentSubjectVersionListCache("agent"); !reflect.DeepEqual(got, []string{"istio"}) {
+		t.Errorf("subject list = %v, want [istio]", got)
+	}
+	if _, found := cp.GetSubjectVersionCache("agent", "coredns"); found {
+		t.Error("the subject version was not deleted")
+	}
+	if _, found := cp.GetSubjectVersionInfoCache("agent", "coredns"); found {
+		t.Error("the version infos were not deleted")
+	}
+	if versions, _ := cp.GetAgentCache("agent"); len(versions) != 1 || versions[0].ID != "istio" {
+		t.Errorf("agent cache = %v, want istio only", versions)
+	}
+}
+
+func TestUpdateAgentListsConcurrently(t *testing.T) {
+	cp := newTestControlPlane()
+	var wg sync.WaitGroup
+	wantAgents := []string{}
+	wantSubjects := []string{}
+	for i := 0; i < 20; i++ {
+		agentID := fmt.Sprintf("agent-%d", i)
+		versionID := fmt.Sprintf("subject-%d", i)
+		wantAgents = append(wantAgents, agentID)
+		wantSubjects = append(wantSubjects, versionID)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cp.UpdateAgentListCache(agentID, nil)
+			// the subjects of the same agent are shipped by different requests
+			cp.UpdateAgentSubjectVersionsList("agent", versionID)
+		}()
+	}
+	wg.Wait()
+
+	gotAgents := []string{}
+	for _, agent := range cp.GetAgentListCache() {
+		gotAgents = append(gotAgents, agent.ID)
+	}
+	gotSubjects := cp.GetAgentSubjectVersionListCache("agent")
+	sort.Strings(gotAgents)
+	sort.Strings(wantAgents)
+	sort.Strings(gotSubjects)
+	sort.Strings(wantSubjects)
+	if !reflect.DeepEqual(gotAgents, wantAgents) {
+		t.Errorf("agents = %v, want %v", gotAgents, wantAgents)
+	}
+	if !reflect.DeepEqual(gotSubjects, wantSubjects) {
+		t.Errorf("subject list = %v, want %v", gotSubjects, wantSubjects)
+	}
+}
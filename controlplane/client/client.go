@@ -0,0 +1,306 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	api "github.com/skillz/opvic/controlplane/api/v1alpha1"
+	"github.com/skillz/opvic/controlplane/tlsconfig"
+)
+
+const (
+	DefaultTimeout   = 30 * time.Second
+	DefaultRetries   = 3
+	DefaultRetryWait = 500 * time.Millisecond
+)
+
+type Config struct {
+	// Base URL of the control plane (e.g. https://opvic.example.com)
+	URL string
+	// Auth token of the control plane. It can be empty when the client authenticates with a certificate
+	Token     string
+	TLSVerify bool
+	// CA bundle used to verify the control plane certificate. The system roots are used if empty
+	CAFile string
+	// Client certificate and key presented to the control plane. They are reloaded when the files change
+	CertFile string
+	KeyFile  string
+	// Timeout of a single attempt of a request
+	Timeout time.Duration
+	// Number of retries of the requests that failed with a network error, a 429 or a 5xx status.
+	// Zero uses DefaultRetries and a negative value disables the retries
+	Retries int
+	// Wait before the first retry. It doubles on every retry
+	RetryWait time.Duration
+	Logger    logr.Logger
+}
+
+// Client calls the control plane API
+type Client struct {
+	httpClient *http.Client
+	baseURL    string
+	token      string
+	retries    int
+	retryWait  time.Duration
+}
+
+// APIError is returned when the control plane responds with an unexpected status
+type APIError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	// Error message of the response body ({"error": "..."})
+	Message string
+}
+
+func (e *APIError) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = fmt.Sprintf("unexpected status: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("%s %s: %s", e.Method, e.Path, msg)
+}
+
+// IsNotFound returns true if the error is an APIError with a 404 status
+func IsNotFound(err error) bool {
+	return hasStatus(err, http.StatusNotFound)
+}
+
+// IsUnauthorized returns true if the error is an APIError with a 401 status
+func IsUnauthorized(err error) bool {
+	return hasStatus(err, http.StatusUnauthorized)
+}
+
+// IsBadRequest returns true if the error is an APIError with a 400 status
+func IsBadRequest(err error) bool {
+	return hasStatus(err, http.StatusBadRequest)
+}
+
+func hasStatus(err error, status int) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == status
+}
+
+func New(conf Config) (*Client, error) {
+	u, err := url.Parse(conf.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid control plane url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid control plane url %q: the scheme must be http or https", conf.URL)
+	}
+	timeout := conf.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	retries := conf.Retries
+	if retries == 0 {
+		retries = DefaultRetries
+	} else if retries < 0 {
+		retries = 0
+	}
+	retryWait := conf.RetryWait
+	if retryWait == 0 {
+		retryWait = DefaultRetryWait
+	}
+	tlsConf := tlsconfig.ClientConfig{
+		CAFile:             conf.CAFile,
+		CertFile:           conf.CertFile,
+		KeyFile:            conf.KeyFile,
+		InsecureSkipVerify: !conf.TLSVerify,
+		Logger:             conf.Logger,
+	}
+	tlsConfig, err := tlsConf.New()
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		httpClient: &http.Client{
+			Timeout: timeout,
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: tlsConfig,
+			},
+		},
+		baseURL:   strings.TrimSuffix(conf.URL, "/"),
+		token:     conf.Token,
+		retries:   retries,
+		retryWait: retryWait,
+	}, nil
+}
+
+// Ping checks that the control plane is reachable and accepts the token
+func (c *Client) Ping(ctx context.Context) error {
+	return c.do(ctx, http.MethodGet, api.PingAPIEndpoint, nil, nil, nil, http.StatusOK)
+}
+
+// PostAgent sends the subject version collected by an agent
+func (c *Client) PostAgent(ctx context.Context, payload api.AgentPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, http.MethodPost, api.AgentsAPIEndpoint, nil, body, nil, http.StatusAccepted)
+}
+
+// PostAgentBatch sends the subject versions collected by an agent in a single request
+func (c *Client) PostAgentBatch(ctx context.Context, agentID string, batch api.AgentBatchPayload) error {
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, http.MethodPost, endpoint(api.AgentBatchAPIEndpoint, agentID), nil, body, nil, http.StatusAccepted)
+}
+
+// Agents returns the list of agents that reported to the control plane
+func (c *Client) Agents(ctx context.Context) (api.Agents, error) {
+	var agents api.Agents
+	err := c.get(ctx, endpoint(api.AgentsAPIEndpoint), nil, &agents)
+	return agents, err
+}
+
+// Agent returns the subject versions reported by an agent
+func (c *Client) Agent(ctx context.Context, agentID string) (api.SubjectVersions, error) {
+	var versions api.SubjectVersions
+	err := c.get(ctx, endpoint(api.AgentAPIEndpoint, agentID), nil, &versions)
+	return versions, err
+}
+
+// SubjectVersion returns the subject version reported by an agent
+func (c *Client) SubjectVersion(ctx context.Context, agentID, versionID string) (api.SubjectVersion, error) {
+	var version api.SubjectVersion
+	err := c.get(ctx, endpoint(api.AgentsSubjectVersionEndpoint, agentID, versionID), nil, &version)
+	return version, err
+}
+
+// DeleteSubjectVersion removes a subject reported by an agent
+func (c *Client) DeleteSubjectVersion(ctx context.Context, agentID, versionID string) error {
+	return c.do(ctx, http.MethodDelete, endpoint(api.AgentsSubjectVersionEndpoint, agentID, versionID), nil, nil, nil, http.StatusOK)
+}
+
+// SubjectVersionInfos returns the running versions of a subject compared to the remote versions
+func (c *Client) SubjectVersionInfos(ctx context.Context, agentID, versionID string) (api.VersionInfos, error) {
+	var infos api.VersionInfos
+	err := c.get(ctx, endpoint(api.AgentsSubjectVersionInfoEndpoint, agentID, versionID), nil, &infos)
+	return infos, err
+}
+
+// SubjectVersionHistory returns the history of the running versions of a subject.
+// A zero from or to leaves that side of the time range open.
+func (c *Client) SubjectVersionHistory(ctx context.Context, agentID, versionID string, from, to time.Time) (api.SubjectVersionHistory, error) {
+	var history api.SubjectVersionHistory
+	query := url.Values{}
+	if !from.IsZero() {
+		query.Set("from", from.Format(time.RFC3339))
+	}
+	if !to.IsZero() {
+		query.Set("to", to.Format(time.RFC3339))
+	}
+	err := c.get(ctx, endpoint(api.AgentsSubjectVersionHistoryEndpoint, agentID, versionID), query, &history)
+	return history, err
+}
+
+// Overview returns the version infos of all the subjects of all the agents
+func (c *Client) Overview(ctx context.Context) ([]api.OverallVersionInfos, error) {
+	var overview []api.OverallVersionInfos
+	err := c.get(ctx, api.GetAPIEndpoint(api.OverviewAPIPath), nil, &overview)
+	return overview, err
+}
+
+func (c *Client) get(ctx context.Context, path string, query url.Values, out interface{}) error {
+	return c.do(ctx, http.MethodGet, path, query, nil, out, http.StatusOK)
+}
+
+// do sends the request and retries it on network errors, 429 and 5xx statuses.
+// The response body is decoded into out when it's not nil.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body []byte, out interface{}, expected ...int) error {
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	wait := c.retryWait
+	for attempt := 0; ; attempt++ {
+		err := c.attempt(ctx, method, path, u, body, out, expected)
+		if err == nil || attempt >= c.retries || !IsRetryable(err) || ctx.Err() != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+func (c *Client) attempt(ctx context.Context, method, path, u string, body []byte, out interface{}, expected []int) error {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.token))
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	for _, status := range expected {
+		if resp.StatusCode == status {
+			if out == nil {
+				_, err := io.Copy(ioutil.Discard, resp.Body)
+				return err
+			}
+			return json.NewDecoder(resp.Body).Decode(out)
+		}
+	}
+	apiErr := &APIError{Method: method, Path: path, StatusCode: resp.StatusCode}
+	var errBody struct {
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&errBody); err == nil {
+		apiErr.Message = errBody.Error
+	}
+	return apiErr
+}
+
+// IsRetryable returns true for network errors and the statuses that may succeed later
+func IsRetryable(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= http.StatusInternalServerError
+	}
+	return true
+}
+
+// endpoint replaces the `:param` segments of a route with the escaped params in order
+func endpoint(route string, params ...string) string {
+	segments := strings.Split(route, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") && len(params) > 0 {
+			segments[i] = url.PathEscape(params[0])
+			params = params[1:]
+		}
+	}
+	return strings.Join(segments, "/")
+}
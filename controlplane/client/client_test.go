@@ -0,0 +1,191 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	api "github.com/skillz/opvic/controlplane/api/v1alpha1"
+)
+
+func newTestServer() *httptest.Server {
+	routes := map[string]interface{}{
+		"/api/v1alpha1/agents": api.Agents{
+			{ID: "agent-1", Tags: map[string]string{"env": "prod"}},
+		},
+		"/api/v1alpha1/agents/agent-1/coredns/versions": api.VersionInfos{
+			ID: "coredns", AgentID: "agent-1", LatestVersion: "1.8.4", RunningVersions: []string{"1.8.0"},
+		},
+		"/api/v1alpha1/overview": []api.OverallVersionInfos{
+			{"coredns": []api.VersionInfos{{ID: "coredns", AgentID: "agent-1"}}},
+		},
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"invalid authorization token"}`)) // nolint: errcheck
+			return
+		}
+		body, ok := routes[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":"not found"}`)) // nolint: errcheck
+			return
+		}
+		json.NewEncoder(w).Encode(body) // nolint: errcheck
+	}))
+}
+
+func TestClient(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	c, err := New(Config{URL: server.URL + "/", Token: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	agents, err := c.Agents(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(agents.ListIDs(), []string{"agent-1"}) {
+		t.Errorf("Agents() = %v, want agent-1", agents.ListIDs())
+	}
+
+	infos, err := c.SubjectVersionInfos(ctx, "agent-1", "coredns")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if infos.LatestVersion != "1.8.4" {
+		t.Errorf("SubjectVersionInfos() latest = %s, want 1.8.4", infos.LatestVersion)
+	}
+
+	overview, err := c.Overview(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(overview) != 1 || len(overview[0]["coredns"]) != 1 {
+		t.Errorf("Overview() = %v, want a single coredns entry", overview)
+	}
+
+	if _, err := c.Agent(ctx, "agent-2"); !IsNotFound(err) {
+		t.Errorf("Agent() error = %v, want not found", err)
+	}
+
+	c.token = "wrong"
+	_, err = c.Agents(ctx)
+	if !IsUnauthorized(err) || !strings.Contains(err.Error(), "invalid authorization token") {
+		t.Errorf("Agents() error = %v, want the server error", err)
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		wantErr bool
+	}{
+		{name: "http", url: "http://localhost:8080"},
+		{name: "https", url: "https://opvic.example.com"},
+		{name: "missing_scheme", url: "localhost:8080", wantErr: true},
+		{name: "empty", url: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(Config{URL: tt.url}); (err != nil) != tt.wantErr {
+				t.Errorf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEndpoint(t *testing.T) {
+	got := endpoint(api.AgentsSubjectVersionInfoEndpoint, "agent 1", "core/dns")
+	want := "/api/v1alpha1/agents/agent%201/core%2Fdns/versions"
+	if got != want {
+		t.Errorf("endpoint() = %s, want %s", got, want)
+	}
+}
+
+func TestClientRetries(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Path {
+		case "/api/v1alpha1/agents":
+			var payload api.AgentPayload
+			if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.AgentID != "agent-1" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			// fail the first attempt to check that the body is sent again
+			if requests == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.WriteHeader(http.StatusAccepted)
+		case "/api/v1alpha1/agents/agent-1/coredns/history":
+			if r.URL.Query().Get("from") != "2021-09-01T00:00:00Z" || r.URL.Query().Get("to") != "" {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"error":"invalid from"}`)) // nolint: errcheck
+				return
+			}
+			json.NewEncoder(w).Encode(api.SubjectVersionHistory{ID: "coredns", AgentID: "agent-1"}) // nolint: errcheck
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	c, err := New(Config{URL: server.URL, RetryWait: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if err := c.PostAgent(ctx, api.AgentPayload{AgentID: "agent-1"}); err != nil {
+		t.Errorf("PostAgent() error = %v", err)
+	}
+	if requests != 2 {
+		t.Errorf("got %d requests, want the 503 to be retried once", requests)
+	}
+
+	requests = 0
+	from := time.Date(2021, 9, 1, 0, 0, 0, 0, time.UTC)
+	if _, err := c.SubjectVersionHistory(ctx, "agent-1", "coredns", from, time.Time{}); err != nil {
+		t.Errorf("SubjectVersionHistory() error = %v", err)
+	}
+	if _, err := c.SubjectVersionHistory(ctx, "agent-1", "coredns", time.Time{}, time.Time{}); !IsBadRequest(err) {
+		t.Errorf("SubjectVersionHistory() error = %v, want bad request", err)
+	}
+	if requests != 2 {
+		t.Errorf("got %d requests, want the 400 not to be retried", requests)
+	}
+
+	requests = 0
+	var apiErr *APIError
+	if err := c.Ping(ctx); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusInternalServerError {
+		t.Errorf("Ping() error = %v, want a 500", err)
+	}
+	if requests != DefaultRetries+1 {
+		t.Errorf("got %d requests, want %d", requests, DefaultRetries+1)
+	}
+
+	requests = 0
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := c.Ping(cancelled); !errors.Is(err, context.Canceled) {
+		t.Errorf("Ping() error = %v, want context canceled", err)
+	}
+	if requests != 0 {
+		t.Errorf("got %d requests, want none with a cancelled context", requests)
+	}
+}
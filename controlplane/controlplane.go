@@ -2,67 +2,135 @@ package controlplane
 
 import (
 	"context"
-	"fmt"
+	"crypto/tls"
+	"net/http"
 	"sync"
 	"time"
 
 	"github.com/go-logr/logr"
-	"github.com/patrickmn/go-cache"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/skillz/opvic/controlplane/advisory"
+	"github.com/skillz/opvic/controlplane/auth"
+	"github.com/skillz/opvic/controlplane/lifecycle"
+	"github.com/skillz/opvic/controlplane/notifier"
 	"github.com/skillz/opvic/controlplane/providers"
-	"github.com/skillz/opvic/controlplane/providers/github"
+	"github.com/skillz/opvic/controlplane/storage"
+	"github.com/skillz/opvic/controlplane/tlsconfig"
 )
 
 type Config struct {
 	BindAddr                string
+	TLS                     *tlsconfig.ServerConfig
 	Token                   *string
-	GithubConfig            *github.Config
+	CredentialsFile         string
+	CredentialsReload       time.Duration
+	JWT                     *auth.JWTConfig
 	CacheExpiration         time.Duration
+	StorageConfig           *storage.Config
+	NotifierConfig          *notifier.Config
+	AdvisoryConfig          *advisory.Config
 	CacheReconcilerInterval time.Duration
 	LogHttpRequests         bool
+	Dashboard               bool
 	Logger                  logr.Logger
 }
 
 type ControlPlane struct {
 	bindAddr                string
-	token                   *string
-	cache                   *cache.Cache
+	tlsConfig               *tls.Config
+	credentials             *auth.Store
+	store                   storage.Store
 	cacheExpiration         time.Duration
 	cacheReconcilerInterval time.Duration
 	provider                *providers.Provider
+	notifier                *notifier.Dispatcher
+	advisories              advisory.Source
+	lifecycle               *lifecycle.Resolver
 	mutex                   sync.RWMutex
 	logHttpsRequests        bool
+	dashboard               bool
 	log                     logr.Logger
 	reqCount                *prometheus.CounterVec
+	leader                  prometheus.Gauge
 }
 
 func (conf *Config) NewControlPlane() (*ControlPlane, error) {
 	log := conf.Logger
 	log.Info("initializing the control plane")
-	cache := cache.New(conf.CacheExpiration, cache.NoExpiration)
 	ctx := context.Background()
-	if conf.Token == nil {
-		return nil, fmt.Errorf("missing token")
+	authConf := auth.Config{
+		File:           conf.CredentialsFile,
+		ReloadInterval: conf.CredentialsReload,
+		JWT:            conf.JWT,
+		Logger:         log.WithName("auth"),
+	}
+	if conf.Token != nil {
+		authConf.SharedToken = *conf.Token
+	}
+	if conf.TLS.Enabled() && conf.TLS.ClientCAFile != "" {
+		authConf.ClientCertificates = true
+	}
+	credentials, err := authConf.NewStore()
+	if err != nil {
+		return nil, err
+	}
+	var tlsConfig *tls.Config
+	if conf.TLS.Enabled() {
+		conf.TLS.Logger = log.WithName("tls")
+		tlsConfig, err = conf.TLS.New()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	storageConf := conf.StorageConfig
+	if storageConf == nil {
+		storageConf = &storage.Config{Backend: storage.Memory}
+	}
+	storageConf.Expiration = conf.CacheExpiration
+	log.Info("initializing the storage", "backend", storageConf.Backend)
+	store, err := storageConf.NewStore()
+	if err != nil {
+		return nil, err
 	}
 
 	pConf := providers.Config{
 		Logger: log,
-		Github: conf.GithubConfig,
 	}
 	log.Info("initializing the remote providers")
-	provider, err := pConf.Init(ctx, cache)
+	provider, err := pConf.Init(ctx, store)
 	if err != nil {
+		store.Close()
 		return nil, err
 	}
+	var dispatcher *notifier.Dispatcher
+	if conf.NotifierConfig != nil {
+		conf.NotifierConfig.Logger = log
+		dispatcher = conf.NotifierConfig.NewDispatcher(store)
+	}
+	var advisories advisory.Source
+	if conf.AdvisoryConfig != nil {
+		conf.AdvisoryConfig.Logger = log
+		advisories, err = conf.AdvisoryConfig.NewSource(store)
+		if err != nil {
+			store.Close()
+			return nil, err
+		}
+	}
 	return &ControlPlane{
 		bindAddr:                conf.BindAddr,
-		token:                   conf.Token,
-		cache:                   cache,
+		tlsConfig:               tlsConfig,
+		credentials:             credentials,
+		store:                   store,
 		cacheExpiration:         conf.CacheExpiration,
 		cacheReconcilerInterval: conf.CacheReconcilerInterval,
 		provider:                provider,
+		notifier:                dispatcher,
+		advisories:              advisories,
+		lifecycle:               lifecycle.NewResolver(store, log),
 		mutex:                   sync.RWMutex{},
 		logHttpsRequests:        conf.LogHttpRequests,
+		dashboard:               conf.Dashboard,
 		log:                     log,
 		reqCount: prometheus.NewCounterVec(prometheus.CounterOpts{
 			Namespace: metricNamespace,
@@ -70,11 +138,17 @@ func (conf *Config) NewControlPlane() (*ControlPlane, error) {
 			Name:      "requests_total",
 			Help:      "The number of HTTP requests processed",
 		}, []string{"method", "path", "status"}),
+		leader: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: metricNamespace,
+			Subsystem: metricSubsystem,
+			Name:      "leader",
+			Help:      "Whether this replica holds the cache reconcile lock",
+		}),
 	}, nil
 }
 
 func (cp *ControlPlane) Start() {
-	prometheus.MustRegister(cp.reqCount)
+	prometheus.MustRegister(cp.reqCount, cp.leader)
 
 	cp.log.V(1).Info("setting up the routes")
 	r := cp.SetupRouter()
@@ -82,6 +156,28 @@ func (cp *ControlPlane) Start() {
 	cp.log.V(1).Info("starting the background cache reconciler")
 	go cp.executeCronJobs()
 
-	cp.log.Info("starting the HTTP server", "bind_addr", cp.bindAddr)
-	r.Run(cp.bindAddr)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go cp.credentials.Watch(ctx)
+
+	server := &http.Server{Addr: cp.bindAddr, Handler: r, TLSConfig: cp.tlsConfig}
+	var err error
+	if cp.tlsConfig != nil {
+		cp.log.Info("starting the HTTPS server", "bind_addr", cp.bindAddr)
+		// the certificate is served by the TLS config so it can be reloaded
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		cp.log.Info("starting the HTTP server", "bind_addr", cp.bindAddr)
+		err = server.ListenAndServe()
+	}
+	if err != nil {
+		cp.log.Error(err, "HTTP server stopped")
+	}
+	// let another replica take over the reconcile without waiting for the lock to expire
+	if err := storage.ReleaseLock(cp.store, cacheReconcileLock); err != nil {
+		cp.log.Error(err, "failed to release the cache reconcile lock")
+	}
+	if err := cp.store.Close(); err != nil {
+		cp.log.Error(err, "failed to close the storage")
+	}
 }
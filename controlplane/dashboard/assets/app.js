@@ -0,0 +1,243 @@
+(function () {
+  "use strict";
+
+  var API = "/api/v1alpha1";
+  var TOKEN_KEY = "opvic.token";
+  var REFRESH_INTERVAL = 60000;
+
+  var rows = [];
+
+  function $(id) {
+    return document.getElementById(id);
+  }
+
+  function el(tag, className, text) {
+    var node = document.createElement(tag);
+    if (className) {
+      node.className = className;
+    }
+    if (text !== undefined) {
+      node.textContent = text;
+    }
+    return node;
+  }
+
+  function badge(kind, text) {
+    return el("span", "badge " + kind, text);
+  }
+
+  function request(path) {
+    return fetch(API + path, {
+      headers: { Authorization: "Bearer " + localStorage.getItem(TOKEN_KEY) }
+    }).then(function (resp) {
+      if (resp.status === 401 || resp.status === 403) {
+        var err = new Error("invalid token");
+        err.unauthorized = true;
+        throw err;
+      }
+      if (!resp.ok) {
+        throw new Error(resp.status + " " + resp.statusText);
+      }
+      return resp.json();
+    });
+  }
+
+  // flatten the overview (a list of {subjectID: [infos per agent]}) into one row per subject and agent
+  function buildRows(overview, agents) {
+    var tags = {};
+    (agents || []).forEach(function (agent) {
+      tags[agent.id] = agent.tags || {};
+    });
+    var result = [];
+    (overview || []).forEach(function (entry) {
+      Object.keys(entry).forEach(function (subject) {
+        (entry[subject] || []).forEach(function (info) {
+          result.push({ subject: subject, info: info, tags: tags[info.agentId] || {} });
+        });
+      });
+    });
+    result.sort(function (a, b) {
+      return a.subject.localeCompare(b.subject) || a.info.agentId.localeCompare(b.info.agentId);
+    });
+    return result;
+  }
+
+  // parses "key=value,key2=value2" into a list of key/value pairs
+  function parseTags(text) {
+    return text.split(",").map(function (pair) {
+      return pair.trim();
+    }).filter(function (pair) {
+      return pair !== "";
+    }).map(function (pair) {
+      var i = pair.indexOf("=");
+      if (i < 0) {
+        return { key: pair, value: null };
+      }
+      return { key: pair.slice(0, i).trim(), value: pair.slice(i + 1).trim() };
+    });
+  }
+
+  function matchTags(tags, filters) {
+    return filters.every(function (f) {
+      if (!(f.key in tags)) {
+        return false;
+      }
+      return f.value === null || tags[f.key] === f.value;
+    });
+  }
+
+  function updates(info) {
+    var levels = { major: false, minor: false, patch: false };
+    (info.versions || []).forEach(function (v) {
+      levels.major = levels.major || v.majorAvailable;
+      levels.minor = levels.minor || v.minorAvailable;
+      levels.patch = levels.patch || v.patchAvailable;
+    });
+    return levels;
+  }
+
+  function isOutdated(info) {
+    var levels = updates(info);
+    return levels.major || levels.minor || levels.patch;
+  }
+
+  function renderUpdates(info) {
+    var cell = el("td");
+    var levels = updates(info);
+    ["major", "minor", "patch"].forEach(function (level) {
+      if (levels[level]) {
+        cell.appendChild(badge(level, level));
+      }
+    });
+    if (!cell.hasChildNodes()) {
+      cell.appendChild(badge("uptodate", "up to date"));
+    }
+    if (info.daysBehindLatest > 0) {
+      cell.appendChild(badge("info", info.daysBehindLatest + "d behind"));
+    }
+    (info.versions || []).forEach(function (v) {
+      if (v.supportStatus === "eol" || v.supportStatus === "nearingEOL") {
+        cell.appendChild(badge(v.supportStatus === "eol" ? "major" : "minor", v.currentVersion + " " + v.supportStatus));
+      }
+      if (v.advisories && v.advisories.length > 0) {
+        cell.appendChild(badge("major", v.currentVersion + ": " + v.advisories.length + " advisories"));
+      }
+    });
+    return cell;
+  }
+
+  function renderRow(row) {
+    var info = row.info;
+    var tr = el("tr");
+
+    tr.appendChild(el("td", null, row.subject));
+
+    var agent = el("td", null, info.agentId);
+    var tags = Object.keys(row.tags).sort().map(function (k) {
+      return k + "=" + row.tags[k];
+    });
+    if (tags.length > 0) {
+      agent.appendChild(el("div", "tags", tags.join(", ")));
+    }
+    tr.appendChild(agent);
+
+    tr.appendChild(el("td", null, (info.runningVersions || []).join(", ")));
+    tr.appendChild(el("td", null, String(info.resourceCount)));
+    tr.appendChild(el("td", null, info.latestVersion));
+    tr.appendChild(renderUpdates(info));
+
+    var provider = el("td", "provider", info.remoteProvider);
+    if (info.remoteRepo) {
+      provider.appendChild(el("div", null, info.remoteRepo));
+    }
+    tr.appendChild(provider);
+    return tr;
+  }
+
+  function render() {
+    var search = $("search").value.trim().toLowerCase();
+    var tagFilters = parseTags($("tags").value);
+    var outdated = $("outdated").checked;
+
+    var filtered = rows.filter(function (row) {
+      if (search && row.subject.toLowerCase().indexOf(search) < 0) {
+        return false;
+      }
+      if (outdated && !isOutdated(row.info)) {
+        return false;
+      }
+      return matchTags(row.tags, tagFilters);
+    });
+
+    var body = $("subjects");
+    while (body.firstChild) {
+      body.removeChild(body.firstChild);
+    }
+    filtered.forEach(function (row) {
+      body.appendChild(renderRow(row));
+    });
+    $("empty").hidden = filtered.length > 0;
+
+    var subjects = {};
+    var agents = {};
+    rows.forEach(function (row) {
+      subjects[row.subject] = true;
+      agents[row.info.agentId] = true;
+    });
+    $("summary").textContent = Object.keys(subjects).length + " subjects across " +
+      Object.keys(agents).length + " agents";
+  }
+
+  function showLogin(message) {
+    $("dashboard").hidden = true;
+    $("logout").hidden = true;
+    $("login").hidden = false;
+    $("login-error").textContent = message || "";
+    $("summary").textContent = "";
+  }
+
+  function load() {
+    return Promise.all([request("/overview"), request("/agents")]).then(function (res) {
+      rows = buildRows(res[0], res[1]);
+      $("login").hidden = true;
+      $("dashboard").hidden = false;
+      $("logout").hidden = false;
+      $("error").textContent = "";
+      render();
+    }).catch(function (err) {
+      if (err.unauthorized) {
+        localStorage.removeItem(TOKEN_KEY);
+        showLogin("The token was rejected by the control plane");
+        return;
+      }
+      $("error").textContent = "Failed to load the versions: " + err.message;
+    });
+  }
+
+  $("login-form").addEventListener("submit", function (e) {
+    e.preventDefault();
+    localStorage.setItem(TOKEN_KEY, $("token").value);
+    $("token").value = "";
+    load();
+  });
+  $("logout").addEventListener("click", function () {
+    localStorage.removeItem(TOKEN_KEY);
+    showLogin();
+  });
+  ["search", "tags"].forEach(function (id) {
+    $(id).addEventListener("input", render);
+  });
+  $("outdated").addEventListener("change", render);
+
+  setInterval(function () {
+    if (localStorage.getItem(TOKEN_KEY)) {
+      load();
+    }
+  }, REFRESH_INTERVAL);
+
+  if (localStorage.getItem(TOKEN_KEY)) {
+    load();
+  } else {
+    showLogin();
+  }
+})();
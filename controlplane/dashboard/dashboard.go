@@ -0,0 +1,44 @@
+package dashboard
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// AssetsPath is the route of the static files of the dashboard
+	AssetsPath  = "/assets"
+	FaviconPath = "/favicon.ico"
+)
+
+//go:embed assets
+var assets embed.FS
+
+// Register serves the dashboard at / and its static files at /assets.
+// The static files don't contain any data so they are served without authentication.
+// The dashboard asks for the API token and calls the API from the browser.
+func Register(r *gin.Engine) error {
+	static, err := fs.Sub(assets, "assets")
+	if err != nil {
+		return err
+	}
+	index, err := fs.ReadFile(static, "index.html")
+	if err != nil {
+		return err
+	}
+	favicon, err := fs.ReadFile(static, "favicon.svg")
+	if err != nil {
+		return err
+	}
+	r.StaticFS(AssetsPath, http.FS(static))
+	r.GET("/", func(c *gin.Context) {
+		c.Data(http.StatusOK, "text/html; charset=utf-8", index)
+	})
+	r.GET(FaviconPath, func(c *gin.Context) {
+		c.Data(http.StatusOK, "image/svg+xml", favicon)
+	})
+	return nil
+}
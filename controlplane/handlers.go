@@ -1,11 +1,14 @@
 package controlplane
 
 import (
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	api "github.com/skillz/opvic/controlplane/api/v1alpha1"
+	"github.com/skillz/opvic/controlplane/lifecycle"
 )
 
 // Metrics handler
@@ -27,6 +30,13 @@ func (cp *ControlPlane) AgentsPost() gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		if !authorizeAgent(c, ap.AgentID) {
+			return
+		}
+		if err := cp.validateSubjectVersion(ap.Version); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusAccepted, gin.H{"message": "data received"})
 		cp.log.V(1).Info(
 			"received agent payload",
@@ -37,6 +47,49 @@ func (cp *ControlPlane) AgentsPost() gin.HandlerFunc {
 			cp.UpdateAgentListCache(ap.AgentID, ap.AgentTags)
 			cp.UpdateAgentSubjectVersionsList(ap.AgentID, ap.Version.ID)
 			cp.SetSubjectVersionCache(ap.AgentID, ap.Version.ID, ap.Version)
+			cp.RecordSubjectVersionHistory(ap.AgentID, ap.Version, time.Now())
+		}()
+	}
+}
+
+// AgentBatchPost handles POST requests to /agents/:id/batch
+func (cp *ControlPlane) AgentBatchPost() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		agentID := c.Param("id")
+		if !authorizeAgent(c, agentID) {
+			return
+		}
+		var batch api.AgentBatchPayload
+		if err := c.ShouldBindJSON(&batch); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		for i, version := range batch.Versions {
+			if err := cp.validateSubjectVersion(version); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("versions[%d] (%s): %s", i, version.ID, err.Error())})
+				return
+			}
+		}
+		c.JSON(http.StatusAccepted, gin.H{"message": "data received"})
+		cp.log.V(1).Info(
+			"received agent batch",
+			"agent_id", agentID,
+			"versions", len(batch.Versions),
+			"subjects", len(batch.Subjects),
+		)
+		go func() {
+			now := time.Now()
+			versionIDs := make([]string, 0, len(batch.Versions))
+			cp.UpdateAgentListCache(agentID, batch.AgentTags)
+			for _, version := range batch.Versions {
+				versionIDs = append(versionIDs, version.ID)
+				cp.SetSubjectVersionCache(agentID, version.ID, version)
+				cp.RecordSubjectVersionHistory(agentID, version, now)
+			}
+			removed := cp.SyncAgentSubjectVersionsList(agentID, versionIDs, batch.Subjects)
+			if len(removed) > 0 {
+				cp.log.Info("removed the subjects that are no longer tracked by the agent", "agent_id", agentID, "subjects", removed)
+			}
 		}()
 	}
 }
@@ -73,6 +126,24 @@ func (cp *ControlPlane) AgentsSubjectVersionGet() gin.HandlerFunc {
 	}
 }
 
+// AgentsSubjectVersionDelete handles DELETE requests to /agents/:id/:versionId
+// The subject is removed right away so it's no longer served after its VersionTracker is deleted
+func (cp *ControlPlane) AgentsSubjectVersionDelete() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		agentID := c.Param("id")
+		versionID := c.Param("versionId")
+		if !authorizeAgent(c, agentID) {
+			return
+		}
+		if !cp.RemoveAgentSubjectVersion(agentID, versionID) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+			return
+		}
+		cp.log.Info("removed the subject deleted by the agent", "agent_id", agentID, "version_id", versionID)
+		c.JSON(http.StatusOK, gin.H{"message": "deleted"})
+	}
+}
+
 // AgentsSubjectVersionGet handles GET requests to /agents/:id/versionId:/versions
 func (cp *ControlPlane) AgentsSubjectVersionsInfoGet() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -89,6 +160,38 @@ func (cp *ControlPlane) AgentsSubjectVersionsInfoGet() gin.HandlerFunc {
 	}
 }
 
+// AgentsSubjectVersionHistoryGet handles GET requests to /agents/:id/versionId:/history
+// The optional from and to query parameters (RFC3339) limit the history to a time range
+func (cp *ControlPlane) AgentsSubjectVersionHistoryGet() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		agentID := c.Param("id")
+		versionID := c.Param("versionId")
+
+		var from, to int64
+		for param, value := range map[string]*int64{"from": &from, "to": &to} {
+			if q := c.Query(param); q != "" {
+				t, err := time.Parse(time.RFC3339, q)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid %s: %s", param, err.Error())})
+					return
+				}
+				*value = t.Unix()
+			}
+		}
+		if from != 0 && to != 0 && from > to {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to"})
+			return
+		}
+
+		history, found := cp.GetSubjectVersionHistoryCache(agentID, versionID)
+		if !found {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+			return
+		}
+		c.JSON(http.StatusOK, history.Between(from, to))
+	}
+}
+
 // OverviewGet handles GET requests to /overview
 func (cp *ControlPlane) OverviewGet() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -96,3 +199,14 @@ func (cp *ControlPlane) OverviewGet() gin.HandlerFunc {
 		c.JSON(http.StatusOK, oveview)
 	}
 }
+
+// validateSubjectVersion checks the remote version configuration sent by an agent
+func (cp *ControlPlane) validateSubjectVersion(version api.SubjectVersion) error {
+	if err := cp.provider.Validate(version.RemoteVersion); err != nil {
+		return fmt.Errorf("invalid remoteVersion: %w", err)
+	}
+	if err := lifecycle.Validate(version.RemoteVersion.Lifecycle); err != nil {
+		return fmt.Errorf("invalid remoteVersion.lifecycle: %w", err)
+	}
+	return nil
+}
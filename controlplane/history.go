@@ -0,0 +1,117 @@
+package controlplane
+
+import (
+	"sort"
+	"time"
+
+	"github.com/skillz/opvic/agent/api/v1alpha1"
+	api "github.com/skillz/opvic/controlplane/api/v1alpha1"
+)
+
+// maximum number of entries kept in the history of a subject
+const maxHistoryEntries = 100
+
+func (cp *ControlPlane) SetSubjectVersionHistoryCache(agentID, versionID string, history api.SubjectVersionHistory) {
+	cp.setState(SubjectVersionHistoryCacheKey(agentID, versionID), history)
+}
+
+func (cp *ControlPlane) GetSubjectVersionHistoryCache(agentID, versionID string) (api.SubjectVersionHistory, bool) {
+	history := api.SubjectVersionHistory{}
+	if !cp.getState(SubjectVersionHistoryCacheKey(agentID, versionID), &history) {
+		return api.SubjectVersionHistory{}, false
+	}
+	return history, true
+}
+
+// RecordSubjectVersionHistory adds a history entry when the running versions of the subject change.
+// Otherwise it extends the last entry up to now.
+func (cp *ControlPlane) RecordSubjectVersionHistory(agentID string, subjectVersion api.SubjectVersion, now time.Time) {
+	history, found := cp.GetSubjectVersionHistoryCache(agentID, subjectVersion.ID)
+	if !found {
+		history = api.SubjectVersionHistory{
+			ID:      subjectVersion.ID,
+			AgentID: agentID,
+		}
+	}
+	running := append([]string{}, subjectVersion.RunningVersions...)
+	sort.Strings(running)
+
+	last := len(history.History) - 1
+	if last >= 0 && equalStrings(history.History[last].RunningVersions, running) {
+		history.History[last].LastSeen = now.Unix()
+	} else {
+		if last >= 0 {
+			cp.log.V(1).Info(
+				"running versions changed",
+				"agent_id", agentID,
+				"version_id", subjectVersion.ID,
+				"from", history.History[last].RunningVersions,
+				"to", running,
+			)
+		}
+		history.History = append(history.History, api.HistoryEntry{
+			RunningVersions: running,
+			FirstSeen:       now.Unix(),
+			LastSeen:        now.Unix(),
+		})
+		if len(history.History) > maxHistoryEntries {
+			history.History = history.History[len(history.History)-maxHistoryEntries:]
+		}
+	}
+	cp.SetSubjectVersionHistoryCache(agentID, subjectVersion.ID, history)
+}
+
+// UpdateRemoteVersionsFirstSeen records the time that the control plane first saw each remote version
+// and returns the unix time that each version was released. The publication date of the provider
+// is used when it is known, otherwise the time that the version was first seen
+func (cp *ControlPlane) UpdateRemoteVersionsFirstSeen(conf v1alpha1.RemoteVersion, versions []string, published map[string]int64, now time.Time) map[string]int64 {
+	key := RemoteVersionsFirstSeenCacheKey(conf)
+	firstSeen := map[string]int64{}
+	cp.getState(key, &firstSeen)
+	updated := false
+	released := map[string]int64{}
+	for _, v := range versions {
+		if date, found := published[v]; found {
+			released[v] = date
+			continue
+		}
+		if _, found := firstSeen[v]; !found {
+			firstSeen[v] = now.Unix()
+			updated = true
+		}
+		released[v] = firstSeen[v]
+	}
+	if updated {
+		// the first seen times must outlive the cache expiration or the versions would look new again
+		if err := cp.store.SetWithExpiration(key, firstSeen, 0); err != nil {
+			cp.log.WithName("storage").Error(err, "failed to store the value", "key", key)
+		}
+	}
+	return released
+}
+
+// daysBehindLatest returns the number of days since the earliest of the newer versions was released
+func daysBehindLatest(released map[string]int64, newer []string, now time.Time) int {
+	var earliest int64
+	for _, v := range newer {
+		if seen, found := released[v]; found && (earliest == 0 || seen < earliest) {
+			earliest = seen
+		}
+	}
+	if earliest == 0 {
+		return 0
+	}
+	return int(now.Sub(time.Unix(earliest, 0)).Hours() / 24)
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
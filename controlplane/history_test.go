@@ -0,0 +1,145 @@
+package controlplane
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/skillz/opvic/agent/api/v1alpha1"
+	api "github.com/skillz/opvic/controlplane/api/v1alpha1"
+	"github.com/skillz/opvic/controlplane/storage"
+)
+
+func newTestControlPlane() *ControlPlane {
+	return &ControlPlane{
+		store: storage.NewMemoryStore(0),
+		log:   logr.Discard(),
+	}
+}
+
+func TestRecordSubjectVersionHistory(t *testing.T) {
+	cp := newTestControlPlane()
+	start := time.Unix(1639773192, 0)
+	payloads := []struct {
+		running []string
+		at      time.Time
+	}{
+		{running: []string{"1.7.0"}, at: start},
+		{running: []string{"1.7.0"}, at: start.Add(time.Hour)},
+		{running: []string{"1.8.0", "1.7.0"}, at: start.Add(2 * time.Hour)},
+		{running: []string{"1.7.0", "1.8.0"}, at: start.Add(3 * time.Hour)},
+		{running: []string{"1.8.0"}, at: start.Add(4 * time.Hour)},
+	}
+	for _, p := range payloads {
+		cp.RecordSubjectVersionHistory("agent", api.SubjectVersion{ID: "coredns", RunningVersions: p.running}, p.at)
+	}
+	history, found := cp.GetSubjectVersionHistoryCache("agent", "coredns")
+	if !found {
+		t.Fatal("history not found")
+	}
+	want := []api.HistoryEntry{
+		{RunningVersions: []string{"1.7.0"}, FirstSeen: start.Unix(), LastSeen: start.Add(time.Hour).Unix()},
+		{RunningVersions: []string{"1.7.0", "1.8.0"}, FirstSeen: start.Add(2 * time.Hour).Unix(), LastSeen: start.Add(3 * time.Hour).Unix()},
+		{RunningVersions: []string{"1.8.0"}, FirstSeen: start.Add(4 * time.Hour).Unix(), LastSeen: start.Add(4 * time.Hour).Unix()},
+	}
+	if !reflect.DeepEqual(history.History, want) {
+		t.Errorf("History = %v, want %v", history.History, want)
+	}
+
+	tests := []struct {
+		name     string
+		from, to int64
+		want     int
+	}{
+		{name: "open", want: 3},
+		{name: "from", from: start.Add(150 * time.Minute).Unix(), want: 2},
+		{name: "to", to: start.Add(30 * time.Minute).Unix(), want: 1},
+		{name: "range", from: start.Add(90 * time.Minute).Unix(), to: start.Add(150 * time.Minute).Unix(), want: 1},
+		{name: "after", from: start.Add(5 * time.Hour).Unix(), want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := history.Between(tt.from, tt.to).History; len(got) != tt.want {
+				t.Errorf("Between() = %v, want %d entries", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDaysBehindLatest(t *testing.T) {
+	cp := newTestControlPlane()
+	start := time.Unix(1639773192, 0)
+	conf := v1alpha1.RemoteVersion{Provider: "github", Repo: "coredns/coredns", Strategy: v1alpha1.GithubStrategyTags}
+	cp.UpdateRemoteVersionsFirstSeen(conf, []string{"1.7.0", "1.7.1"}, nil, start)
+	released := cp.UpdateRemoteVersionsFirstSeen(conf, []string{"1.7.0", "1.7.1", "1.8.0"}, nil, start.Add(10*24*time.Hour))
+	now := start.Add(30 * 24 * time.Hour)
+
+	tests := []struct {
+		name  string
+		newer []string
+		want  int
+	}{
+		{name: "latest", newer: []string{}, want: 0},
+		{name: "newer_since_first_run", newer: []string{"1.7.1", "1.8.0"}, want: 30},
+		{name: "newer_since_later_run", newer: []string{"1.8.0"}, want: 20},
+		{name: "unknown", newer: []string{"2.0.0"}, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := daysBehindLatest(released, tt.newer, now); got != tt.want {
+				t.Errorf("daysBehindLatest() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateRemoteVersionsFirstSeen(t *testing.T) {
+	start := time.Unix(1639773192, 0)
+	later := start.Add(24 * time.Hour)
+	chart := func(name string) v1alpha1.RemoteVersion {
+		return v1alpha1.RemoteVersion{Provider: "helm", Repo: "https://charts.example.com", Chart: name, Strategy: v1alpha1.HelmStrategyChartVersion}
+	}
+	tests := []struct {
+		name      string
+		conf      v1alpha1.RemoteVersion
+		versions  []string
+		published map[string]int64
+		want      map[string]int64
+	}{
+		{
+			name:     "first_seen_of_the_chart",
+			conf:     chart("a"),
+			versions: []string{"1.2.0"},
+			want:     map[string]int64{"1.2.0": start.Unix()},
+		},
+		{
+			// the same version of another chart of the repository is new
+			name:     "first_seen_of_another_chart",
+			conf:     chart("b"),
+			versions: []string{"1.2.0"},
+			want:     map[string]int64{"1.2.0": later.Unix()},
+		},
+		{
+			name:      "publication_date",
+			conf:      chart("a"),
+			versions:  []string{"1.2.0", "1.3.0"},
+			published: map[string]int64{"1.3.0": 1600000000},
+			want:      map[string]int64{"1.2.0": start.Unix(), "1.3.0": 1600000000},
+		},
+	}
+	cp := &ControlPlane{
+		// the first seen times must not expire with the other keys
+		store: storage.NewMemoryStore(time.Millisecond),
+		log:   logr.Discard(),
+	}
+	cp.UpdateRemoteVersionsFirstSeen(chart("a"), []string{"1.2.0"}, nil, start)
+	time.Sleep(10 * time.Millisecond)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cp.UpdateRemoteVersionsFirstSeen(tt.conf, tt.versions, tt.published, later); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("UpdateRemoteVersionsFirstSeen() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package lifecycle
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/hashicorp/go-version"
+	"github.com/skillz/opvic/agent/api/v1alpha1"
+	"github.com/skillz/opvic/controlplane/storage"
+)
+
+const (
+	// StatusSupported means the release cycle of the running version has not reached its end of life
+	StatusSupported = "supported"
+	// StatusNearingEOL means the end of life date of the release cycle is within the nearingEOLDays window
+	StatusNearingEOL = "nearingEOL"
+	// StatusEOL means the release cycle has reached its end of life
+	StatusEOL = "eol"
+	// StatusUnknown means no release cycle matches the running version
+	StatusUnknown = "unknown"
+
+	// DefaultNearingEOLDays is used when the lifecycle doesn't set nearingEOLDays
+	DefaultNearingEOLDays = 90
+
+	dateLayout = "2006-01-02"
+)
+
+// Cycle is a release line with its end of life
+type Cycle struct {
+	Cycle string `json:"cycle"`
+	// End of life date. Zero if the date is unknown
+	EOL time.Time `json:"eol"`
+	// Ended is true if the cycle reached its end of life, even if the date is unknown
+	Ended bool `json:"ended"`
+}
+
+// Support is the support status of a running version
+type Support struct {
+	Status string
+	// End of life date in YYYY-MM-DD format. Empty if unknown
+	EOLDate string
+	// Days until the end of life date. Negative once the date has passed. Nil if the date is unknown
+	EOLDays *int
+}
+
+// feedCycle is an item of an endoflife.date style feed. eol is either a date or a boolean
+type feedCycle struct {
+	Cycle interface{} `json:"cycle"`
+	EOL   interface{} `json:"eol"`
+}
+
+// Resolver gets the release cycles from the lifecycle configurations
+type Resolver struct {
+	client *http.Client
+	store  storage.Store
+	log    logr.Logger
+}
+
+func NewResolver(store storage.Store, logger logr.Logger) *Resolver {
+	return &Resolver{
+		client: &http.Client{Timeout: 30 * time.Second},
+		store:  store,
+		log:    logger.WithName("lifecycle"),
+	}
+}
+
+// Validate checks the lifecycle configuration
+func Validate(conf v1alpha1.Lifecycle) error {
+	if conf.URL != "" && len(conf.Cycles) > 0 {
+		return fmt.Errorf("only one of url or cycles can be set")
+	}
+	if conf.URL != "" && !strings.HasPrefix(conf.URL, "http://") && !strings.HasPrefix(conf.URL, "https://") {
+		return fmt.Errorf("url must start with http:// or https://")
+	}
+	for _, c := range conf.Cycles {
+		if c.Cycle == "" {
+			return fmt.Errorf("cycle is required")
+		}
+		if _, err := time.Parse(dateLayout, c.EOL); err != nil {
+			return fmt.Errorf("invalid eol date of cycle %s: %v", c.Cycle, err)
+		}
+	}
+	return nil
+}
+
+// Enabled returns true if the lifecycle configuration has a source of release cycles
+func Enabled(conf v1alpha1.Lifecycle) bool {
+	return conf.URL != "" || len(conf.Cycles) > 0
+}
+
+// GetCycles returns the inline cycles or the cycles of the feed
+func (r *Resolver) GetCycles(conf v1alpha1.Lifecycle) ([]Cycle, error) {
+	if err := Validate(conf); err != nil {
+		return nil, err
+	}
+	if conf.URL == "" {
+		var cycles []Cycle
+		for _, c := range conf.Cycles {
+			eol, _ := time.Parse(dateLayout, c.EOL)
+			cycles = append(cycles, Cycle{Cycle: c.Cycle, EOL: eol})
+		}
+		return cycles, nil
+	}
+	return r.getFeed(conf.URL)
+}
+
+func cacheKey(url string) string {
+	return fmt.Sprintf("lifecycle/%s", url)
+}
+
+func (r *Resolver) getFeed(url string) ([]Cycle, error) {
+	var cycles []Cycle
+	if found, err := r.store.Get(cacheKey(url), &cycles); err == nil && found {
+		return cycles, nil
+	}
+	r.log.V(1).Info("getting lifecycle feed", "url", url)
+	resp, err := r.client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d from %s", resp.StatusCode, url)
+	}
+	var feed []feedCycle
+	if err := json.NewDecoder(resp.Body).Decode(&feed); err != nil {
+		return nil, fmt.Errorf("failed to decode the lifecycle feed %s: %v", url, err)
+	}
+	cycles, err = parseFeed(feed)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.store.Set(cacheKey(url), cycles); err != nil {
+		r.log.Error(err, "failed to cache the lifecycle feed", "url", url)
+	}
+	return cycles, nil
+}
+
+func parseFeed(feed []feedCycle) ([]Cycle, error) {
+	var cycles []Cycle
+	for _, f := range feed {
+		c := Cycle{Cycle: strings.TrimSpace(fmt.Sprint(f.Cycle))}
+		switch eol := f.EOL.(type) {
+		case string:
+			date, err := time.Parse(dateLayout, eol)
+			if err != nil {
+				return nil, fmt.Errorf("invalid eol date of cycle %s: %v", c.Cycle, err)
+			}
+			c.EOL = date
+		case bool:
+			c.Ended = eol
+		}
+		cycles = append(cycles, c)
+	}
+	return cycles, nil
+}
+
+// Match returns the cycle with the most segments that are a prefix of the running version
+func Match(cycles []Cycle, running string) (Cycle, bool) {
+	ver, err := version.NewVersion(running)
+	if err != nil {
+		return Cycle{}, false
+	}
+	segments := ver.Segments()
+	var match Cycle
+	matchLen := 0
+	for _, c := range cycles {
+		cv, err := version.NewVersion(c.Cycle)
+		if err != nil {
+			continue
+		}
+		// NewVersion pads the segments to three so count the segments of the cycle itself
+		n := len(strings.Split(strings.TrimPrefix(c.Cycle, "v"), "."))
+		if n > len(segments) || n <= matchLen {
+			continue
+		}
+		prefix := true
+		for i := 0; i < n; i++ {
+			if cv.Segments()[i] != segments[i] {
+				prefix = false
+				break
+			}
+		}
+		if prefix {
+			match = c
+			matchLen = n
+		}
+	}
+	return match, matchLen > 0
+}
+
+// GetSupport returns the support status of the running version at the time now
+func GetSupport(cycles []Cycle, running string, nearingEOLDays int, now time.Time) Support {
+	if nearingEOLDays <= 0 {
+		nearingEOLDays = DefaultNearingEOLDays
+	}
+	cycle, found := Match(cycles, running)
+	if !found {
+		return Support{Status: StatusUnknown}
+	}
+	if cycle.EOL.IsZero() {
+		if cycle.Ended {
+			return Support{Status: StatusEOL}
+		}
+		return Support{Status: StatusSupported}
+	}
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	days := int(cycle.EOL.Sub(today).Hours() / 24)
+	support := Support{
+		EOLDate: cycle.EOL.Format(dateLayout),
+		EOLDays: &days,
+	}
+	switch {
+	case days <= 0:
+		support.Status = StatusEOL
+	case days <= nearingEOLDays:
+		support.Status = StatusNearingEOL
+	default:
+		support.Status = StatusSupported
+	}
+	return support
+}
@@ -0,0 +1,107 @@
+package lifecycle
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/skillz/opvic/agent/api/v1alpha1"
+	"github.com/skillz/opvic/controlplane/storage"
+)
+
+const testFeed = `[
+  {"cycle": "1.22", "releaseDate": "2021-08-04", "eol": "2022-10-28", "latest": "1.22.4"},
+  {"cycle": "1.21", "releaseDate": "2021-04-08", "eol": "2022-06-28", "latest": "1.21.7"},
+  {"cycle": "1.20", "releaseDate": "2020-12-08", "eol": "2022-02-28", "latest": "1.20.13"},
+  {"cycle": "1.19", "releaseDate": "2020-08-26", "eol": true, "latest": "1.19.16"},
+  {"cycle": "1", "releaseDate": "2015-07-21", "eol": false, "latest": "1.22.4"}
+]`
+
+func TestGetSupport(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(testFeed)) // nolint: errcheck
+	}))
+	defer server.Close()
+
+	r := NewResolver(storage.NewMemoryStore(0), logr.Discard())
+	cycles, err := r.GetCycles(v1alpha1.Lifecycle{URL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.GetCycles(v1alpha1.Lifecycle{URL: server.URL}); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 1 {
+		t.Errorf("got %d requests, want the feed to be cached", requests)
+	}
+
+	now := time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		running string
+		status  string
+		eolDate string
+		eolDays int
+	}{
+		{running: "1.22.3", status: StatusSupported, eolDate: "2022-10-28", eolDays: 180},
+		{running: "1.21.1", status: StatusNearingEOL, eolDate: "2022-06-28", eolDays: 58},
+		{running: "1.20.13", status: StatusEOL, eolDate: "2022-02-28", eolDays: -62},
+		{running: "1.19.0", status: StatusEOL},
+		// only the major cycle matches
+		{running: "1.23.0", status: StatusSupported},
+		{running: "2.0.0", status: StatusUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.running, func(t *testing.T) {
+			got := GetSupport(cycles, tt.running, 90, now)
+			if got.Status != tt.status || got.EOLDate != tt.eolDate {
+				t.Errorf("GetSupport() = %+v, want status %s and eol date %q", got, tt.status, tt.eolDate)
+			}
+			if tt.eolDate != "" && (got.EOLDays == nil || *got.EOLDays != tt.eolDays) {
+				t.Errorf("GetSupport() eolDays = %v, want %d", got.EOLDays, tt.eolDays)
+			}
+			if tt.eolDate == "" && got.EOLDays != nil {
+				t.Errorf("GetSupport() eolDays = %d, want nil", *got.EOLDays)
+			}
+		})
+	}
+}
+
+func TestGetCyclesInline(t *testing.T) {
+	r := NewResolver(storage.NewMemoryStore(0), logr.Discard())
+	cycles, err := r.GetCycles(v1alpha1.Lifecycle{
+		Cycles: []v1alpha1.Cycle{{Cycle: "1.8", EOL: "2022-01-01"}, {Cycle: "1.9", EOL: "2023-01-01"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := GetSupport(cycles, "1.8.6", 0, time.Date(2021, 12, 1, 0, 0, 0, 0, time.UTC))
+	if got.Status != StatusNearingEOL || got.EOLDate != "2022-01-01" {
+		t.Errorf("GetSupport() = %+v, want nearingEOL with the default window", got)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		conf    v1alpha1.Lifecycle
+		wantErr bool
+	}{
+		{name: "empty", conf: v1alpha1.Lifecycle{}},
+		{name: "url", conf: v1alpha1.Lifecycle{URL: "https://endoflife.date/api/kubernetes.json"}},
+		{name: "cycles", conf: v1alpha1.Lifecycle{Cycles: []v1alpha1.Cycle{{Cycle: "1.21", EOL: "2022-06-28"}}}},
+		{name: "url_without_scheme", conf: v1alpha1.Lifecycle{URL: "endoflife.date/api/kubernetes.json"}, wantErr: true},
+		{name: "url_and_cycles", conf: v1alpha1.Lifecycle{URL: "https://endoflife.date/api/kubernetes.json", Cycles: []v1alpha1.Cycle{{Cycle: "1.21", EOL: "2022-06-28"}}}, wantErr: true},
+		{name: "invalid_date", conf: v1alpha1.Lifecycle{Cycles: []v1alpha1.Cycle{{Cycle: "1.21", EOL: "28/06/2022"}}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Validate(tt.conf); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
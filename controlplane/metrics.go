@@ -12,7 +12,7 @@ const (
 )
 
 var (
-	commonLabels = []string{"version_id", "agent_id", "running_version", "resource_kind", "remote_provider", "remote_repo"}
+	commonLabels = []string{"version_id", "agent_id", "running_version", "resource_kind", "remote_provider", "remote_repo", "container"}
 )
 
 func newMetric(metricName string, docString string, commonLabelsNames []string, labelNames []string) *prometheus.Desc {
@@ -25,6 +25,9 @@ var (
 	availableMajorVersionMetric = newMetric("major_versions_count", "Number of available major versions to upgrade to", commonLabels, []string{"available_major_versions"})
 	availableMinorVersionMetric = newMetric("minor_versions_count", "Number of available minor versions to upgrade to", commonLabels, []string{"available_minor_versions"})
 	availablePatchVersionMetric = newMetric("patch_versions_count", "Number of available patch versions to upgrade to", commonLabels, []string{"available_patch_versions"})
+	daysBehindLatestMetric      = newMetric("days_behind_latest", "Number of days since the first newer version than the running version was released", commonLabels, []string{})
+	eolDaysMetric               = newMetric("version_eol_days", "Number of days until the end of life of the release cycle of the running version", commonLabels, []string{"support_status", "eol_date"})
+	vulnerabilitiesMetric       = newMetric("vulnerabilities_count", "Number of known security advisories of the running version", commonLabels, []string{"advisories", "fixed_in"})
 
 	agentMetric = newMetric("agent_last_heartbeat", "Last time the agent was seen", []string{}, []string{"agent_id", "tags"})
 )
@@ -34,6 +37,9 @@ func (cp *ControlPlane) Describe(ch chan<- *prometheus.Desc) {
 	ch <- availableMajorVersionMetric
 	ch <- availableMinorVersionMetric
 	ch <- availablePatchVersionMetric
+	ch <- daysBehindLatestMetric
+	ch <- vulnerabilitiesMetric
+	ch <- eolDaysMetric
 }
 
 func (cp *ControlPlane) Collect(ch chan<- prometheus.Metric) {
@@ -65,10 +71,50 @@ func (cp *ControlPlane) setVersionMetrics(ch chan<- prometheus.Metric) {
 						v.ResourceKind,
 						versionInfos.RemoteProvider,
 						versionInfos.RemoteRepo,
+						v.ContainerName,
 						v.ExtractedFrom,
 						v.LatestVersion,
 					)
 
+					// the support window and the advisories don't depend on the remote versions
+					if v.EOLDays != nil {
+						ch <- prometheus.MustNewConstMetric(
+							eolDaysMetric,
+							prometheus.GaugeValue,
+							float64(*v.EOLDays),
+							versionInfos.ID,
+							versionInfos.AgentID,
+							v.RunningVersion,
+							v.ResourceKind,
+							versionInfos.RemoteProvider,
+							versionInfos.RemoteRepo,
+							v.ContainerName,
+							v.SupportStatus,
+							v.EOLDate,
+						)
+					}
+
+					if v.Advisories != nil {
+						var ids []string
+						for _, a := range v.Advisories {
+							ids = append(ids, a.ID)
+						}
+						ch <- prometheus.MustNewConstMetric(
+							vulnerabilitiesMetric,
+							prometheus.GaugeValue,
+							float64(len(v.Advisories)),
+							versionInfos.ID,
+							versionInfos.AgentID,
+							v.RunningVersion,
+							v.ResourceKind,
+							versionInfos.RemoteProvider,
+							versionInfos.RemoteRepo,
+							v.ContainerName,
+							strings.Join(ids, ","),
+							strings.Join(v.FixedIn, ","),
+						)
+					}
+
 					//  Don't set available major,minor and patch metrics if latest is missing
 					if v.LatestVersion == MissingLatest {
 						continue
@@ -84,6 +130,7 @@ func (cp *ControlPlane) setVersionMetrics(ch chan<- prometheus.Metric) {
 						v.ResourceKind,
 						versionInfos.RemoteProvider,
 						versionInfos.RemoteRepo,
+						v.ContainerName,
 						strings.Join(v.AvailableMajors, ","),
 					)
 					ch <- prometheus.MustNewConstMetric(
@@ -96,6 +143,7 @@ func (cp *ControlPlane) setVersionMetrics(ch chan<- prometheus.Metric) {
 						v.ResourceKind,
 						versionInfos.RemoteProvider,
 						versionInfos.RemoteRepo,
+						v.ContainerName,
 						strings.Join(v.AvailableMinors, ","),
 					)
 					ch <- prometheus.MustNewConstMetric(
@@ -108,8 +156,21 @@ func (cp *ControlPlane) setVersionMetrics(ch chan<- prometheus.Metric) {
 						v.ResourceKind,
 						versionInfos.RemoteProvider,
 						versionInfos.RemoteRepo,
+						v.ContainerName,
 						strings.Join(v.AvailablePatches, ","),
 					)
+					ch <- prometheus.MustNewConstMetric(
+						daysBehindLatestMetric,
+						prometheus.GaugeValue,
+						float64(v.DaysBehindLatest),
+						versionInfos.ID,
+						versionInfos.AgentID,
+						v.RunningVersion,
+						v.ResourceKind,
+						versionInfos.RemoteProvider,
+						versionInfos.RemoteRepo,
+						v.ContainerName,
+					)
 				}
 			}
 		}
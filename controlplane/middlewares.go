@@ -13,11 +13,23 @@ import (
 
 	"github.com/gin-gonic/gin"
 	api "github.com/skillz/opvic/controlplane/api/v1alpha1"
+	"github.com/skillz/opvic/controlplane/auth"
 )
 
+// identityKey is the key of the authenticated identity in the gin context
+const identityKey = "opvic.identity"
+
 func (cp *ControlPlane) AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		reqToken := c.Request.Header.Get("Authorization")
+		// agents can authenticate with a client certificate verified by the TLS server instead of a token
+		if reqToken == "" && c.Request.TLS != nil && len(c.Request.TLS.VerifiedChains) > 0 {
+			if identity, ok := auth.CertificateIdentity(c.Request.TLS.VerifiedChains[0][0]); ok {
+				c.Set(identityKey, identity)
+				c.Next()
+				return
+			}
+		}
 		if reqToken == "" {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
 				"error": "missing authorization header",
@@ -31,16 +43,53 @@ func (cp *ControlPlane) AuthMiddleware() gin.HandlerFunc {
 			})
 			return
 		}
-		if token[1] != *cp.token {
+		identity, found := cp.credentials.Authenticate(token[1])
+		if !found {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
 				"error": "invalid authorization token",
 			})
 			return
 		}
+		c.Set(identityKey, identity)
 		c.Next()
 	}
 }
 
+// ReadMiddleware rejects the callers without the read scope
+func ReadMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		identity := identityFromContext(c)
+		if identity == nil || !identity.CanRead() {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": fmt.Sprintf("the %s scope is required", auth.ScopeRead),
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// authorizeAgent aborts the request if the caller can't write the subject versions of the agent
+func authorizeAgent(c *gin.Context, agentID string) bool {
+	identity := identityFromContext(c)
+	if identity == nil || !identity.CanWriteAgent(agentID) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": fmt.Sprintf("not allowed to write the subject versions of agent %s", agentID),
+		})
+		return false
+	}
+	return true
+}
+
+func identityFromContext(c *gin.Context) *auth.Identity {
+	value, found := c.Get(identityKey)
+	if !found {
+		return nil
+	}
+	identity, _ := value.(*auth.Identity)
+	return identity
+}
+
 func HeadersMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Writer.Header().Set("Content-Type", "application/json")
@@ -0,0 +1,72 @@
+package controlplane
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-logr/logr"
+
+	api "github.com/skillz/opvic/controlplane/api/v1alpha1"
+	"github.com/skillz/opvic/controlplane/auth"
+)
+
+func TestAuthorization(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	path := filepath.Join(t.TempDir(), "tokens.yaml")
+	credentials := `
+tokens:
+  - name: prod-agent
+    token: prod-token
+    scopes: ["agent:prod:write"]
+  - name: dashboard
+    token: dashboard-token
+    scopes: ["read"]
+`
+	if err := ioutil.WriteFile(path, []byte(credentials), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	authConf := auth.Config{SharedToken: "shared-token", File: path, Logger: logr.Discard()}
+	store, err := authConf.NewStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp := newTestControlPlane()
+	cp.credentials = store
+	r := cp.SetupRouter()
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		token      string
+		wantStatus int
+	}{
+		{name: "missing_token", method: http.MethodGet, path: api.AgentsAPIEndpoint, wantStatus: http.StatusUnauthorized},
+		{name: "invalid_token", method: http.MethodGet, path: api.AgentsAPIEndpoint, token: "invalid", wantStatus: http.StatusUnauthorized},
+		{name: "ping_without_scope", method: http.MethodGet, path: api.PingAPIEndpoint, token: "prod-token", wantStatus: http.StatusOK},
+		{name: "read_scope", method: http.MethodGet, path: api.AgentsAPIEndpoint, token: "dashboard-token", wantStatus: http.StatusOK},
+		{name: "agent_token_cannot_read", method: http.MethodGet, path: api.AgentsAPIEndpoint, token: "prod-token", wantStatus: http.StatusForbidden},
+		{name: "read_token_cannot_write", method: http.MethodDelete, path: api.APIGroup + "/agents/prod/coredns", token: "dashboard-token", wantStatus: http.StatusForbidden},
+		{name: "agent_scope", method: http.MethodDelete, path: api.APIGroup + "/agents/prod/coredns", token: "prod-token", wantStatus: http.StatusNotFound},
+		{name: "other_agent", method: http.MethodDelete, path: api.APIGroup + "/agents/dev/coredns", token: "prod-token", wantStatus: http.StatusForbidden},
+		{name: "other_agent_batch", method: http.MethodPost, path: api.APIGroup + "/agents/dev/batch", token: "prod-token", wantStatus: http.StatusForbidden},
+		{name: "shared_token", method: http.MethodDelete, path: api.APIGroup + "/agents/dev/coredns", token: "shared-token", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.wantStatus {
+				t.Errorf("%s %s = %d, want %d: %s", tt.method, tt.path, w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+}
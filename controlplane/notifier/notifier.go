@@ -0,0 +1,238 @@
+package notifier
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	api "github.com/skillz/opvic/controlplane/api/v1alpha1"
+	"github.com/skillz/opvic/controlplane/storage"
+)
+
+// EventType is the kind of transition that is reported
+type EventType string
+
+const (
+	// EventNewLatestVersion is sent when the latest remote version of a subject changes
+	EventNewLatestVersion EventType = "newLatestVersion"
+	// EventUpgradeAvailable is sent when a running version starts having a newer major, minor or patch version
+	EventUpgradeAvailable EventType = "upgradeAvailable"
+	// EventUpgradeResolved is sent when a running version no longer has a newer major, minor or patch version
+	EventUpgradeResolved EventType = "upgradeResolved"
+
+	LevelMajor = "major"
+	LevelMinor = "minor"
+	LevelPatch = "patch"
+)
+
+var (
+	notificationsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "opvic",
+			Subsystem: "notifier",
+			Name:      "notifications_total",
+			Help:      "The number of notifications sent by notifier and status.",
+		},
+		[]string{"notifier", "status"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(notificationsTotal)
+}
+
+// Event describes a version transition of a subject reported by an agent
+type Event struct {
+	Type      EventType `json:"type"`
+	AgentID   string    `json:"agentId"`
+	SubjectID string    `json:"subjectId"`
+	// Running version for the upgrade events
+	RunningVersion string `json:"runningVersion,omitempty"`
+	// Level of the upgrade events (major, minor or patch)
+	Level string `json:"level,omitempty"`
+	// Latest version before the transition. Only set for the newLatestVersion events
+	PreviousLatestVersion string `json:"previousLatestVersion,omitempty"`
+	LatestVersion         string `json:"latestVersion"`
+	RemoteProvider        string `json:"remoteProvider"`
+	RemoteRepo            string `json:"remoteRepo"`
+	// Unix time of the transition
+	Timestamp int64 `json:"timestamp"`
+}
+
+// Notifier sends the events to an external system
+type Notifier interface {
+	// Name identifies the notifier. It must be stable across restarts since it is used to store the dedup state
+	Name() string
+	Notify(events []Event) error
+}
+
+// Config contains the configuration of the notifiers
+type Config struct {
+	// URLs that receive the events as JSON
+	WebhookURLs []string
+	// Slack incoming webhook URLs
+	SlackWebhookURLs []string
+	// Timeout of the HTTP requests
+	Timeout time.Duration
+	Logger  logr.Logger
+}
+
+// Dispatcher detects the version transitions and sends them to all the notifiers
+type Dispatcher struct {
+	notifiers []Notifier
+	store     storage.Store
+	log       logr.Logger
+}
+
+// NewDispatcher creates the notifiers of the configuration. It returns nil if no notifier is configured
+func (c *Config) NewDispatcher(store storage.Store) *Dispatcher {
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+	client := &http.Client{Timeout: timeout}
+	var notifiers []Notifier
+	for _, url := range c.WebhookURLs {
+		notifiers = append(notifiers, NewWebhook(url, client))
+	}
+	for _, url := range c.SlackWebhookURLs {
+		notifiers = append(notifiers, NewSlack(url, client))
+	}
+	if len(notifiers) == 0 {
+		return nil
+	}
+	return NewDispatcher(store, c.Logger, notifiers...)
+}
+
+func NewDispatcher(store storage.Store, logger logr.Logger, notifiers ...Notifier) *Dispatcher {
+	return &Dispatcher{
+		notifiers: notifiers,
+		store:     store,
+		log:       logger.WithName("notifier"),
+	}
+}
+
+// state is the last reported state of a subject
+type state struct {
+	LatestVersion string `json:"latestVersion"`
+	// set of <running version>/<level> with an available upgrade
+	Available []string `json:"available"`
+}
+
+func stateCacheKey(notifier, agentID, subjectID string) string {
+	return fmt.Sprintf("notifier/%s/%s/%s", notifier, agentID, subjectID)
+}
+
+func newState(infos api.VersionInfos) state {
+	s := state{
+		LatestVersion: infos.LatestVersion,
+		Available:     []string{},
+	}
+	for _, v := range infos.Versions {
+		for level, available := range map[string]bool{LevelMajor: v.MajorAvailable, LevelMinor: v.MinorAvailable, LevelPatch: v.PatchAvailable} {
+			if available {
+				s.Available = append(s.Available, fmt.Sprintf("%s/%s", v.RunningVersion, level))
+			}
+		}
+	}
+	sort.Strings(s.Available)
+	return s
+}
+
+// Process compares the version infos with the last state that was reported to each notifier
+// and sends the transitions. The first state of a subject is recorded without notifying.
+func (d *Dispatcher) Process(infos api.VersionInfos) {
+	current := newState(infos)
+	now := time.Now().Unix()
+	for _, n := range d.notifiers {
+		log := d.log.WithValues("notifier", n.Name(), "agent_id", infos.AgentID, "version_id", infos.ID)
+		key := stateCacheKey(n.Name(), infos.AgentID, infos.ID)
+		var previous state
+		found, err := d.store.Get(key, &previous)
+		if err != nil {
+			log.Error(err, "failed to get the notifier state")
+			continue
+		}
+		if found {
+			events := transitions(previous, current, infos, now)
+			if len(events) > 0 {
+				log.V(1).Info("sending notifications", "count", len(events))
+				if err := n.Notify(events); err != nil {
+					// keep the previous state so the transitions are sent again on the next reconcile
+					notificationsTotal.WithLabelValues(n.Name(), "error").Inc()
+					log.Error(err, "failed to send notifications")
+					continue
+				}
+				notificationsTotal.WithLabelValues(n.Name(), "success").Add(float64(len(events)))
+			}
+		}
+		if err := d.store.Set(key, current); err != nil {
+			log.Error(err, "failed to store the notifier state")
+		}
+	}
+}
+
+// transitions returns the events between the previous and the current state
+func transitions(previous, current state, infos api.VersionInfos, now int64) []Event {
+	var events []Event
+	newEvent := func(t EventType) Event {
+		return Event{
+			Type:           t,
+			AgentID:        infos.AgentID,
+			SubjectID:      infos.ID,
+			LatestVersion:  current.LatestVersion,
+			RemoteProvider: infos.RemoteProvider,
+			RemoteRepo:     infos.RemoteRepo,
+			Timestamp:      now,
+		}
+	}
+	if previous.LatestVersion != current.LatestVersion {
+		e := newEvent(EventNewLatestVersion)
+		e.PreviousLatestVersion = previous.LatestVersion
+		events = append(events, e)
+	}
+	for _, key := range difference(current.Available, previous.Available) {
+		e := newEvent(EventUpgradeAvailable)
+		e.RunningVersion, e.Level = splitAvailable(key)
+		events = append(events, e)
+	}
+	for _, key := range difference(previous.Available, current.Available) {
+		e := newEvent(EventUpgradeResolved)
+		e.RunningVersion, e.Level = splitAvailable(key)
+		events = append(events, e)
+	}
+	return events
+}
+
+// difference returns the items of a that are not in b
+func difference(a, b []string) []string {
+	set := make(map[string]bool, len(b))
+	for _, item := range b {
+		set[item] = true
+	}
+	var diff []string
+	for _, item := range a {
+		if !set[item] {
+			diff = append(diff, item)
+		}
+	}
+	return diff
+}
+
+func splitAvailable(key string) (string, string) {
+	i := strings.LastIndex(key, "/")
+	if i < 0 {
+		return key, ""
+	}
+	return key[:i], key[i+1:]
+}
+
+// urlID returns a short stable identifier of a URL that does not leak the secrets in it
+func urlID(url string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(url)))[:12]
+}
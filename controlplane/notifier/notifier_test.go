@@ -0,0 +1,196 @@
+package notifier
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-logr/logr"
+	api "github.com/skillz/opvic/controlplane/api/v1alpha1"
+	"github.com/skillz/opvic/controlplane/storage"
+)
+
+// receiver is a local HTTP server that records the request bodies
+type receiver struct {
+	mu       sync.Mutex
+	status   int
+	payloads [][]byte
+	server   *httptest.Server
+}
+
+func newReceiver(t *testing.T) *receiver {
+	r := &receiver{status: http.StatusOK}
+	r.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var body json.RawMessage
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if r.status == http.StatusOK {
+			r.payloads = append(r.payloads, body)
+		}
+		w.WriteHeader(r.status)
+	}))
+	t.Cleanup(r.server.Close)
+	return r
+}
+
+func (r *receiver) events(t *testing.T) [][]Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var all [][]Event
+	for _, p := range r.payloads {
+		var events []Event
+		if err := json.Unmarshal(p, &events); err != nil {
+			t.Fatal(err)
+		}
+		all = append(all, events)
+	}
+	return all
+}
+
+func versionInfos(latest string, running string, major, minor, patch bool) api.VersionInfos {
+	return api.VersionInfos{
+		ID:             "coredns",
+		AgentID:        "test",
+		LatestVersion:  latest,
+		RemoteProvider: "github",
+		RemoteRepo:     "coredns/coredns",
+		Versions: []api.VersionInfo{
+			{
+				RunningVersion: running,
+				LatestVersion:  latest,
+				MajorAvailable: major,
+				MinorAvailable: minor,
+				PatchAvailable: patch,
+			},
+		},
+	}
+}
+
+// eventSummary drops the fields that are not relevant for comparing the events
+func eventSummary(events []Event) []Event {
+	var summary []Event
+	for _, e := range events {
+		summary = append(summary, Event{
+			Type:                  e.Type,
+			RunningVersion:        e.RunningVersion,
+			Level:                 e.Level,
+			PreviousLatestVersion: e.PreviousLatestVersion,
+			LatestVersion:         e.LatestVersion,
+		})
+	}
+	return summary
+}
+
+func TestDispatcherWebhook(t *testing.T) {
+	r := newReceiver(t)
+	d := NewDispatcher(storage.NewMemoryStore(0), logr.Discard(), NewWebhook(r.server.URL, r.server.Client()))
+
+	steps := []struct {
+		name  string
+		infos api.VersionInfos
+		want  []Event
+	}{
+		{
+			name:  "first_state_is_not_reported",
+			infos: versionInfos("1.8.5", "1.8.5", false, false, false),
+		},
+		{
+			name:  "no_change",
+			infos: versionInfos("1.8.5", "1.8.5", false, false, false),
+		},
+		{
+			name:  "new_patch",
+			infos: versionInfos("1.8.6", "1.8.5", false, false, true),
+			want: []Event{
+				{Type: EventNewLatestVersion, PreviousLatestVersion: "1.8.5", LatestVersion: "1.8.6"},
+				{Type: EventUpgradeAvailable, RunningVersion: "1.8.5", Level: LevelPatch, LatestVersion: "1.8.6"},
+			},
+		},
+		{
+			name:  "reported_once",
+			infos: versionInfos("1.8.6", "1.8.5", false, false, true),
+		},
+		{
+			name:  "upgraded",
+			infos: versionInfos("1.8.6", "1.8.6", false, false, false),
+			want: []Event{
+				{Type: EventUpgradeResolved, RunningVersion: "1.8.5", Level: LevelPatch, LatestVersion: "1.8.6"},
+			},
+		},
+	}
+	sent := 0
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			d.Process(step.infos)
+			all := r.events(t)
+			if step.want == nil {
+				if len(all) != sent {
+					t.Fatalf("unexpected notification %v", all[len(all)-1])
+				}
+				return
+			}
+			if len(all) != sent+1 {
+				t.Fatalf("got %d notifications, want %d", len(all), sent+1)
+			}
+			sent++
+			if got := eventSummary(all[sent-1]); !reflect.DeepEqual(got, step.want) {
+				t.Errorf("events = %+v, want %+v", got, step.want)
+			}
+		})
+	}
+}
+
+func TestDispatcherRetriesFailedNotifications(t *testing.T) {
+	r := newReceiver(t)
+	d := NewDispatcher(storage.NewMemoryStore(0), logr.Discard(), NewWebhook(r.server.URL, r.server.Client()))
+	d.Process(versionInfos("1.8.5", "1.8.5", false, false, false))
+
+	r.status = http.StatusInternalServerError
+	d.Process(versionInfos("1.8.6", "1.8.5", false, false, true))
+	if got := len(r.events(t)); got != 0 {
+		t.Fatalf("got %d notifications, want 0", got)
+	}
+
+	r.status = http.StatusOK
+	d.Process(versionInfos("1.8.6", "1.8.5", false, false, true))
+	all := r.events(t)
+	if len(all) != 1 || len(all[0]) != 2 {
+		t.Fatalf("got %v, want the transitions to be sent after the failure", all)
+	}
+}
+
+func TestSlack(t *testing.T) {
+	r := newReceiver(t)
+	s := NewSlack(r.server.URL, r.server.Client())
+	err := s.Notify([]Event{
+		{Type: EventNewLatestVersion, AgentID: "test", SubjectID: "coredns", PreviousLatestVersion: "1.8.5", LatestVersion: "1.8.6"},
+		{Type: EventUpgradeAvailable, AgentID: "test", SubjectID: "coredns", RunningVersion: "1.8.5", Level: LevelPatch, LatestVersion: "1.8.6"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.payloads) != 1 {
+		t.Fatalf("got %d messages, want 1", len(r.payloads))
+	}
+	var msg slackMessage
+	if err := json.Unmarshal(r.payloads[0], &msg); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(msg.Text, "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2: %q", len(lines), msg.Text)
+	}
+	for _, want := range []string{"*1.8.6*", "`coredns`", "`test`", "patch"} {
+		if !strings.Contains(msg.Text, want) {
+			t.Errorf("message %q does not contain %q", msg.Text, want)
+		}
+	}
+}
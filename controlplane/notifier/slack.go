@@ -0,0 +1,54 @@
+package notifier
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Slack posts the events as a message to a Slack incoming webhook
+type Slack struct {
+	url    string
+	client *http.Client
+}
+
+type slackMessage struct {
+	Text string `json:"text"`
+}
+
+func NewSlack(url string, client *http.Client) *Slack {
+	return &Slack{
+		url:    url,
+		client: client,
+	}
+}
+
+func (s *Slack) Name() string {
+	return "slack-" + urlID(s.url)
+}
+
+func (s *Slack) Notify(events []Event) error {
+	var lines []string
+	for _, e := range events {
+		lines = append(lines, SlackText(e))
+	}
+	return postJSON(s.client, s.url, slackMessage{Text: strings.Join(lines, "\n")})
+}
+
+// SlackText formats the event in Slack mrkdwn
+func SlackText(e Event) string {
+	subject := fmt.Sprintf("`%s` on agent `%s`", e.SubjectID, e.AgentID)
+	switch e.Type {
+	case EventNewLatestVersion:
+		if e.PreviousLatestVersion == "" {
+			return fmt.Sprintf(":rocket: *%s* is the latest version of %s (%s %s)", e.LatestVersion, subject, e.RemoteProvider, e.RemoteRepo)
+		}
+		return fmt.Sprintf(":rocket: *%s* is the latest version of %s, previously %s (%s %s)", e.LatestVersion, subject, e.PreviousLatestVersion, e.RemoteProvider, e.RemoteRepo)
+	case EventUpgradeAvailable:
+		return fmt.Sprintf(":arrow_up: A new %s version is available for %s running *%s*. Latest version is *%s*", e.Level, subject, e.RunningVersion, e.LatestVersion)
+	case EventUpgradeResolved:
+		return fmt.Sprintf(":white_check_mark: No new %s version is available anymore for %s running *%s*", e.Level, subject, e.RunningVersion)
+	default:
+		return fmt.Sprintf("%s: %s", e.Type, subject)
+	}
+}
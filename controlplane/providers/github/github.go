@@ -10,13 +10,17 @@ import (
 	"github.com/bradleyfalzon/ghinstallation"
 	"github.com/go-logr/logr"
 	"github.com/google/go-github/v39/github"
-	"github.com/patrickmn/go-cache"
 	"github.com/prometheus/client_golang/prometheus"
 	v1alpha1 "github.com/skillz/opvic/agent/api/v1alpha1"
+	"github.com/skillz/opvic/controlplane/providers"
+	"github.com/skillz/opvic/controlplane/storage"
 	"github.com/skillz/opvic/utils"
 	"golang.org/x/oauth2"
 )
 
+// Name of the provider that is used in the RemoteVersion configuration
+const Name = "github"
+
 var (
 	rateLimitRemaining = prometheus.NewGauge(
 		prometheus.GaugeOpts{
@@ -39,7 +43,7 @@ type Config struct {
 type Provider struct {
 	client *github.Client
 	ctx    context.Context
-	cache  *cache.Cache
+	store  storage.Store
 	log    logr.Logger
 }
 
@@ -47,7 +51,18 @@ func init() {
 	prometheus.MustRegister(rateLimitRemaining)
 }
 
-func (c *Config) NewProvider(ctx context.Context, cache *cache.Cache, logger logr.Logger) (*Provider, error) {
+// Factory returns a factory for registering the provider with this configuration
+func (c *Config) Factory() providers.Factory {
+	return func(opts providers.Options) (providers.RemoteProvider, error) {
+		p, err := c.NewProvider(opts.Context, opts.Store, opts.Logger)
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
+	}
+}
+
+func (c *Config) NewProvider(ctx context.Context, store storage.Store, logger logr.Logger) (*Provider, error) {
 	var transport http.RoundTripper
 	var client *github.Client
 	if c.Token != "" {
@@ -89,17 +104,24 @@ func (c *Config) NewProvider(ctx context.Context, cache *cache.Cache, logger log
 	return &Provider{
 		client: client,
 		ctx:    ctx,
-		cache:  cache,
+		store:  store,
 		log:    logger,
 	}, nil
 }
 
-func (p *Provider) getCacheValue(key string) (interface{}, bool) {
-	return p.cache.Get(key)
+func (p *Provider) getCacheValue(key string, value interface{}) bool {
+	found, err := p.store.Get(key, value)
+	if err != nil {
+		p.log.Error(err, "failed to get the value from the cache", "key", key)
+		return false
+	}
+	return found
 }
 
 func (p *Provider) setCacheValue(key string, value interface{}) {
-	p.cache.Set(key, value, cache.DefaultExpiration)
+	if err := p.store.Set(key, value); err != nil {
+		p.log.Error(err, "failed to cache the value", "key", key)
+	}
 }
 
 func releasesCacheKey(repo string) string {
@@ -113,7 +135,7 @@ func tagsCacheKey(repo string) string {
 func (p *Provider) getReleases(repo string) ([]*github.RepositoryRelease, error) {
 	log := p.log.WithValues("repo", repo)
 	var releases []*github.RepositoryRelease
-	if r, ok := p.getCacheValue(releasesCacheKey(repo)); !ok {
+	if !p.getCacheValue(releasesCacheKey(repo), &releases) {
 		log.V(1).Info("getting releases")
 		owner, name, err := splitRepo(repo)
 		if err != nil {
@@ -137,7 +159,6 @@ func (p *Provider) getReleases(repo string) ([]*github.RepositoryRelease, error)
 		p.setCacheValue(releasesCacheKey(repo), releases)
 	} else {
 		log.V(1).Info("found releases in cache")
-		releases = r.([]*github.RepositoryRelease)
 	}
 	return releases, nil
 }
@@ -145,7 +166,7 @@ func (p *Provider) getReleases(repo string) ([]*github.RepositoryRelease, error)
 func (p *Provider) getTags(repo string) ([]*github.RepositoryTag, error) {
 	log := p.log.WithValues("repo", repo)
 	var tags []*github.RepositoryTag
-	if t, ok := p.getCacheValue(tagsCacheKey(repo)); !ok {
+	if !p.getCacheValue(tagsCacheKey(repo), &tags) {
 		log.V(1).Info("getting tags")
 		owner, name, err := splitRepo(repo)
 		if err != nil {
@@ -169,7 +190,6 @@ func (p *Provider) getTags(repo string) ([]*github.RepositoryTag, error) {
 		p.setCacheValue(tagsCacheKey(repo), tags)
 	} else {
 		log.V(1).Info("found tags in cache")
-		tags = t.([]*github.RepositoryTag)
 	}
 	return tags, nil
 }
@@ -244,6 +264,36 @@ func (p *Provider) getVersionsFromTags(conf v1alpha1.RemoteVersion) ([]string, e
 	return versions, nil
 }
 
+// GetReleaseDates returns the publication date of the versions of the releases. The tags have no publication date
+func (p *Provider) GetReleaseDates(conf v1alpha1.RemoteVersion) (map[string]int64, error) {
+	dates := map[string]int64{}
+	if conf.Strategy != v1alpha1.GithubStrategyReleases {
+		return dates, nil
+	}
+	releases, err := p.getReleases(conf.Repo)
+	if err != nil {
+		return nil, err
+	}
+	for _, release := range releases {
+		if release.GetTagName() == "" || release.PublishedAt == nil {
+			continue
+		}
+		matched, v, err := utils.MatchPattern(conf.Extraction.Regex.Pattern, conf.Extraction.Regex.Result, release.GetName())
+		if err != nil {
+			return nil, err
+		}
+		if matched {
+			dates[v] = release.GetPublishedAt().Unix()
+		}
+	}
+	return dates, nil
+}
+
+// Strategies returns the remote strategies that the provider supports
+func (p *Provider) Strategies() []v1alpha1.RemoteStrategy {
+	return []v1alpha1.RemoteStrategy{v1alpha1.GithubStrategyReleases, v1alpha1.GithubStrategyTags}
+}
+
 func (p *Provider) GetVersions(conf v1alpha1.RemoteVersion) ([]string, error) {
 	// Check the rate limit and set it as metrics
 	limit, _, err := p.client.RateLimits(p.ctx)
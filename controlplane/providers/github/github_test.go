@@ -0,0 +1,117 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-github/v39/github"
+	"github.com/skillz/opvic/agent/api/v1alpha1"
+	"github.com/skillz/opvic/controlplane/storage"
+)
+
+type testRepo struct {
+	releases []*github.RepositoryRelease
+	tags     []*github.RepositoryTag
+	// versions of the stable releases
+	want []string
+}
+
+func release(name, tag string) *github.RepositoryRelease {
+	return &github.RepositoryRelease{Name: github.String(name), TagName: github.String(tag)}
+}
+
+func tag(name string) *github.RepositoryTag {
+	return &github.RepositoryTag{Name: github.String(name)}
+}
+
+// upstream releases and tags of the repositories of the presets
+var testRepos = map[string]testRepo{
+	"kubernetes/kubernetes": {
+		releases: []*github.RepositoryRelease{
+			release("Kubernetes v1.22.2", "v1.22.2"),
+			release("Kubernetes v1.22.0-rc.0", "v1.22.0-rc.0"),
+			release("Kubernetes v1.21.5", "v1.21.5"),
+		},
+		tags: []*github.RepositoryTag{tag("v1.22.2"), tag("v1.22.0-rc.0"), tag("v1.22.0-alpha.1"), tag("v1.21.5")},
+		want: []string{"1.22.2", "1.21.5"},
+	},
+	"containerd/containerd": {
+		releases: []*github.RepositoryRelease{
+			release("containerd 1.6.0-beta.1", "v1.6.0-beta.1"),
+			release("containerd 1.5.7", "v1.5.7"),
+			release("containerd 1.4.11", "v1.4.11"),
+		},
+		tags: []*github.RepositoryTag{tag("v1.6.0-beta.1"), tag("v1.5.7"), tag("api/v1.5.7"), tag("v1.4.11")},
+		want: []string{"1.5.7", "1.4.11"},
+	},
+}
+
+// newTestProvider returns a provider that uses a Github API stand-in serving testRepos
+func newTestProvider(t *testing.T) *Provider {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rate_limit", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"resources": {"core": {"limit": 5000, "remaining": 4999}}}`)) // nolint: errcheck
+	})
+	for name, repo := range testRepos {
+		repo := repo
+		mux.HandleFunc(fmt.Sprintf("/repos/%s/releases", name), func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(repo.releases) // nolint: errcheck
+		})
+		mux.HandleFunc(fmt.Sprintf("/repos/%s/tags", name), func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(repo.tags) // nolint: errcheck
+		})
+	}
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	client := github.NewClient(nil)
+	baseURL, err := url.Parse(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.BaseURL = baseURL
+	return &Provider{
+		client: client,
+		ctx:    context.Background(),
+		store:  storage.NewMemoryStore(time.Minute),
+		log:    logr.Discard(),
+	}
+}
+
+// TestPresetsRemoteVersion checks that the default remote versions of the presets match the upstream versions
+func TestPresetsRemoteVersion(t *testing.T) {
+	p := newTestProvider(t)
+	presets := map[string]v1alpha1.Preset{}
+	for strategy, preset := range v1alpha1.NodePresets {
+		presets[string(strategy)] = preset
+	}
+	for strategy, preset := range v1alpha1.ResourcePresets {
+		presets[strategy] = preset
+	}
+	for name, preset := range presets {
+		if preset.RemoteVersion.Provider != Name {
+			continue
+		}
+		t.Run(name, func(t *testing.T) {
+			repo, found := testRepos[preset.RemoteVersion.Repo]
+			if !found {
+				t.Fatalf("no test releases of %s", preset.RemoteVersion.Repo)
+			}
+			got, err := p.GetVersions(preset.RemoteVersion)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, repo.want) {
+				t.Errorf("GetVersions() = %v, want %v", got, repo.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,314 @@
+package gitlab
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	v1alpha1 "github.com/skillz/opvic/agent/api/v1alpha1"
+	"github.com/skillz/opvic/controlplane/providers"
+	"github.com/skillz/opvic/controlplane/storage"
+	"github.com/skillz/opvic/utils"
+)
+
+const (
+	// Name of the provider that is used in the RemoteVersion configuration
+	Name           = "gitlab"
+	DefaultBaseURL = "https://gitlab.com"
+	apiPath        = "/api/v4"
+	// maximum number of items per page allowed by Gitlab
+	perPage = 100
+)
+
+var (
+	rateLimitRemaining = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "opvic_provider_gitlab",
+			Name:      "rate_limit_remaining",
+			Help:      "The number of requests remaining in the current rate limit window.",
+		},
+	)
+)
+
+// Config contains configuration for Gitlab provider
+type Config struct {
+	// Base URL of the Gitlab instance (e.g. https://gitlab.example.com)
+	BaseURL string
+	// Personal, project or group access token
+	Token string
+}
+
+// Provider is a gitlab provider for getting remote versions from Gitlab
+type Provider struct {
+	client  *http.Client
+	baseURL string
+	token   string
+	ctx     context.Context
+	store   storage.Store
+	log     logr.Logger
+}
+
+// Release is a Gitlab project release
+type Release struct {
+	Name    string `json:"name"`
+	TagName string `json:"tag_name"`
+}
+
+// Tag is a Gitlab repository tag
+type Tag struct {
+	Name string `json:"name"`
+}
+
+func init() {
+	prometheus.MustRegister(rateLimitRemaining)
+}
+
+// Factory returns a factory for registering the provider with this configuration
+func (c *Config) Factory() providers.Factory {
+	return func(opts providers.Options) (providers.RemoteProvider, error) {
+		p, err := c.NewProvider(opts.Context, opts.Store, opts.Logger)
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
+	}
+}
+
+func (c *Config) NewProvider(ctx context.Context, store storage.Store, logger logr.Logger) (*Provider, error) {
+	baseURL := c.BaseURL
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid gitlab base url %s: %v", baseURL, err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid gitlab base url %s: it must be in the format of: https://gitlab.example.com", baseURL)
+	}
+	if c.Token == "" {
+		logger.V(1).Info("no authentication provided. You might encounter Gitlab API rate limiting issues and private projects are not accessible.")
+	}
+	return &Provider{
+		client:  &http.Client{Timeout: 30 * time.Second},
+		baseURL: strings.TrimSuffix(u.String(), "/"),
+		token:   c.Token,
+		ctx:     ctx,
+		store:   store,
+		log:     logger,
+	}, nil
+}
+
+func (p *Provider) getCacheValue(key string, value interface{}) bool {
+	found, err := p.store.Get(key, value)
+	if err != nil {
+		p.log.Error(err, "failed to get the value from the cache", "key", key)
+		return false
+	}
+	return found
+}
+
+func (p *Provider) setCacheValue(key string, value interface{}) {
+	if err := p.store.Set(key, value); err != nil {
+		p.log.Error(err, "failed to cache the value", "key", key)
+	}
+}
+
+func (p *Provider) releasesCacheKey(project string) string {
+	return fmt.Sprintf("gitlab/%s/%s/releases", p.baseURL, project)
+}
+
+func (p *Provider) tagsCacheKey(project string) string {
+	return fmt.Sprintf("gitlab/%s/%s/tags", p.baseURL, project)
+}
+
+// projectURL returns the API url of the project for the given path.
+// The project path (e.g. group/subgroup/project) is used as the URL encoded project ID
+func (p *Provider) projectURL(project, path string) (string, error) {
+	project = strings.Trim(project, "/")
+	if !strings.Contains(project, "/") {
+		return "", fmt.Errorf("invalid repo: %s. it must be in the format of: group/project", project)
+	}
+	id := url.PathEscape(project)
+	return fmt.Sprintf("%s%s/projects/%s/%s", p.baseURL, apiPath, id, path), nil
+}
+
+// list gets all the pages of a project resource and decodes each page by calling the decode function
+func (p *Provider) list(project, path string, decode func(*json.Decoder) error) error {
+	endpoint, err := p.projectURL(project, path)
+	if err != nil {
+		return err
+	}
+	page := "1"
+	for page != "" {
+		req, err := http.NewRequestWithContext(p.ctx, http.MethodGet, fmt.Sprintf("%s?per_page=%d&page=%s", endpoint, perPage, page), nil)
+		if err != nil {
+			return err
+		}
+		if p.token != "" {
+			req.Header.Set("PRIVATE-TOKEN", p.token)
+		}
+		resp, err := p.client.Do(req)
+		if err != nil {
+			return err
+		}
+		if remaining, err := strconv.Atoi(resp.Header.Get("RateLimit-Remaining")); err == nil {
+			p.log.V(1).Info("rate limit", "remaining", remaining)
+			rateLimitRemaining.Set(float64(remaining))
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return fmt.Errorf("unexpected status code: %d status: %s", resp.StatusCode, resp.Status)
+		}
+		err = decode(json.NewDecoder(resp.Body))
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		// X-Next-Page is empty on the last page
+		page = resp.Header.Get("X-Next-Page")
+	}
+	return nil
+}
+
+func (p *Provider) getReleases(project string) ([]*Release, error) {
+	log := p.log.WithValues("repo", project)
+	var releases []*Release
+	if !p.getCacheValue(p.releasesCacheKey(project), &releases) {
+		log.V(1).Info("getting releases")
+		err := p.list(project, "releases", func(d *json.Decoder) error {
+			var page []*Release
+			if err := d.Decode(&page); err != nil {
+				return err
+			}
+			releases = append(releases, page...)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		p.setCacheValue(p.releasesCacheKey(project), releases)
+	} else {
+		log.V(1).Info("found releases in cache")
+	}
+	return releases, nil
+}
+
+func (p *Provider) getTags(project string) ([]*Tag, error) {
+	log := p.log.WithValues("repo", project)
+	var tags []*Tag
+	if !p.getCacheValue(p.tagsCacheKey(project), &tags) {
+		log.V(1).Info("getting tags")
+		err := p.list(project, "repository/tags", func(d *json.Decoder) error {
+			var page []*Tag
+			if err := d.Decode(&page); err != nil {
+				return err
+			}
+			tags = append(tags, page...)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		p.setCacheValue(p.tagsCacheKey(project), tags)
+	} else {
+		log.V(1).Info("found tags in cache")
+	}
+	return tags, nil
+}
+
+func (p *Provider) getVersionsFromReleases(conf v1alpha1.RemoteVersion) ([]string, error) {
+	var matchedVersions []string
+	var versions []string
+	releases, err := p.getReleases(conf.Repo)
+	if err != nil {
+		return nil, err
+	}
+	for _, release := range releases {
+		if release.TagName == "" {
+			continue
+		}
+		// release name is optional in Gitlab and defaults to the tag name
+		name := release.Name
+		if name == "" {
+			name = release.TagName
+		}
+		matched, v, err := utils.MatchPattern(conf.Extraction.Regex.Pattern, conf.Extraction.Regex.Result, name)
+		if err != nil {
+			return nil, err
+		}
+		if matched {
+			matchedVersions = append(matchedVersions, v)
+		}
+	}
+	if conf.Constraint == "" {
+		return matchedVersions, nil
+	} else {
+		for _, version := range matchedVersions {
+			meet, err := utils.MeetConstraint(conf.Constraint, version)
+			if err != nil {
+				return nil, err
+			}
+			if meet {
+				versions = append(versions, version)
+			}
+		}
+	}
+	return versions, nil
+}
+
+func (p *Provider) getVersionsFromTags(conf v1alpha1.RemoteVersion) ([]string, error) {
+	var matchedVersions []string
+	var versions []string
+	tags, err := p.getTags(conf.Repo)
+	if err != nil {
+		return nil, err
+	}
+	for _, tag := range tags {
+		if tag.Name == "" {
+			continue
+		}
+		matched, v, err := utils.MatchPattern(conf.Extraction.Regex.Pattern, conf.Extraction.Regex.Result, tag.Name)
+		if err != nil {
+			return nil, err
+		}
+		if matched {
+			matchedVersions = append(matchedVersions, v)
+		}
+	}
+	if conf.Constraint == "" {
+		return matchedVersions, nil
+	} else {
+		for _, version := range matchedVersions {
+			meet, err := utils.MeetConstraint(conf.Constraint, version)
+			if err != nil {
+				return nil, err
+			}
+			if meet {
+				versions = append(versions, version)
+			}
+		}
+	}
+	return versions, nil
+}
+
+// Strategies returns the remote strategies that the provider supports
+func (p *Provider) Strategies() []v1alpha1.RemoteStrategy {
+	return []v1alpha1.RemoteStrategy{v1alpha1.GitlabStrategyReleases, v1alpha1.GitlabStrategyTags}
+}
+
+func (p *Provider) GetVersions(conf v1alpha1.RemoteVersion) ([]string, error) {
+	if conf.Strategy == v1alpha1.GitlabStrategyReleases {
+		return p.getVersionsFromReleases(conf)
+	} else if conf.Strategy == v1alpha1.GitlabStrategyTags {
+		return p.getVersionsFromTags(conf)
+	}
+	return nil, fmt.Errorf("strategy %s is not supported", conf.Strategy)
+}
@@ -0,0 +1,154 @@
+package gitlab
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/skillz/opvic/agent/api/v1alpha1"
+	"github.com/skillz/opvic/controlplane/storage"
+)
+
+const (
+	testToken   = "test-token"
+	testProject = "group/subgroup/project"
+)
+
+// newTestGitlab starts a Gitlab API stand-in that serves the releases and tags of
+// testProject in pages of two items
+func newTestGitlab(t *testing.T, releases []Release, tags []Tag) *httptest.Server {
+	paginate := func(w http.ResponseWriter, r *http.Request, total int) (int, int) {
+		page, err := strconv.Atoi(r.URL.Query().Get("page"))
+		if err != nil || page < 1 {
+			page = 1
+		}
+		start := (page - 1) * 2
+		end := start + 2
+		if end < total {
+			w.Header().Set("X-Next-Page", strconv.Itoa(page+1))
+		} else {
+			end = total
+		}
+		return start, end
+	}
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("PRIVATE-TOKEN") != testToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("RateLimit-Remaining", "100")
+		switch r.URL.EscapedPath() {
+		case "/api/v4/projects/group%2Fsubgroup%2Fproject/releases":
+			start, end := paginate(w, r, len(releases))
+			json.NewEncoder(w).Encode(releases[start:end]) // nolint: errcheck
+		case "/api/v4/projects/group%2Fsubgroup%2Fproject/repository/tags":
+			start, end := paginate(w, r, len(tags))
+			json.NewEncoder(w).Encode(tags[start:end]) // nolint: errcheck
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestProviderGetVersions(t *testing.T) {
+	releases := []Release{
+		{Name: "Release v1.0.0", TagName: "v1.0.0"},
+		{Name: "", TagName: "v1.1.0"},
+		{Name: "Release v2.0.0", TagName: "v2.0.0"},
+		{Name: "Draft", TagName: ""},
+	}
+	tags := []Tag{{Name: "v1.0.0"}, {Name: "v1.1.0"}, {Name: "v1.1.1"}, {Name: "v2.0.0"}, {Name: "nightly"}}
+	server := newTestGitlab(t, releases, tags)
+
+	tests := []struct {
+		name    string
+		conf    v1alpha1.RemoteVersion
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "releases",
+			conf: v1alpha1.RemoteVersion{
+				Provider: "gitlab",
+				Strategy: v1alpha1.GitlabStrategyReleases,
+				Repo:     testProject,
+				Extraction: v1alpha1.Extraction{
+					Regex: v1alpha1.Regex{
+						Pattern: `v([0-9]+\.[0-9]+\.[0-9]+)$`,
+						Result:  "$1",
+					},
+				},
+			},
+			want: []string{"1.0.0", "1.1.0", "2.0.0"},
+		},
+		{
+			name: "tags_with_constraint",
+			conf: v1alpha1.RemoteVersion{
+				Provider: "gitlab",
+				Strategy: v1alpha1.GitlabStrategyTags,
+				Repo:     testProject,
+				Extraction: v1alpha1.Extraction{
+					Regex: v1alpha1.Regex{
+						Pattern: `^v([0-9]+\.[0-9]+\.[0-9]+)$`,
+						Result:  "$1",
+					},
+				},
+				Constraint: "~> 1.1",
+			},
+			want: []string{"1.1.0", "1.1.1"},
+		},
+		{
+			name: "invalid_project",
+			conf: v1alpha1.RemoteVersion{
+				Provider: "gitlab",
+				Strategy: v1alpha1.GitlabStrategyTags,
+				Repo:     "project",
+			},
+			wantErr: true,
+		},
+		{
+			name: "unsupported_strategy",
+			conf: v1alpha1.RemoteVersion{
+				Provider: "gitlab",
+				Strategy: v1alpha1.HelmStrategyAppVersion,
+				Repo:     testProject,
+			},
+			wantErr: true,
+		},
+	}
+	conf := &Config{BaseURL: fmt.Sprintf("%s/", server.URL), Token: testToken}
+	p, err := conf.NewProvider(context.Background(), storage.NewMemoryStore(0), logr.Discard())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := p.GetVersions(tt.conf)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetVersions() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			sort.Strings(got)
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetVersions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewProviderInvalidBaseURL(t *testing.T) {
+	conf := &Config{BaseURL: "gitlab.example.com"}
+	if _, err := conf.NewProvider(context.Background(), storage.NewMemoryStore(0), logr.Discard()); err == nil {
+		t.Errorf("NewProvider() expected an error for a base url without scheme")
+	}
+}
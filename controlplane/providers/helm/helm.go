@@ -4,20 +4,36 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/go-logr/logr"
-	"github.com/patrickmn/go-cache"
 	"github.com/skillz/opvic/agent/api/v1alpha1"
+	"github.com/skillz/opvic/controlplane/providers"
+	"github.com/skillz/opvic/controlplane/storage"
 	"github.com/skillz/opvic/utils"
 	"gopkg.in/yaml.v2"
 )
 
-const indexPath string = "index.yaml"
+const (
+	// Name of the provider that is used in the RemoteVersion configuration
+	Name = "helm"
+	// Alias of the provider name
+	RepoAlias        = "helm-repo"
+	indexPath string = "index.yaml"
+)
 
 type ChartVersion struct {
 	Version    string `yaml:"version"`
 	AppVersion string `yaml:"appVersion"`
+	// Time that the chart version was added to the repository in RFC 3339 format
+	Created string `yaml:"created"`
+}
+
+// chartRelease is a version of a chart and the unix time that it was added to the repository
+type chartRelease struct {
+	Version string `json:"version"`
+	Created int64  `json:"created,omitempty"`
 }
 
 type Index struct {
@@ -27,43 +43,55 @@ type Index struct {
 
 type Provider struct {
 	client *http.Client
-	cache  *cache.Cache
+	store  storage.Store
 	log    logr.Logger
 }
 
-func NewProvider(cache *cache.Cache, logger logr.Logger) *Provider {
+// Factory returns a factory for registering the provider
+func Factory() providers.Factory {
+	return func(opts providers.Options) (providers.RemoteProvider, error) {
+		return NewProvider(opts.Store, opts.Logger), nil
+	}
+}
+
+func NewProvider(store storage.Store, logger logr.Logger) *Provider {
 	return &Provider{
 		client: &http.Client{Timeout: 30 * time.Second},
-		cache:  cache,
+		store:  store,
 		log:    logger,
 	}
 }
 
-func (p *Provider) GetCacheValue(key string) (interface{}, bool) {
-	return p.cache.Get(key)
+func (p *Provider) GetCacheValue(key string, value interface{}) bool {
+	found, err := p.store.Get(key, value)
+	if err != nil {
+		p.log.Error(err, "failed to get the value from the cache", "key", key)
+		return false
+	}
+	return found
 }
 
 func (p *Provider) SetCacheValue(key string, value interface{}) {
-	p.cache.Set(key, value, cache.DefaultExpiration)
+	if err := p.store.Set(key, value); err != nil {
+		p.log.Error(err, "failed to cache the value", "key", key)
+	}
 }
 
-func ReleasesCacheKey(repo string) string {
-	// drop the https://
-	return fmt.Sprintf("helm/%s", repo[8:])
+// VersionsCacheKey is the key of the versions of a chart for a strategy. The versions are cached
+// instead of the index since an index can be several MB and is shared by many charts
+func VersionsCacheKey(repo, chart string, strategy v1alpha1.RemoteStrategy) string {
+	// drop the scheme
+	repo = strings.TrimPrefix(strings.TrimPrefix(repo, "https://"), "http://")
+	return fmt.Sprintf("helm/%s/%s/%s", strings.TrimSuffix(repo, "/"), chart, strategy)
 }
 
 func AppendIndex(repo string) string {
 	return fmt.Sprintf("%s/%s", repo, indexPath)
 }
 
+// GetIndex downloads the index of the repository
 func (p *Provider) GetIndex(repo string) (*Index, error) {
-	log := p.log.WithValues("repo", repo)
-	indexCache, ok := p.GetCacheValue(ReleasesCacheKey(repo))
-	if ok {
-		log.V(1).Info("found index in cache")
-		return indexCache.(*Index), nil
-	}
-	log.V(1).Info("getting index from remote")
+	p.log.V(1).Info("getting index from remote", "repo", repo)
 	url := AppendIndex(repo)
 	resp, err := p.client.Get(url)
 	if err != nil {
@@ -74,12 +102,36 @@ func (p *Provider) GetIndex(repo string) (*Index, error) {
 	if err != nil {
 		return nil, err
 	}
-	index, err := LoadIndex(data)
+	return LoadIndex(data)
+}
+
+// getChartVersions returns the chart versions or the app versions of the chart depending on the strategy
+func (p *Provider) getChartVersions(conf v1alpha1.RemoteVersion) ([]chartRelease, error) {
+	key := VersionsCacheKey(conf.Repo, conf.Chart, conf.Strategy)
+	var releases []chartRelease
+	if p.GetCacheValue(key, &releases) {
+		p.log.V(1).Info("found chart versions in cache", "repo", conf.Repo, "chart", conf.Chart)
+		return releases, nil
+	}
+	index, err := p.GetIndex(conf.Repo)
 	if err != nil {
 		return nil, err
 	}
-	p.SetCacheValue(ReleasesCacheKey(repo), index)
-	return index, nil
+	releases = []chartRelease{}
+	for _, chartVersion := range index.Entries[conf.Chart] {
+		release := chartRelease{}
+		if conf.Strategy == v1alpha1.HelmStrategyChartVersion {
+			release.Version = chartVersion.Version
+		} else if conf.Strategy == v1alpha1.HelmStrategyAppVersion {
+			release.Version = chartVersion.AppVersion
+		}
+		if created, err := time.Parse(time.RFC3339Nano, chartVersion.Created); err == nil {
+			release.Created = created.Unix()
+		}
+		releases = append(releases, release)
+	}
+	p.SetCacheValue(key, releases)
+	return releases, nil
 }
 
 func LoadIndex(data []byte) (*Index, error) {
@@ -93,25 +145,31 @@ func LoadIndex(data []byte) (*Index, error) {
 	return i, nil
 }
 
+// Strategies returns the remote strategies that the provider supports
+func (p *Provider) Strategies() []v1alpha1.RemoteStrategy {
+	return []v1alpha1.RemoteStrategy{v1alpha1.HelmStrategyChartVersion, v1alpha1.HelmStrategyAppVersion}
+}
+
+// Validate checks that the chart is set and the repo is a valid URL
+func (p *Provider) Validate(conf v1alpha1.RemoteVersion) error {
+	if conf.Chart == "" {
+		return fmt.Errorf("chart is required for the %s provider", Name)
+	}
+	if !strings.HasPrefix(conf.Repo, "https://") && !strings.HasPrefix(conf.Repo, "http://") {
+		return fmt.Errorf("invalid repo: %s. it must be the URL of the helm repository", conf.Repo)
+	}
+	return nil
+}
+
 func (p *Provider) GetVersions(conf v1alpha1.RemoteVersion) ([]string, error) {
 	var matchedVersions []string
 	var versions []string
-	index, err := p.GetIndex(conf.Repo)
+	chartVersions, err := p.getChartVersions(conf)
 	if err != nil {
 		return versions, err
 	}
-	chartVersions := index.Entries[conf.Chart]
-	if len(chartVersions) == 0 {
-		return versions, nil
-	}
-	for _, chartVersion := range chartVersions {
-		version := ""
-		if conf.Strategy == v1alpha1.HelmStrategyChartVersion {
-			version = chartVersion.Version
-		} else if conf.Strategy == v1alpha1.HelmStrategyAppVersion {
-			version = chartVersion.AppVersion
-		}
-		matched, v, err := utils.MatchPattern(conf.Extraction.Regex.Pattern, conf.Extraction.Regex.Result, version)
+	for _, release := range chartVersions {
+		matched, v, err := utils.MatchPattern(conf.Extraction.Regex.Pattern, conf.Extraction.Regex.Result, release.Version)
 		if err != nil {
 			return nil, err
 		}
@@ -134,3 +192,26 @@ func (p *Provider) GetVersions(conf v1alpha1.RemoteVersion) ([]string, error) {
 	}
 	return versions, nil
 }
+
+// GetReleaseDates returns the time that the versions were added to the repository. When several chart
+// versions package the same app version, the date of the first one is used
+func (p *Provider) GetReleaseDates(conf v1alpha1.RemoteVersion) (map[string]int64, error) {
+	releases, err := p.getChartVersions(conf)
+	if err != nil {
+		return nil, err
+	}
+	dates := map[string]int64{}
+	for _, release := range releases {
+		if release.Created == 0 {
+			continue
+		}
+		matched, v, err := utils.MatchPattern(conf.Extraction.Regex.Pattern, conf.Extraction.Regex.Result, release.Version)
+		if err != nil {
+			return nil, err
+		}
+		if matched && (dates[v] == 0 || release.Created < dates[v]) {
+			dates[v] = release.Created
+		}
+	}
+	return dates, nil
+}
@@ -0,0 +1,117 @@
+package helm
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/skillz/opvic/agent/api/v1alpha1"
+	"github.com/skillz/opvic/controlplane/storage"
+)
+
+const testIndex = `apiVersion: v1
+entries:
+  ingress-nginx:
+  - version: 4.0.3
+    appVersion: 1.0.1
+    created: "2021-09-30T10:00:00.123456789Z"
+  - version: 4.0.2
+    appVersion: 1.0.1
+    created: "2021-09-20T10:00:00Z"
+  - version: 4.0.1
+    appVersion: 1.0.0
+  cert-manager:
+  - version: 1.5.3
+    appVersion: 1.5.3
+`
+
+func TestProviderGetVersions(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/"+indexPath {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		requests++
+		w.Write([]byte(testIndex)) // nolint: errcheck
+	}))
+	defer server.Close()
+	p := NewProvider(storage.NewMemoryStore(time.Hour), logr.Discard())
+
+	tests := []struct {
+		name         string
+		chart        string
+		strategy     v1alpha1.RemoteStrategy
+		want         []string
+		wantRequests int
+	}{
+		{name: "chart_version", chart: "ingress-nginx", strategy: v1alpha1.HelmStrategyChartVersion, want: []string{"4.0.3", "4.0.2", "4.0.1"}, wantRequests: 1},
+		{name: "cached_chart_version", chart: "ingress-nginx", strategy: v1alpha1.HelmStrategyChartVersion, want: []string{"4.0.3", "4.0.2", "4.0.1"}, wantRequests: 1},
+		{name: "app_version", chart: "ingress-nginx", strategy: v1alpha1.HelmStrategyAppVersion, want: []string{"1.0.1", "1.0.1", "1.0.0"}, wantRequests: 2},
+		{name: "other_chart", chart: "cert-manager", strategy: v1alpha1.HelmStrategyChartVersion, want: []string{"1.5.3"}, wantRequests: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := v1alpha1.RemoteVersion{
+				Provider: Name,
+				Strategy: tt.strategy,
+				Repo:     server.URL,
+				Chart:    tt.chart,
+			}
+			conf.Extraction.Regex.Pattern = "^(.*)$"
+			conf.Extraction.Regex.Result = "$1"
+			got, err := p.GetVersions(conf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetVersions() = %v, want %v", got, tt.want)
+			}
+			if requests != tt.wantRequests {
+				t.Errorf("got %d index requests, want %d", requests, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestProviderGetReleaseDates(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testIndex)) // nolint: errcheck
+	}))
+	defer server.Close()
+	p := NewProvider(storage.NewMemoryStore(time.Hour), logr.Discard())
+	sep20 := time.Date(2021, 9, 20, 10, 0, 0, 0, time.UTC).Unix()
+	sep30 := time.Date(2021, 9, 30, 10, 0, 0, 0, time.UTC).Unix()
+
+	tests := []struct {
+		name     string
+		strategy v1alpha1.RemoteStrategy
+		want     map[string]int64
+	}{
+		{name: "chart_version", strategy: v1alpha1.HelmStrategyChartVersion, want: map[string]int64{"4.0.3": sep30, "4.0.2": sep20}},
+		// the app version was first packaged by 4.0.2
+		{name: "app_version", strategy: v1alpha1.HelmStrategyAppVersion, want: map[string]int64{"1.0.1": sep20}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := v1alpha1.RemoteVersion{
+				Provider: Name,
+				Strategy: tt.strategy,
+				Repo:     server.URL,
+				Chart:    "ingress-nginx",
+			}
+			conf.Extraction.Regex.Pattern = "^(.*)$"
+			conf.Extraction.Regex.Result = "$1"
+			got, err := p.GetReleaseDates(conf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetReleaseDates() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
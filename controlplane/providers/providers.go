@@ -3,60 +3,197 @@ package providers
 import (
 	"context"
 	"fmt"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/go-logr/logr"
-	"github.com/patrickmn/go-cache"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/skillz/opvic/agent/api/v1alpha1"
-	"github.com/skillz/opvic/controlplane/providers/github"
-	"github.com/skillz/opvic/controlplane/providers/helm"
+	"github.com/skillz/opvic/controlplane/storage"
 )
 
 const (
-	Github ProviderType = "github"
-	Helm   ProviderType = "helm"
+	metricNamespace = "opvic"
+	metricSubsystem = "provider"
 )
 
-type ProviderType string
+var (
+	requestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricNamespace,
+			Subsystem: metricSubsystem,
+			Name:      "requests_total",
+			Help:      "The number of remote version lookups by provider and status.",
+		},
+		[]string{"provider", "status"},
+	)
+	requestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricNamespace,
+			Subsystem: metricSubsystem,
+			Name:      "request_duration_seconds",
+			Help:      "Duration of remote version lookups by provider.",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{"provider"},
+	)
 
-func (p ProviderType) String() string {
-	return string(p)
+	factoriesMutex sync.RWMutex
+	factories      = map[string]Factory{}
+)
+
+func init() {
+	prometheus.MustRegister(requestsTotal, requestDuration)
+}
+
+// RemoteProvider gets the remote versions of a subject from an external source
+type RemoteProvider interface {
+	// GetVersions returns the remote versions after applying the extraction and constraint of the configuration
+	GetVersions(conf v1alpha1.RemoteVersion) ([]string, error)
+	// Strategies returns the list of remote strategies that the provider supports
+	Strategies() []v1alpha1.RemoteStrategy
+}
+
+// Validator can be implemented by a RemoteProvider to validate the provider specific fields of the configuration
+type Validator interface {
+	Validate(conf v1alpha1.RemoteVersion) error
+}
+
+// ReleaseDater can be implemented by a RemoteProvider that knows when the remote versions were published upstream
+type ReleaseDater interface {
+	// GetReleaseDates returns the unix time that each remote version was published.
+	// The versions without a publication date are omitted
+	GetReleaseDates(conf v1alpha1.RemoteVersion) (map[string]int64, error)
+}
+
+// Options are passed to a Factory when the control plane initializes the providers
+type Options struct {
+	Context context.Context
+	// Store caches the responses of the remote sources. It can be shared by multiple control plane replicas
+	Store  storage.Store
+	Logger logr.Logger
+}
+
+// Factory creates a RemoteProvider. Provider specific configuration should be captured by the factory.
+type Factory func(opts Options) (RemoteProvider, error)
+
+// Register makes a remote provider available by the name that is used in RemoteVersion.Provider.
+// It panics if the factory is nil or a provider with the same name is already registered.
+func Register(name string, factory Factory) {
+	factoriesMutex.Lock()
+	defer factoriesMutex.Unlock()
+	if factory == nil {
+		panic(fmt.Sprintf("providers: factory of provider %s is nil", name))
+	}
+	if _, found := factories[name]; found {
+		panic(fmt.Sprintf("providers: provider %s is already registered", name))
+	}
+	factories[name] = factory
+}
+
+// Registered returns the sorted names of all the registered providers
+func Registered() []string {
+	factoriesMutex.RLock()
+	defer factoriesMutex.RUnlock()
+	var names []string
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
 type Config struct {
 	Logger logr.Logger
-	Github *github.Config
 }
 
+// Provider dispatches the remote version lookups to the registered providers
 type Provider struct {
-	log    logr.Logger
-	Github *github.Provider
-	Helm   *helm.Provider
+	log       logr.Logger
+	providers map[string]RemoteProvider
 }
 
-func (c *Config) Init(ctx context.Context, cache *cache.Cache) (*Provider, error) {
-	var err error
-	p := &Provider{}
+// Init creates all the registered providers
+func (c *Config) Init(ctx context.Context, store storage.Store) (*Provider, error) {
 	logger := c.Logger.WithName("provider")
-	p.Github, err = c.Github.NewProvider(ctx, cache, logger.WithName("github"))
-	if err != nil {
-		return nil, err
+	p := &Provider{
+		log:       logger,
+		providers: map[string]RemoteProvider{},
 	}
-	p.Helm = helm.NewProvider(cache, logger.WithName("helm"))
-	p.log = logger
+	factoriesMutex.RLock()
+	defer factoriesMutex.RUnlock()
+	for name, factory := range factories {
+		provider, err := factory(Options{
+			Context: ctx,
+			Store:   store,
+			Logger:  logger.WithName(name),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize provider %s: %v", name, err)
+		}
+		p.providers[name] = provider
+	}
+	logger.V(1).Info("initialized remote providers", "providers", Registered())
 	return p, nil
 }
 
+// Validate checks that the provider exists and supports the strategy of the configuration
+func (p *Provider) Validate(conf v1alpha1.RemoteVersion) error {
+	if conf.Provider == "" || conf.Repo == "" {
+		return nil
+	}
+	provider, found := p.providers[conf.Provider]
+	if !found {
+		return fmt.Errorf("unknown provider %s", conf.Provider)
+	}
+	supported := false
+	for _, strategy := range provider.Strategies() {
+		if strategy == conf.Strategy {
+			supported = true
+			break
+		}
+	}
+	if !supported {
+		return fmt.Errorf("strategy %q is not supported by provider %s. supported strategies: %v", conf.Strategy, conf.Provider, provider.Strategies())
+	}
+	if v, ok := provider.(Validator); ok {
+		return v.Validate(conf)
+	}
+	return nil
+}
+
 func (p *Provider) GetVersions(conf v1alpha1.RemoteVersion) ([]string, error) {
 	if conf.Provider == "" || conf.Repo == "" {
 		p.log.V(1).Info("no remoteVersion configuration provided, skipping remote version lookup")
 		return []string{}, nil
 	}
-	switch conf.Provider {
-	case Github.String():
-		return p.Github.GetVersions(conf)
-	case Helm.String():
-		return p.Helm.GetVersions(conf)
-	default:
-		return nil, fmt.Errorf("unknown provider %s", conf.Provider)
+	if err := p.Validate(conf); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	versions, err := p.providers[conf.Provider].GetVersions(conf)
+	requestDuration.WithLabelValues(conf.Provider).Observe(time.Since(start).Seconds())
+	if err != nil {
+		requestsTotal.WithLabelValues(conf.Provider, "error").Inc()
+		return nil, err
+	}
+	requestsTotal.WithLabelValues(conf.Provider, "success").Inc()
+	return versions, nil
+}
+
+// GetReleaseDates returns the publication dates of the remote versions. It returns an empty map
+// if the provider doesn't know the publication dates
+func (p *Provider) GetReleaseDates(conf v1alpha1.RemoteVersion) (map[string]int64, error) {
+	if conf.Provider == "" || conf.Repo == "" {
+		return map[string]int64{}, nil
+	}
+	if err := p.Validate(conf); err != nil {
+		return nil, err
+	}
+	dater, ok := p.providers[conf.Provider].(ReleaseDater)
+	if !ok {
+		return map[string]int64{}, nil
 	}
+	return dater.GetReleaseDates(conf)
 }
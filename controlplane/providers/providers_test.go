@@ -0,0 +1,98 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/skillz/opvic/agent/api/v1alpha1"
+	"github.com/skillz/opvic/controlplane/storage"
+)
+
+type fakeProvider struct {
+	versions []string
+}
+
+func (f *fakeProvider) GetVersions(conf v1alpha1.RemoteVersion) ([]string, error) {
+	return f.versions, nil
+}
+
+func (f *fakeProvider) Strategies() []v1alpha1.RemoteStrategy {
+	return []v1alpha1.RemoteStrategy{v1alpha1.GithubStrategyTags}
+}
+
+func (f *fakeProvider) Validate(conf v1alpha1.RemoteVersion) error {
+	if conf.Chart != "" {
+		return fmt.Errorf("chart is not supported")
+	}
+	return nil
+}
+
+func init() {
+	Register("fake", func(opts Options) (RemoteProvider, error) {
+		return &fakeProvider{versions: []string{"1.0.0", "1.1.0"}}, nil
+	})
+}
+
+func TestRegisterDuplicate(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("Register() expected a panic when registering a duplicate provider")
+		}
+	}()
+	Register("fake", func(opts Options) (RemoteProvider, error) { return &fakeProvider{}, nil })
+}
+
+func TestProviderGetVersions(t *testing.T) {
+	conf := &Config{Logger: logr.Discard()}
+	p, err := conf.Init(context.Background(), storage.NewMemoryStore(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		conf    v1alpha1.RemoteVersion
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "registered_provider",
+			conf: v1alpha1.RemoteVersion{Provider: "fake", Strategy: v1alpha1.GithubStrategyTags, Repo: "owner/repo"},
+			want: []string{"1.0.0", "1.1.0"},
+		},
+		{
+			name: "no_remote_version",
+			conf: v1alpha1.RemoteVersion{},
+			want: []string{},
+		},
+		{
+			name:    "unknown_provider",
+			conf:    v1alpha1.RemoteVersion{Provider: "unknown", Strategy: v1alpha1.GithubStrategyTags, Repo: "owner/repo"},
+			wantErr: true,
+		},
+		{
+			name:    "unsupported_strategy",
+			conf:    v1alpha1.RemoteVersion{Provider: "fake", Strategy: v1alpha1.HelmStrategyAppVersion, Repo: "owner/repo"},
+			wantErr: true,
+		},
+		{
+			name:    "provider_validation",
+			conf:    v1alpha1.RemoteVersion{Provider: "fake", Strategy: v1alpha1.GithubStrategyTags, Repo: "owner/repo", Chart: "chart"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := p.GetVersions(tt.conf)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetVersions() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetVersions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
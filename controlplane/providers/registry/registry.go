@@ -0,0 +1,136 @@
+package registry
+
+import (
+	"fmt"
+
+	"github.com/go-logr/logr"
+	"github.com/hashicorp/go-version"
+	"github.com/skillz/opvic/agent/api/v1alpha1"
+	"github.com/skillz/opvic/controlplane/providers"
+	"github.com/skillz/opvic/controlplane/storage"
+	"github.com/skillz/opvic/oci"
+	"github.com/skillz/opvic/utils"
+)
+
+// Name of the provider that is used in the RemoteVersion configuration
+const Name = "registry"
+
+// Config contains configuration for the OCI registry provider
+type Config struct {
+	Username string
+	Password string
+}
+
+// Provider is a registry provider for getting remote versions from the tags of an OCI image repository
+type Provider struct {
+	client *oci.Client
+	store  storage.Store
+	log    logr.Logger
+}
+
+// Factory returns a factory for registering the provider with this configuration
+func (c *Config) Factory() providers.Factory {
+	return func(opts providers.Options) (providers.RemoteProvider, error) {
+		return c.NewProvider(opts.Store, opts.Logger), nil
+	}
+}
+
+func (c *Config) NewProvider(store storage.Store, logger logr.Logger) *Provider {
+	return &Provider{
+		client: oci.NewClient(c.Username, c.Password),
+		store:  store,
+		log:    logger,
+	}
+}
+
+func (p *Provider) getCacheValue(key string, value interface{}) bool {
+	found, err := p.store.Get(key, value)
+	if err != nil {
+		p.log.Error(err, "failed to get the value from the cache", "key", key)
+		return false
+	}
+	return found
+}
+
+func (p *Provider) setCacheValue(key string, value interface{}) {
+	if err := p.store.Set(key, value); err != nil {
+		p.log.Error(err, "failed to cache the value", "key", key)
+	}
+}
+
+func tagsCacheKey(ref oci.Reference) string {
+	return fmt.Sprintf("registry/%s/tags", ref)
+}
+
+func (p *Provider) getTags(repo string) ([]string, error) {
+	ref, err := oci.ParseReference(repo)
+	if err != nil {
+		return nil, err
+	}
+	log := p.log.WithValues("repo", ref.String())
+	var tags []string
+	if p.getCacheValue(tagsCacheKey(ref), &tags) {
+		log.V(1).Info("found tags in cache")
+		return tags, nil
+	}
+	log.V(1).Info("getting tags")
+	tags, err = p.client.ListTags(ref)
+	if err != nil {
+		return nil, err
+	}
+	p.setCacheValue(tagsCacheKey(ref), tags)
+	return tags, nil
+}
+
+func (p *Provider) getVersionsFromTags(conf v1alpha1.RemoteVersion) ([]string, error) {
+	var matchedVersions []string
+	var versions []string
+	tags, err := p.getTags(conf.Repo)
+	if err != nil {
+		return nil, err
+	}
+	for _, tag := range tags {
+		if tag == "" {
+			continue
+		}
+		matched, v, err := utils.MatchPattern(conf.Extraction.Regex.Pattern, conf.Extraction.Regex.Result, tag)
+		if err != nil {
+			return nil, err
+		}
+		if !matched {
+			continue
+		}
+		// registries usually have tags like latest or stable next to the versioned ones
+		if _, err := version.NewVersion(v); err != nil {
+			p.log.V(1).Info("skipping tag that is not a valid version", "tag", tag, "version", v)
+			continue
+		}
+		matchedVersions = append(matchedVersions, v)
+	}
+	if conf.Constraint == "" {
+		return matchedVersions, nil
+	} else {
+		for _, version := range matchedVersions {
+			meet, err := utils.MeetConstraint(conf.Constraint, version)
+			if err != nil {
+				return nil, err
+			}
+			if meet {
+				versions = append(versions, version)
+			}
+		}
+	}
+	return versions, nil
+}
+
+// Strategies returns the remote strategies that the provider supports
+func (p *Provider) Strategies() []v1alpha1.RemoteStrategy {
+	return []v1alpha1.RemoteStrategy{v1alpha1.RegistryStrategyTags}
+}
+
+func (p *Provider) GetVersions(conf v1alpha1.RemoteVersion) ([]string, error) {
+	if conf.Strategy == v1alpha1.RegistryStrategyTags {
+		return p.getVersionsFromTags(conf)
+	}
+	return nil, fmt.Errorf("strategy %s is not supported", conf.Strategy)
+}
@@ -0,0 +1,87 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/skillz/opvic/agent/api/v1alpha1"
+	"github.com/skillz/opvic/controlplane/storage"
+)
+
+// newTestRegistry starts a registry stand-in that returns all the tags of the repository
+func newTestRegistry(t *testing.T, name string, tags []string) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc(fmt.Sprintf("/v2/%s/tags/list", name), func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"name": name, "tags": tags}) // nolint: errcheck
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestProviderGetVersions(t *testing.T) {
+	server := newTestRegistry(t, "skillz/opvic", []string{"latest", "v0.1.0", "v0.1.1", "v0.2.0", "v0.2.0-rc.1", "v1.0.0", "stable"})
+	repo := server.URL + "/skillz/opvic"
+	tests := []struct {
+		name    string
+		conf    v1alpha1.RemoteVersion
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "all_versions",
+			conf: v1alpha1.RemoteVersion{
+				Provider: "registry",
+				Strategy: v1alpha1.RegistryStrategyTags,
+				Repo:     repo,
+			},
+			want: []string{"v0.1.0", "v0.1.1", "v0.2.0", "v0.2.0-rc.1", "v1.0.0"},
+		},
+		{
+			name: "extraction_and_constraint",
+			conf: v1alpha1.RemoteVersion{
+				Provider: "registry",
+				Strategy: v1alpha1.RegistryStrategyTags,
+				Repo:     repo,
+				Extraction: v1alpha1.Extraction{
+					Regex: v1alpha1.Regex{
+						Pattern: `^v([0-9]+\.[0-9]+\.[0-9]+)$`,
+						Result:  "$1",
+					},
+				},
+				Constraint: "< 1.0.0",
+			},
+			want: []string{"0.1.0", "0.1.1", "0.2.0"},
+		},
+		{
+			name: "unsupported_strategy",
+			conf: v1alpha1.RemoteVersion{
+				Provider: "registry",
+				Strategy: v1alpha1.GithubStrategyReleases,
+				Repo:     repo,
+			},
+			wantErr: true,
+		},
+	}
+	conf := &Config{}
+	p := conf.NewProvider(storage.NewMemoryStore(0), logr.Discard())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := p.GetVersions(tt.conf)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetVersions() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			sort.Strings(got)
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetVersions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
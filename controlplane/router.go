@@ -4,6 +4,7 @@ import (
 	"github.com/gin-gonic/gin"
 
 	api "github.com/skillz/opvic/controlplane/api/v1alpha1"
+	"github.com/skillz/opvic/controlplane/dashboard"
 )
 
 func (cp *ControlPlane) SetupRouter() *gin.Engine {
@@ -30,15 +31,25 @@ func (cp *ControlPlane) SetupRouter() *gin.Engine {
 	// Ping router
 	v1alpha1.GET(api.PingAPIPath, func(c *gin.Context) { c.String(200, "pong") })
 
-	// Agents router
+	// Agents router. The write routes check the agent scope of the caller in the handler
 	v1alpha1.POST(api.AgentsAPIPath, cp.AgentsPost())
-	v1alpha1.GET(api.AgentsAPIPath, cp.AgentsGet())
-	v1alpha1.GET(api.AgentAPIPath, cp.AgentGet())
-	v1alpha1.GET(api.AgentsSubjectVersionPath, cp.AgentsSubjectVersionGet())
-	v1alpha1.GET(api.AgentsSubjectVersionInfoPath, cp.AgentsSubjectVersionsInfoGet())
+	v1alpha1.GET(api.AgentsAPIPath, ReadMiddleware(), cp.AgentsGet())
+	v1alpha1.GET(api.AgentAPIPath, ReadMiddleware(), cp.AgentGet())
+	v1alpha1.POST(api.AgentBatchAPIPath, cp.AgentBatchPost())
+	v1alpha1.GET(api.AgentsSubjectVersionPath, ReadMiddleware(), cp.AgentsSubjectVersionGet())
+	v1alpha1.DELETE(api.AgentsSubjectVersionPath, cp.AgentsSubjectVersionDelete())
+	v1alpha1.GET(api.AgentsSubjectVersionInfoPath, ReadMiddleware(), cp.AgentsSubjectVersionsInfoGet())
+	v1alpha1.GET(api.AgentsSubjectVersionHistoryPath, ReadMiddleware(), cp.AgentsSubjectVersionHistoryGet())
 
 	// Overview router
-	v1alpha1.GET(api.OverviewAPIPath, cp.OverviewGet())
+	v1alpha1.GET(api.OverviewAPIPath, ReadMiddleware(), cp.OverviewGet())
+
+	// Dashboard router
+	if cp.dashboard {
+		if err := dashboard.Register(r); err != nil {
+			cp.log.Error(err, "failed to set up the dashboard")
+		}
+	}
 
 	return r
 }
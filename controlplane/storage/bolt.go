@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var stateBucket = []byte("state")
+
+// BoltStore keeps the state in an embedded BoltDB file so it survives restarts
+type BoltStore struct {
+	db         *bolt.DB
+	expiration time.Duration
+}
+
+func NewBoltStore(path string, expiration time.Duration) (*BoltStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	// the file is locked while it is open. don't block forever if another process holds the lock
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(stateBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltStore{
+		db:         db,
+		expiration: expiration,
+	}, nil
+}
+
+func (b *BoltStore) Get(key string, value interface{}) (bool, error) {
+	var e *entry
+	err := b.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(stateBucket).Get([]byte(key))
+		if data == nil {
+			return nil
+		}
+		e = &entry{}
+		return json.Unmarshal(data, e)
+	})
+	if err != nil {
+		return false, err
+	}
+	if e == nil || e.expired(time.Now()) {
+		return false, nil
+	}
+	if err := json.Unmarshal(e.Value, value); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (b *BoltStore) Set(key string, value interface{}) error {
+	return b.SetWithExpiration(key, value, b.expiration)
+}
+
+func (b *BoltStore) SetWithExpiration(key string, value interface{}, d time.Duration) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	e, err := json.Marshal(entry{
+		Expiration: expiration(d),
+		Value:      data,
+	})
+	if err != nil {
+		return err
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(stateBucket).Put([]byte(key), e)
+	})
+}
+
+func (b *BoltStore) Update(key string, value interface{}, update func(found bool) (bool, error)) error {
+	// the read-write transactions of bolt are serialized
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(stateBucket)
+		reset(value)
+		found := false
+		if data := bucket.Get([]byte(key)); data != nil {
+			var e entry
+			if err := json.Unmarshal(data, &e); err != nil {
+				return err
+			}
+			if !e.expired(time.Now()) {
+				if err := json.Unmarshal(e.Value, value); err != nil {
+					return err
+				}
+				found = true
+			}
+		}
+		changed, err := update(found)
+		if err != nil || !changed {
+			return err
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		e, err := json.Marshal(entry{
+			Expiration: expiration(b.expiration),
+			Value:      data,
+		})
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(key), e)
+	})
+}
+
+func (b *BoltStore) Delete(key string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(stateBucket).Delete([]byte(key))
+	})
+}
+
+func (b *BoltStore) DeleteExpired() error {
+	now := time.Now()
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(stateBucket)
+		var expired [][]byte
+		err := bucket.ForEach(func(k, v []byte) error {
+			var e entry
+			if err := json.Unmarshal(v, &e); err != nil || e.expired(now) {
+				expired = append(expired, append([]byte{}, k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range expired {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (b *BoltStore) Close() error {
+	return b.db.Close()
+}
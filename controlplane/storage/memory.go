@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+)
+
+// MemoryStore keeps the state in an in-memory cache
+type MemoryStore struct {
+	cache *cache.Cache
+	// serializes the writes so an update is not interleaved with other writes of the key
+	mutex sync.Mutex
+}
+
+func NewMemoryStore(expiration time.Duration) *MemoryStore {
+	if expiration <= 0 {
+		expiration = cache.NoExpiration
+	}
+	return &MemoryStore{
+		cache: cache.New(expiration, cache.NoExpiration),
+	}
+}
+
+func (m *MemoryStore) Get(key string, value interface{}) (bool, error) {
+	data, found := m.cache.Get(key)
+	if !found {
+		return false, nil
+	}
+	if err := json.Unmarshal(data.([]byte), value); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (m *MemoryStore) Set(key string, value interface{}) error {
+	return m.set(key, value, cache.DefaultExpiration)
+}
+
+func (m *MemoryStore) SetWithExpiration(key string, value interface{}, expiration time.Duration) error {
+	if expiration <= 0 {
+		expiration = cache.NoExpiration
+	}
+	return m.set(key, value, expiration)
+}
+
+func (m *MemoryStore) set(key string, value interface{}, expiration time.Duration) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.cache.Set(key, data, expiration)
+	return nil
+}
+
+func (m *MemoryStore) Update(key string, value interface{}, update func(found bool) (bool, error)) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	reset(value)
+	found, err := m.Get(key, value)
+	if err != nil {
+		return err
+	}
+	changed, err := update(found)
+	if err != nil || !changed {
+		return err
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	m.cache.Set(key, data, cache.DefaultExpiration)
+	return nil
+}
+
+func (m *MemoryStore) Delete(key string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.cache.Delete(key)
+	return nil
+}
+
+func (m *MemoryStore) DeleteExpired() error {
+	m.cache.DeleteExpired()
+	return nil
+}
+
+func (m *MemoryStore) Close() error {
+	return nil
+}
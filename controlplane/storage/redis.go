@@ -0,0 +1,230 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultRedisPrefix is prepended to all the keys that the control plane stores in Redis
+	DefaultRedisPrefix = "opvic/"
+	// maximum number of attempts of an update when other writers keep changing the key
+	maxUpdateAttempts = 10
+)
+
+// acquireLockScript takes the lock if it is free or renews it if it is already held by the caller
+var acquireLockScript = redis.NewScript(1, `
+local owner = redis.call("GET", KEYS[1])
+if owner == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+if owner then
+	return 0
+end
+if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return 1
+end
+return 0
+`)
+
+// releaseLockScript deletes the lock only if it is held by the caller
+var releaseLockScript = redis.NewScript(1, `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// RedisStore keeps the state in Redis so it can be shared by multiple control plane replicas
+type RedisStore struct {
+	pool       *redis.Pool
+	prefix     string
+	expiration time.Duration
+	// identifies this replica as the owner of the locks
+	id string
+}
+
+// RedisConfig contains the connection settings of the Redis backend
+type RedisConfig struct {
+	// Address of the Redis server in host:port format
+	Address  string
+	Password string
+	DB       int
+	// Prefix of all the keys. Defaults to DefaultRedisPrefix
+	Prefix string
+}
+
+func NewRedisStore(conf RedisConfig, expiration time.Duration) (*RedisStore, error) {
+	if conf.Address == "" {
+		return nil, fmt.Errorf("address is required for the %s storage backend", Redis)
+	}
+	prefix := conf.Prefix
+	if prefix == "" {
+		prefix = DefaultRedisPrefix
+	}
+	pool := &redis.Pool{
+		MaxIdle:     10,
+		IdleTimeout: 5 * time.Minute,
+		Dial: func() (redis.Conn, error) {
+			return redis.Dial("tcp", conf.Address,
+				redis.DialPassword(conf.Password),
+				redis.DialDatabase(conf.DB),
+				redis.DialConnectTimeout(5*time.Second),
+			)
+		},
+	}
+	conn := pool.Get()
+	_, err := conn.Do("PING")
+	conn.Close()
+	if err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("failed to connect to redis at %s: %v", conf.Address, err)
+	}
+	hostname, _ := os.Hostname()
+	return &RedisStore{
+		pool:       pool,
+		prefix:     prefix,
+		expiration: expiration,
+		id:         fmt.Sprintf("%s-%s", hostname, uuid.New().String()),
+	}, nil
+}
+
+func (r *RedisStore) key(key string) string {
+	return r.prefix + key
+}
+
+func (r *RedisStore) Get(key string, value interface{}) (bool, error) {
+	conn := r.pool.Get()
+	defer conn.Close()
+	data, err := redis.Bytes(conn.Do("GET", r.key(key)))
+	if err == redis.ErrNil {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal(data, value); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (r *RedisStore) Set(key string, value interface{}) error {
+	return r.SetWithExpiration(key, value, r.expiration)
+}
+
+func (r *RedisStore) SetWithExpiration(key string, value interface{}, expiration time.Duration) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	conn := r.pool.Get()
+	defer conn.Close()
+	// a zero expiration means the key has no TTL
+	if expiration <= 0 {
+		_, err = conn.Do("SET", r.key(key), data)
+		return err
+	}
+	_, err = conn.Do("SET", r.key(key), data, "PX", expiration.Milliseconds())
+	return err
+}
+
+// Update watches the key and only sets it if no other writer changed it since it was read, otherwise the update is retried
+func (r *RedisStore) Update(key string, value interface{}, update func(found bool) (bool, error)) error {
+	conn := r.pool.Get()
+	defer conn.Close()
+	key = r.key(key)
+	for i := 0; i < maxUpdateAttempts; i++ {
+		if _, err := conn.Do("WATCH", key); err != nil {
+			return err
+		}
+		changed, data, err := r.decodeAndUpdate(conn, key, value, update)
+		if err != nil || !changed {
+			conn.Do("UNWATCH") // nolint: errcheck
+			return err
+		}
+		if err := conn.Send("MULTI"); err != nil {
+			return err
+		}
+		if r.expiration > 0 {
+			err = conn.Send("SET", key, data, "PX", r.expiration.Milliseconds())
+		} else {
+			err = conn.Send("SET", key, data)
+		}
+		if err != nil {
+			return err
+		}
+		// the transaction is aborted with a nil reply if the key was changed
+		reply, err := conn.Do("EXEC")
+		if err != nil {
+			return err
+		}
+		if reply != nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("failed to update %s: the key kept changing", key)
+}
+
+func (r *RedisStore) decodeAndUpdate(conn redis.Conn, key string, value interface{}, update func(found bool) (bool, error)) (bool, []byte, error) {
+	reset(value)
+	data, err := redis.Bytes(conn.Do("GET", key))
+	if err != nil && err != redis.ErrNil {
+		return false, nil, err
+	}
+	found := err == nil
+	if found {
+		if err := json.Unmarshal(data, value); err != nil {
+			return false, nil, err
+		}
+	}
+	changed, err := update(found)
+	if err != nil || !changed {
+		return false, nil, err
+	}
+	data, err = json.Marshal(value)
+	if err != nil {
+		return false, nil, err
+	}
+	return true, data, nil
+}
+
+func (r *RedisStore) Delete(key string) error {
+	conn := r.pool.Get()
+	defer conn.Close()
+	_, err := conn.Do("DEL", r.key(key))
+	return err
+}
+
+// DeleteExpired is a no-op. Redis removes the expired keys by itself
+func (r *RedisStore) DeleteExpired() error {
+	return nil
+}
+
+// AcquireLock takes or renews the lock for the ttl. It returns false if the lock is held by another replica
+func (r *RedisStore) AcquireLock(name string, ttl time.Duration) (bool, error) {
+	conn := r.pool.Get()
+	defer conn.Close()
+	res, err := redis.Int(acquireLockScript.Do(conn, r.key("locks/"+name), r.id, ttl.Milliseconds()))
+	if err != nil {
+		return false, err
+	}
+	return res == 1, nil
+}
+
+// ReleaseLock gives up the lock if it is held by this replica
+func (r *RedisStore) ReleaseLock(name string) error {
+	conn := r.pool.Get()
+	defer conn.Close()
+	_, err := releaseLockScript.Do(conn, r.key("locks/"+name), r.id)
+	return err
+}
+
+func (r *RedisStore) Close() error {
+	return r.pool.Close()
+}
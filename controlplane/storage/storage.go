@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+)
+
+const (
+	// Memory keeps the state in memory. The state is lost when the control plane restarts
+	Memory = "memory"
+	// Bolt keeps the state in an embedded BoltDB file
+	Bolt = "bolt"
+	// Redis keeps the state in a Redis server that can be shared by multiple control plane replicas
+	Redis = "redis"
+)
+
+// Store persists the state of the control plane. Values are encoded as JSON so the
+// caller always gets a copy of the stored value.
+type Store interface {
+	// Get decodes the value of the key into value. It returns false if the key does not exist or has expired
+	Get(key string, value interface{}) (bool, error)
+	// Set stores the value of the key with the default expiration of the store
+	Set(key string, value interface{}) error
+	// SetWithExpiration stores the value of the key with the expiration. The key never expires if it is zero
+	SetWithExpiration(key string, value interface{}, expiration time.Duration) error
+	// Update atomically replaces the value of the key so concurrent writers don't overwrite each other.
+	// The current value is decoded into value, which must be a pointer, and update returns true if it changed it.
+	// The changed value is stored with the default expiration of the store. update is called again if another
+	// writer changed the key in the meantime
+	Update(key string, value interface{}, update func(found bool) (bool, error)) error
+	// Delete removes the key from the store
+	Delete(key string) error
+	// DeleteExpired removes all the expired keys from the store
+	DeleteExpired() error
+	// Close releases the resources used by the store
+	Close() error
+}
+
+// Locker can be implemented by a Store that is shared by multiple control plane replicas
+// to elect the replica that runs the background jobs
+type Locker interface {
+	// AcquireLock takes or renews the lock for the ttl. It returns false if the lock is held by someone else
+	AcquireLock(name string, ttl time.Duration) (bool, error)
+	// ReleaseLock gives up the lock if it is held by the caller
+	ReleaseLock(name string) error
+}
+
+// AcquireLock takes the lock if the store supports locking. Stores that are not shared
+// always grant the lock since the control plane is the only one using them.
+func AcquireLock(store Store, name string, ttl time.Duration) (bool, error) {
+	if l, ok := store.(Locker); ok {
+		return l.AcquireLock(name, ttl)
+	}
+	return true, nil
+}
+
+// ReleaseLock releases the lock if the store supports locking
+func ReleaseLock(store Store, name string) error {
+	if l, ok := store.(Locker); ok {
+		return l.ReleaseLock(name)
+	}
+	return nil
+}
+
+// Config contains the configuration of the control plane storage
+type Config struct {
+	// Storage backend (memory, bolt or redis)
+	Backend string
+	// Path of the database file for the bolt backend
+	Path string
+	// Connection settings of the redis backend
+	Redis RedisConfig
+	// Default expiration of the keys. Keys never expire if it is zero
+	Expiration time.Duration
+}
+
+// NewStore creates the store of the configured backend
+func (c *Config) NewStore() (Store, error) {
+	switch c.Backend {
+	case "", Memory:
+		return NewMemoryStore(c.Expiration), nil
+	case Bolt:
+		if c.Path == "" {
+			return nil, fmt.Errorf("path is required for the %s storage backend", Bolt)
+		}
+		store, err := NewBoltStore(c.Path, c.Expiration)
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	case Redis:
+		store, err := NewRedisStore(c.Redis, c.Expiration)
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %s", c.Backend)
+	}
+}
+
+// entry wraps a stored value with its expiration time
+type entry struct {
+	// Expiration time in unix nanoseconds. Zero means the entry does not expire
+	Expiration int64  `json:"expiration"`
+	Value      []byte `json:"value"`
+}
+
+func (e *entry) expired(now time.Time) bool {
+	return e.Expiration > 0 && now.UnixNano() > e.Expiration
+}
+
+func expiration(d time.Duration) int64 {
+	if d <= 0 {
+		return 0
+	}
+	return time.Now().Add(d).UnixNano()
+}
+
+// reset sets the value that the pointer points to to its zero value before the current value is decoded into it
+func reset(value interface{}) {
+	v := reflect.ValueOf(value).Elem()
+	v.Set(reflect.Zero(v.Type()))
+}
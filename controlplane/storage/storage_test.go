@@ -0,0 +1,285 @@
+package storage
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+type testValue struct {
+	ID       string   `json:"id"`
+	Versions []string `json:"versions"`
+}
+
+func testStores(t *testing.T, expiration time.Duration) map[string]Store {
+	bolt, err := NewBoltStore(filepath.Join(t.TempDir(), "opvic.db"), expiration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { bolt.Close() })
+	return map[string]Store{
+		Memory: NewMemoryStore(expiration),
+		Bolt:   bolt,
+	}
+}
+
+// newTestRedisStore starts an in-process Redis server and connects a store to it
+func newTestRedisStore(t *testing.T, expiration time.Duration) (*RedisStore, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	store, err := NewRedisStore(RedisConfig{Address: mr.Addr()}, expiration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store, mr
+}
+
+func TestStoreSetGetDelete(t *testing.T) {
+	want := testValue{ID: "coredns", Versions: []string{"1.7.0", "1.8.0"}}
+	stores := testStores(t, time.Hour)
+	stores[Redis], _ = newTestRedisStore(t, time.Hour)
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			var got testValue
+			found, err := store.Get("agents/test", &got)
+			if err != nil || found {
+				t.Fatalf("Get() of a missing key = %v, %v", found, err)
+			}
+			if err := store.Set("agents/test", want); err != nil {
+				t.Fatal(err)
+			}
+			found, err = store.Get("agents/test", &got)
+			if err != nil || !found {
+				t.Fatalf("Get() = %v, %v", found, err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Get() = %v, want %v", got, want)
+			}
+			if err := store.Delete("agents/test"); err != nil {
+				t.Fatal(err)
+			}
+			if found, _ := store.Get("agents/test", &got); found {
+				t.Errorf("Get() found the deleted key")
+			}
+		})
+	}
+}
+
+func TestStoreExpiration(t *testing.T) {
+	for name, store := range testStores(t, time.Millisecond) {
+		t.Run(name, func(t *testing.T) {
+			if err := store.Set("key", "value"); err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(10 * time.Millisecond)
+			var got string
+			if found, _ := store.Get("key", &got); found {
+				t.Errorf("Get() found an expired key")
+			}
+			if err := store.DeleteExpired(); err != nil {
+				t.Errorf("DeleteExpired() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestStoreSetWithoutExpiration(t *testing.T) {
+	stores := testStores(t, time.Millisecond)
+	redisStore, mr := newTestRedisStore(t, time.Millisecond)
+	stores[Redis] = redisStore
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			if err := store.SetWithExpiration("key", "value", 0); err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(10 * time.Millisecond)
+			mr.FastForward(time.Hour)
+			var got string
+			if found, _ := store.Get("key", &got); !found || got != "value" {
+				t.Errorf("Get() = %v, %q, want the key without expiration", found, got)
+			}
+		})
+	}
+}
+
+func TestStoreUpdate(t *testing.T) {
+	stores := map[string][]Store{}
+	for name, store := range testStores(t, time.Hour) {
+		stores[name] = []Store{store}
+	}
+	// the replicas share the same Redis server
+	mr := miniredis.RunT(t)
+	for i := 0; i < 2; i++ {
+		store, err := NewRedisStore(RedisConfig{Address: mr.Addr()}, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { store.Close() })
+		stores[Redis] = append(stores[Redis], store)
+	}
+	for name, replicas := range stores {
+		t.Run(name, func(t *testing.T) {
+			var value testValue
+			err := replicas[0].Update("unchanged", &value, func(found bool) (bool, error) {
+				return false, nil
+			})
+			if found, _ := replicas[0].Get("unchanged", &value); err != nil || found {
+				t.Errorf("Update() = %v stored the unchanged value", err)
+			}
+
+			// each writer adds its version to the same key
+			var wg sync.WaitGroup
+			want := []string{}
+			for i := 0; i < 10; i++ {
+				version := fmt.Sprintf("1.%d.0", i)
+				want = append(want, version)
+				wg.Add(1)
+				go func(store Store) {
+					defer wg.Done()
+					var value testValue
+					err := store.Update("agents/test", &value, func(found bool) (bool, error) {
+						value.Versions = append(value.Versions, version)
+						return true, nil
+					})
+					if err != nil {
+						t.Errorf("Update() error = %v", err)
+					}
+				}(replicas[i%len(replicas)])
+			}
+			wg.Wait()
+			var got testValue
+			if _, err := replicas[0].Get("agents/test", &got); err != nil {
+				t.Fatal(err)
+			}
+			sort.Strings(got.Versions)
+			if !reflect.DeepEqual(got.Versions, want) {
+				t.Errorf("got versions %v, want the versions of all the writers %v", got.Versions, want)
+			}
+		})
+	}
+}
+
+func TestRedisStoreExpiration(t *testing.T) {
+	store, mr := newTestRedisStore(t, time.Minute)
+	if err := store.Set("key", "value"); err != nil {
+		t.Fatal(err)
+	}
+	if !mr.Exists(DefaultRedisPrefix + "key") {
+		t.Fatalf("key is not stored with the %s prefix", DefaultRedisPrefix)
+	}
+	mr.FastForward(2 * time.Minute)
+	var got string
+	if found, _ := store.Get("key", &got); found {
+		t.Errorf("Get() found an expired key")
+	}
+}
+
+func TestRedisStoreLock(t *testing.T) {
+	mr := miniredis.RunT(t)
+	var replicas []*RedisStore
+	for i := 0; i < 2; i++ {
+		store, err := NewRedisStore(RedisConfig{Address: mr.Addr()}, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer store.Close()
+		replicas = append(replicas, store)
+	}
+	assertLock := func(store *RedisStore, want bool) {
+		t.Helper()
+		got, err := store.AcquireLock("reconcile", time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("AcquireLock() = %v, want %v", got, want)
+		}
+	}
+
+	assertLock(replicas[0], true)
+	assertLock(replicas[1], false)
+	// the owner renews the lock
+	assertLock(replicas[0], true)
+
+	// another replica takes over once the lock expires
+	mr.FastForward(2 * time.Minute)
+	assertLock(replicas[1], true)
+	assertLock(replicas[0], false)
+
+	// releasing the lock of another replica is a no-op
+	if err := replicas[0].ReleaseLock("reconcile"); err != nil {
+		t.Fatal(err)
+	}
+	assertLock(replicas[0], false)
+	if err := replicas[1].ReleaseLock("reconcile"); err != nil {
+		t.Fatal(err)
+	}
+	assertLock(replicas[0], true)
+}
+
+func TestAcquireLockWithoutLocker(t *testing.T) {
+	got, err := AcquireLock(NewMemoryStore(time.Hour), "reconcile", time.Minute)
+	if err != nil || !got {
+		t.Errorf("AcquireLock() = %v, %v, want the lock to be granted", got, err)
+	}
+}
+
+func TestBoltStorePersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "opvic.db")
+	store, err := NewBoltStore(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"agent-1", "agent-2"}
+	if err := store.Set("agents/list", want); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	store, err = NewBoltStore(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	var got []string
+	found, err := store.Get("agents/list", &got)
+	if err != nil || !found {
+		t.Fatalf("Get() after reopening = %v, %v", found, err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Get() = %v, want %v", got, want)
+	}
+}
+
+func TestConfigNewStore(t *testing.T) {
+	tests := []struct {
+		name    string
+		conf    Config
+		wantErr bool
+	}{
+		{name: "default", conf: Config{}},
+		{name: "memory", conf: Config{Backend: Memory}},
+		{name: "bolt", conf: Config{Backend: Bolt, Path: filepath.Join(t.TempDir(), "opvic.db")}},
+		{name: "bolt_without_path", conf: Config{Backend: Bolt}, wantErr: true},
+		{name: "redis", conf: Config{Backend: Redis, Redis: RedisConfig{Address: miniredis.RunT(t).Addr()}}},
+		{name: "redis_without_address", conf: Config{Backend: Redis}, wantErr: true},
+		{name: "unknown", conf: Config{Backend: "unknown"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, err := tt.conf.NewStore()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewStore() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if store != nil {
+				store.Close()
+			}
+		})
+	}
+}
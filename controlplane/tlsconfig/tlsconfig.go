@@ -0,0 +1,227 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// ServerConfig contains the TLS configuration of the control plane
+type ServerConfig struct {
+	CertFile string
+	KeyFile  string
+	// CA bundle used to verify the client certificates. Client certificates are not requested if empty
+	ClientCAFile string
+	// Reject the connections without a valid client certificate instead of falling back to the bearer tokens
+	RequireClientCert bool
+	Logger            logr.Logger
+}
+
+// Enabled returns true if the control plane should serve TLS
+func (c *ServerConfig) Enabled() bool {
+	return c != nil && (c.CertFile != "" || c.KeyFile != "")
+}
+
+// New returns a TLS config that reloads the certificate, the key and the client CA bundle when the files change
+func (c *ServerConfig) New() (*tls.Config, error) {
+	if c.CertFile == "" || c.KeyFile == "" {
+		return nil, fmt.Errorf("both the TLS certificate and key files are required")
+	}
+	if c.RequireClientCert && c.ClientCAFile == "" {
+		return nil, fmt.Errorf("a client CA file is required to verify the client certificates")
+	}
+	keyPair, err := NewKeyPair(c.CertFile, c.KeyFile, c.Logger)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: keyPair.GetCertificate,
+	}
+	if c.ClientCAFile == "" {
+		return config, nil
+	}
+	clientCAs, err := NewCertPool(c.ClientCAFile, c.Logger)
+	if err != nil {
+		return nil, err
+	}
+	clientAuth := tls.VerifyClientCertIfGiven
+	if c.RequireClientCert {
+		clientAuth = tls.RequireAndVerifyClientCert
+	}
+	config.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		return &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: keyPair.GetCertificate,
+			ClientAuth:     clientAuth,
+			ClientCAs:      clientCAs.Pool(),
+		}, nil
+	}
+	return config, nil
+}
+
+// ClientConfig contains the TLS configuration of the clients of the control plane
+type ClientConfig struct {
+	// CA bundle used to verify the control plane certificate. The system roots are used if empty
+	CAFile string
+	// Client certificate and key presented to the control plane
+	CertFile           string
+	KeyFile            string
+	InsecureSkipVerify bool
+	Logger             logr.Logger
+}
+
+// New returns a TLS config that reloads the client certificate and key when the files change
+func (c *ClientConfig) New() (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: c.InsecureSkipVerify, // nolint: gosec
+	}
+	if c.CAFile != "" {
+		roots, err := NewCertPool(c.CAFile, c.Logger)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = roots.Pool()
+	}
+	if c.CertFile != "" || c.KeyFile != "" {
+		if c.CertFile == "" || c.KeyFile == "" {
+			return nil, fmt.Errorf("both the client certificate and key files are required")
+		}
+		keyPair, err := NewKeyPair(c.CertFile, c.KeyFile, c.Logger)
+		if err != nil {
+			return nil, err
+		}
+		config.GetClientCertificate = keyPair.GetClientCertificate
+	}
+	return config, nil
+}
+
+// KeyPair is a certificate and key loaded from files.
+// The files are reloaded when their modification time changes (e.g. a renewed certificate in a mounted Kubernetes Secret)
+type KeyPair struct {
+	certFile string
+	keyFile  string
+	cert     *tls.Certificate
+	modTimes [2]time.Time
+	mutex    sync.Mutex
+	log      logr.Logger
+}
+
+func NewKeyPair(certFile, keyFile string, log logr.Logger) (*KeyPair, error) {
+	if log == nil {
+		log = logr.Discard()
+	}
+	k := &KeyPair{certFile: certFile, keyFile: keyFile, log: log}
+	if err := k.reload(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Certificate returns the current certificate. The previous certificate is kept if the files are invalid
+func (k *KeyPair) Certificate() *tls.Certificate {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	if err := k.reload(); err != nil {
+		k.log.Error(err, "failed to reload the certificate, keeping the current one", "cert", k.certFile)
+	}
+	return k.cert
+}
+
+func (k *KeyPair) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return k.Certificate(), nil
+}
+
+func (k *KeyPair) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return k.Certificate(), nil
+}
+
+func (k *KeyPair) reload() error {
+	modTimes, err := modTimes(k.certFile, k.keyFile)
+	if err != nil {
+		return err
+	}
+	if k.cert != nil && modTimes == k.modTimes {
+		return nil
+	}
+	cert, err := tls.LoadX509KeyPair(k.certFile, k.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load the certificate %s: %w", k.certFile, err)
+	}
+	if k.cert != nil {
+		k.log.Info("reloaded the certificate", "cert", k.certFile)
+	}
+	k.cert = &cert
+	k.modTimes = modTimes
+	return nil
+}
+
+// CertPool is a CA bundle loaded from a file and reloaded when its modification time changes
+type CertPool struct {
+	file    string
+	pool    *x509.CertPool
+	modTime time.Time
+	mutex   sync.Mutex
+	log     logr.Logger
+}
+
+func NewCertPool(file string, log logr.Logger) (*CertPool, error) {
+	if log == nil {
+		log = logr.Discard()
+	}
+	p := &CertPool{file: file, log: log}
+	if err := p.reload(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Pool returns the current CA bundle. The previous bundle is kept if the file is invalid
+func (p *CertPool) Pool() *x509.CertPool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if err := p.reload(); err != nil {
+		p.log.Error(err, "failed to reload the CA bundle, keeping the current one", "file", p.file)
+	}
+	return p.pool
+}
+
+func (p *CertPool) reload() error {
+	times, err := modTimes(p.file)
+	if err != nil {
+		return err
+	}
+	if p.pool != nil && times[0] == p.modTime {
+		return nil
+	}
+	data, err := ioutil.ReadFile(p.file)
+	if err != nil {
+		return err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return fmt.Errorf("no PEM certificate found in %s", p.file)
+	}
+	p.pool = pool
+	p.modTime = times[0]
+	return nil
+}
+
+func modTimes(files ...string) ([2]time.Time, error) {
+	var times [2]time.Time
+	for i, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return times, err
+		}
+		times[i] = info.ModTime()
+	}
+	return times, nil
+}
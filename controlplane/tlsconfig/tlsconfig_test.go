@@ -0,0 +1,184 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "opvic-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue writes a certificate signed by the CA and its key to the files
+func (ca *testCA) issue(t *testing.T, commonName string, serial int64, certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	writeFile(t, keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	if err := ioutil.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// make sure the modification time changes even on filesystems with a coarse resolution
+	mtime := time.Now().Add(time.Duration(len(data)) * time.Second)
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+	ca := newTestCA(t)
+	writeFile(t, path("ca.crt"), ca.pem)
+	ca.issue(t, "control-plane", 2, path("server.crt"), path("server.key"))
+	ca.issue(t, "prod", 3, path("client.crt"), path("client.key"))
+
+	serverConf := ServerConfig{CertFile: path("server.crt"), KeyFile: path("server.key"), ClientCAFile: path("ca.crt")}
+	config, err := serverConf.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.VerifiedChains) == 0 {
+			w.Write([]byte("anonymous")) // nolint: errcheck
+			return
+		}
+		w.Write([]byte(r.TLS.VerifiedChains[0][0].Subject.CommonName)) // nolint: errcheck
+	})}
+	go server.Serve(listener) // nolint: errcheck
+	defer server.Close()
+	url := "https://" + listener.Addr().String()
+
+	get := func(conf ClientConfig) (string, string, error) {
+		config, err := conf.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: config, DisableKeepAlives: true}}
+		resp, err := client.Get(url)
+		if err != nil {
+			return "", "", err
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		return string(body), resp.TLS.PeerCertificates[0].Subject.CommonName, err
+	}
+
+	tests := []struct {
+		name       string
+		conf       ClientConfig
+		wantClient string
+		wantErr    bool
+	}{
+		{name: "client_certificate", conf: ClientConfig{CAFile: path("ca.crt"), CertFile: path("client.crt"), KeyFile: path("client.key")}, wantClient: "prod"},
+		{name: "without_client_certificate", conf: ClientConfig{CAFile: path("ca.crt")}, wantClient: "anonymous"},
+		{name: "unknown_ca", conf: ClientConfig{}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server, err := get(tt.conf)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GET error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if client != tt.wantClient {
+				t.Errorf("got client %q, want %q", client, tt.wantClient)
+			}
+			if server != "control-plane" {
+				t.Errorf("got server certificate %q, want control-plane", server)
+			}
+		})
+	}
+
+	// the renewed server certificate is served without a restart
+	ca.issue(t, "control-plane-renewed", 4, path("server.crt"), path("server.key"))
+	if _, server, err := get(ClientConfig{CAFile: path("ca.crt")}); err != nil || server != "control-plane-renewed" {
+		t.Errorf("got server certificate %q, %v, want the renewed certificate", server, err)
+	}
+}
+
+func TestServerConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		conf ServerConfig
+	}{
+		{name: "missing_key", conf: ServerConfig{CertFile: "tls.crt"}},
+		{name: "client_cert_without_ca", conf: ServerConfig{CertFile: "tls.crt", KeyFile: "tls.key", RequireClientCert: true}},
+		{name: "missing_files", conf: ServerConfig{CertFile: "tls.crt", KeyFile: "tls.key"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.conf.New(); err == nil {
+				t.Error("New() succeeded, want an error")
+			}
+		})
+	}
+}
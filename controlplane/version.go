@@ -1,7 +1,11 @@
 package controlplane
 
 import (
+	"time"
+
+	"github.com/skillz/opvic/controlplane/advisory"
 	api "github.com/skillz/opvic/controlplane/api/v1alpha1"
+	"github.com/skillz/opvic/controlplane/lifecycle"
 	"github.com/skillz/opvic/controlplane/version"
 	"github.com/skillz/opvic/utils"
 )
@@ -24,6 +28,16 @@ func (cp *ControlPlane) GetSubjectVersionInfos(agentID string, ver *api.SubjectV
 		log.Error(err, "failed to get remote versions")
 		return api.VersionInfos{}, err
 	}
+	now := time.Now()
+	released := map[string]int64{}
+	if len(remoteversions) > 0 {
+		published, err := cp.provider.GetReleaseDates(ver.RemoteVersion)
+		if err != nil {
+			// the time that the versions were first seen is used instead
+			log.Error(err, "failed to get the release dates")
+		}
+		released = cp.UpdateRemoteVersionsFirstSeen(ver.RemoteVersion, remoteversions, published, now)
+	}
 	subV, err := version.NewVersions("", remoteversions)
 	if err != nil {
 		return api.VersionInfos{}, err
@@ -35,6 +49,16 @@ func (cp *ControlPlane) GetSubjectVersionInfos(agentID string, ver *api.SubjectV
 		latest = subV.Latest().String()
 	}
 
+	var cycles []lifecycle.Cycle
+	lc := ver.RemoteVersion.Lifecycle
+	if lifecycle.Enabled(lc) {
+		cycles, err = cp.lifecycle.GetCycles(lc)
+		if err != nil {
+			// the support status and the advisories are optional, the versions are still useful without them
+			log.Error(err, "failed to get the release cycles")
+		}
+	}
+
 	verInfos := api.VersionInfos{
 		ID:             ver.ID,
 		AgentID:        agentID,
@@ -48,11 +72,16 @@ func (cp *ControlPlane) GetSubjectVersionInfos(agentID string, ver *api.SubjectV
 			log.Error(err, "failed to set running version")
 			return api.VersionInfos{}, err
 		}
-		verInfos.Versions = append(verInfos.Versions, api.VersionInfo{
+		daysBehind := daysBehindLatest(released, subV.GreaterThan().StringList(), now)
+		if daysBehind > verInfos.DaysBehindLatest {
+			verInfos.DaysBehindLatest = daysBehind
+		}
+		verInfo := api.VersionInfo{
 			RunningVersion:    subV.GetRunningVersion().String(),
 			ResourceCount:     v.ResourceCount,
 			ResourceKind:      v.ResourceKind,
 			ExtractedFrom:     v.ExtractedFrom,
+			ContainerName:     v.ContainerName,
 			LatestVersion:     latest,
 			AvailableVersions: subV.GreaterThan().StringList(),
 			AvailableMajors:   subV.LastMajorsGreaterThan().StringList(),
@@ -61,7 +90,25 @@ func (cp *ControlPlane) GetSubjectVersionInfos(agentID string, ver *api.SubjectV
 			MajorAvailable:    subV.MajorAvailable(),
 			MinorAvailable:    subV.MinorAvailable(),
 			PatchAvailable:    subV.PatchAvailable(),
-		})
+			DaysBehindLatest:  daysBehind,
+		}
+		if cp.advisories != nil && ver.RemoteVersion.Advisory.Package != "" {
+			pkg := ver.RemoteVersion.Advisory
+			result, err := advisory.Lookup(cp.advisories, pkg.Ecosystem, pkg.Package, v.RunningVersion)
+			if err != nil {
+				log.Error(err, "failed to get the security advisories", "ecosystem", pkg.Ecosystem, "package", pkg.Package)
+			} else {
+				verInfo.Advisories = result.Advisories
+				verInfo.FixedIn = result.FixedIn
+			}
+		}
+		if cycles != nil {
+			support := lifecycle.GetSupport(cycles, v.RunningVersion, lc.NearingEOLDays, now)
+			verInfo.SupportStatus = support.Status
+			verInfo.EOLDate = support.EOLDate
+			verInfo.EOLDays = support.EOLDays
+		}
+		verInfos.Versions = append(verInfos.Versions, verInfo)
 		if !utils.Contains(verInfos.RunningVersions, v.RunningVersion) {
 			verInfos.RunningVersions = append(verInfos.RunningVersions, v.RunningVersion)
 		}
@@ -3,11 +3,13 @@ module github.com/skillz/opvic
 go 1.16
 
 require (
+	github.com/alicebob/miniredis/v2 v2.30.4
 	github.com/bradleyfalzon/ghinstallation v1.1.1
 	github.com/gin-gonic/gin v1.7.7
 	github.com/go-logr/logr v0.4.0
+	github.com/gomodule/redigo v1.8.9
 	github.com/google/go-github/v39 v39.2.0
-	github.com/google/uuid v1.2.0 // indirect
+	github.com/google/uuid v1.2.0
 	github.com/hashicorp/go-version v1.3.0
 	github.com/jasonlvhit/gocron v0.0.1
 	github.com/mattn/go-isatty v0.0.14 // indirect
@@ -16,6 +18,7 @@ require (
 	github.com/patrickmn/go-cache v2.1.0+incompatible
 	github.com/prometheus/client_golang v1.11.0
 	github.com/spf13/cobra v1.2.1 // indirect
+	go.etcd.io/bbolt v1.3.6
 	go.uber.org/zap v1.19.1
 	golang.org/x/net v0.0.0-20210913180222-943fd674d43e // indirect
 	golang.org/x/oauth2 v0.0.0-20210402161424-2e8d93401602
@@ -23,6 +26,7 @@ require (
 	golang.org/x/text v0.3.7 // indirect
 	gopkg.in/alecthomas/kingpin.v2 v2.2.6
 	gopkg.in/check.v1 v1.0.0-20201130134442-10cb98267c6c // indirect
+	gopkg.in/square/go-jose.v2 v2.6.0
 	gopkg.in/yaml.v2 v2.4.0
 	k8s.io/api v0.22.3
 	k8s.io/apiextensions-apiserver v0.22.1 // indirect
@@ -30,4 +34,5 @@ require (
 	k8s.io/client-go v0.22.3
 	k8s.io/kubectl v0.22.3
 	sigs.k8s.io/controller-runtime v0.9.3
+	sigs.k8s.io/yaml v1.2.0
 )
@@ -0,0 +1,285 @@
+package oci
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// registry that is used when the repo does not specify a host (e.g. nginx or bitnami/redis)
+	DockerHubRegistry = "registry-1.docker.io"
+	// maximum number of tags to request per page
+	tagsPageSize = 100
+)
+
+// Reference points to an image repository in an OCI registry
+type Reference struct {
+	// http or https
+	Scheme string
+	// Registry host (e.g. ghcr.io or localhost:5000)
+	Host string
+	// Repository name (e.g. skillz/opvic)
+	Name string
+}
+
+// Client is a minimal OCI Distribution API client that supports the bearer token challenge auth
+type Client struct {
+	client   *http.Client
+	username string
+	password string
+	mutex    sync.RWMutex
+	// bearer tokens by host and scope
+	tokens map[string]string
+}
+
+type tagList struct {
+	Name string   `json:"name"`
+	Tags []string `json:"tags"`
+}
+
+type tokenResponse struct {
+	Token       string `json:"token"`
+	AccessToken string `json:"access_token"`
+}
+
+func NewClient(username, password string) *Client {
+	return &Client{
+		client:   &http.Client{Timeout: 30 * time.Second},
+		username: username,
+		password: password,
+		tokens:   map[string]string{},
+	}
+}
+
+// ParseReference parses the repo in the format of [scheme://][host/]name.
+// Docker Hub is used when the host is omitted and official images get the library/ prefix.
+func ParseReference(repo string) (Reference, error) {
+	ref := Reference{Scheme: "https"}
+	if parts := strings.SplitN(repo, "://", 2); len(parts) == 2 {
+		ref.Scheme = parts[0]
+		repo = parts[1]
+	}
+	repo = strings.Trim(repo, "/")
+	if repo == "" {
+		return ref, fmt.Errorf("invalid repo: repository name is empty")
+	}
+	parts := strings.SplitN(repo, "/", 2)
+	// the first part is a registry host if it looks like a hostname
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		ref.Host = parts[0]
+		ref.Name = parts[1]
+	} else {
+		ref.Host = DockerHubRegistry
+		ref.Name = repo
+	}
+	if ref.Host == "docker.io" || ref.Host == "index.docker.io" {
+		ref.Host = DockerHubRegistry
+	}
+	if ref.Host == DockerHubRegistry && !strings.Contains(ref.Name, "/") {
+		ref.Name = fmt.Sprintf("library/%s", ref.Name)
+	}
+	return ref, nil
+}
+
+func (r Reference) String() string {
+	return fmt.Sprintf("%s/%s", r.Host, r.Name)
+}
+
+// URL returns the API url of the registry for the given path
+func (r Reference) URL(path string) string {
+	return fmt.Sprintf("%s://%s/v2/%s/%s", r.Scheme, r.Host, r.Name, strings.TrimPrefix(path, "/"))
+}
+
+// ListTags returns all the tags of the repository by following the pagination links
+func (c *Client) ListTags(ref Reference) ([]string, error) {
+	var tags []string
+	next := fmt.Sprintf("%s?n=%d", ref.URL("tags/list"), tagsPageSize)
+	for next != "" {
+		req, err := http.NewRequest(http.MethodGet, next, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "application/json")
+		resp, err := c.Do(ref, req)
+		if err != nil {
+			return nil, err
+		}
+		var page tagList
+		err = decodeResponse(resp, &page)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list tags of %s: %v", ref, err)
+		}
+		tags = append(tags, page.Tags...)
+		next, err = nextPage(resp)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return tags, nil
+}
+
+// Do sends the request to the registry. If the registry responds with an authentication challenge
+// it will get a token from the authorization service and retry the request.
+func (c *Client) Do(ref Reference, req *http.Request) (*http.Response, error) {
+	scope := fmt.Sprintf("repository:%s:pull", ref.Name)
+	if token, ok := c.getToken(ref.Host, scope); ok {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		return resp, nil
+	}
+	challenge := resp.Header.Get("WWW-Authenticate")
+	drainAndClose(resp.Body)
+
+	scheme, params := parseChallenge(challenge)
+	retry := req.Clone(req.Context())
+	switch strings.ToLower(scheme) {
+	case "bearer":
+		if params["scope"] == "" {
+			params["scope"] = scope
+		}
+		token, err := c.fetchToken(params)
+		if err != nil {
+			return nil, fmt.Errorf("authentication failed: %v", err)
+		}
+		c.setToken(ref.Host, scope, token)
+		retry.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	case "basic":
+		if c.username == "" {
+			return nil, fmt.Errorf("authentication failed: registry %s requires credentials", ref.Host)
+		}
+		retry.SetBasicAuth(c.username, c.password)
+	default:
+		return nil, fmt.Errorf("authentication failed: unsupported challenge %q", challenge)
+	}
+	return c.client.Do(retry)
+}
+
+func (c *Client) fetchToken(params map[string]string) (string, error) {
+	realm := params["realm"]
+	if realm == "" {
+		return "", fmt.Errorf("missing realm in the authentication challenge")
+	}
+	u, err := url.Parse(realm)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	if params["service"] != "" {
+		q.Set("service", params["service"])
+	}
+	q.Set("scope", params["scope"])
+	u.RawQuery = q.Encode()
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	var t tokenResponse
+	if err := decodeResponse(resp, &t); err != nil {
+		return "", err
+	}
+	if t.Token != "" {
+		return t.Token, nil
+	}
+	if t.AccessToken != "" {
+		return t.AccessToken, nil
+	}
+	return "", fmt.Errorf("no token returned from %s", realm)
+}
+
+func (c *Client) getToken(host, scope string) (string, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	token, ok := c.tokens[host+"/"+scope]
+	return token, ok
+}
+
+func (c *Client) setToken(host, scope, token string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.tokens[host+"/"+scope] = token
+}
+
+// parseChallenge parses a WWW-Authenticate header such as:
+// Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:library/nginx:pull"
+func parseChallenge(header string) (string, map[string]string) {
+	params := map[string]string{}
+	parts := strings.SplitN(strings.TrimSpace(header), " ", 2)
+	if len(parts) < 2 {
+		return parts[0], params
+	}
+	rest := parts[1]
+	for rest != "" {
+		eq := strings.Index(rest, "=")
+		if eq < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(rest[:eq]))
+		rest = strings.TrimSpace(rest[eq+1:])
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else if comma := strings.Index(rest, ","); comma >= 0 {
+			value, rest = rest[:comma], rest[comma:]
+		} else {
+			value, rest = rest, ""
+		}
+		params[key] = value
+		rest = strings.TrimLeft(rest, ", ")
+	}
+	return parts[0], params
+}
+
+// nextPage returns the absolute url of the next page from the Link header if there is one
+func nextPage(resp *http.Response) (string, error) {
+	link := resp.Header.Get("Link")
+	if link == "" || !strings.Contains(link, `rel="next"`) {
+		return "", nil
+	}
+	start := strings.Index(link, "<")
+	end := strings.Index(link, ">")
+	if start < 0 || end < start {
+		return "", fmt.Errorf("invalid Link header: %s", link)
+	}
+	next, err := url.Parse(link[start+1 : end])
+	if err != nil {
+		return "", err
+	}
+	return resp.Request.URL.ResolveReference(next).String(), nil
+}
+
+func decodeResponse(resp *http.Response, v interface{}) error {
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code: %d status: %s", resp.StatusCode, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func drainAndClose(body io.ReadCloser) {
+	io.Copy(ioutil.Discard, body) // nolint: errcheck
+	body.Close()
+}
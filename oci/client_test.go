@@ -0,0 +1,122 @@
+package oci
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+const testToken = "test-token"
+
+// newTestRegistry starts a registry stand-in that requires a bearer token
+// and returns the tags of the repository in pages of the requested size
+func newTestRegistry(t *testing.T, name string, tags []string) *httptest.Server {
+	mux := http.NewServeMux()
+	var server *httptest.Server
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("scope") != fmt.Sprintf("repository:%s:pull", name) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		json.NewEncoder(w).Encode(tokenResponse{Token: testToken}) // nolint: errcheck
+	})
+	mux.HandleFunc(fmt.Sprintf("/v2/%s/tags/list", name), func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+testToken {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test",scope="repository:%s:pull"`, server.URL, name))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		n, err := strconv.Atoi(r.URL.Query().Get("n"))
+		if err != nil || n <= 0 {
+			n = len(tags)
+		}
+		start := 0
+		if last := r.URL.Query().Get("last"); last != "" {
+			for i, tag := range tags {
+				if tag == last {
+					start = i + 1
+				}
+			}
+		}
+		end := start + n
+		if end >= len(tags) {
+			end = len(tags)
+		} else {
+			w.Header().Set("Link", fmt.Sprintf(`</v2/%s/tags/list?last=%s&n=%d>; rel="next"`, name, tags[end-1], n))
+		}
+		json.NewEncoder(w).Encode(tagList{Name: name, Tags: tags[start:end]}) // nolint: errcheck
+	})
+	server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestParseReference(t *testing.T) {
+	tests := []struct {
+		name    string
+		repo    string
+		want    Reference
+		wantErr bool
+	}{
+		{
+			name: "official_image",
+			repo: "nginx",
+			want: Reference{Scheme: "https", Host: DockerHubRegistry, Name: "library/nginx"},
+		},
+		{
+			name: "docker_hub_image",
+			repo: "docker.io/bitnami/redis",
+			want: Reference{Scheme: "https", Host: DockerHubRegistry, Name: "bitnami/redis"},
+		},
+		{
+			name: "registry_image",
+			repo: "ghcr.io/skillz/opvic",
+			want: Reference{Scheme: "https", Host: "ghcr.io", Name: "skillz/opvic"},
+		},
+		{
+			name: "insecure_registry_with_port",
+			repo: "http://localhost:5000/opvic",
+			want: Reference{Scheme: "http", Host: "localhost:5000", Name: "opvic"},
+		},
+		{
+			name:    "empty_repo",
+			repo:    "",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseReference(tt.repo)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseReference() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("ParseReference() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientListTags(t *testing.T) {
+	var tags []string
+	for i := 0; i < 250; i++ {
+		tags = append(tags, fmt.Sprintf("1.0.%d", i))
+	}
+	server := newTestRegistry(t, "skillz/opvic", tags)
+	ref, err := ParseReference(fmt.Sprintf("%s/skillz/opvic", server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := NewClient("", "").ListTags(ref)
+	if err != nil {
+		t.Fatalf("ListTags() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, tags) {
+		t.Errorf("ListTags() returned %d tags, want %d", len(got), len(tags))
+	}
+}
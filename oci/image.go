@@ -0,0 +1,128 @@
+package oci
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	// Label of the OCI image spec with the version of the packaged software
+	VersionLabel = "org.opencontainers.image.version"
+
+	mediaTypeOCIIndex         = "application/vnd.oci.image.index.v1+json"
+	mediaTypeOCIManifest      = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeDockerList       = "application/vnd.docker.distribution.manifest.list.v2+json"
+	mediaTypeDockerManifest   = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaTypeDockerManifestV1 = "application/vnd.docker.distribution.manifest.v1+prettyjws"
+	unknownPlatform           = "unknown"
+	manifestMediaTypes        = mediaTypeOCIIndex + "," + mediaTypeOCIManifest + "," + mediaTypeDockerList + "," + mediaTypeDockerManifest
+)
+
+// manifest is either an image manifest or an index of the image manifests of each platform
+type manifest struct {
+	MediaType string     `json:"mediaType"`
+	Config    descriptor `json:"config"`
+	Manifests []struct {
+		descriptor
+		Platform *struct {
+			OS           string `json:"os"`
+			Architecture string `json:"architecture"`
+		} `json:"platform,omitempty"`
+	} `json:"manifests"`
+}
+
+// Platform is the operating system and the architecture of the node running an image
+type Platform struct {
+	OS           string
+	Architecture string
+}
+
+func (p Platform) String() string {
+	return p.OS + "/" + p.Architecture
+}
+
+type descriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+}
+
+type imageConfig struct {
+	Config struct {
+		Labels map[string]string `json:"Labels"`
+	} `json:"config"`
+}
+
+// ImageLabels returns the labels of the config of the image with the digest.
+// If the digest is an index, the labels of the image of the platform are returned
+func (c *Client) ImageLabels(ref Reference, digest string, platform Platform) (map[string]string, error) {
+	m, err := c.getManifest(ref, digest)
+	if err != nil {
+		return nil, err
+	}
+	if len(m.Manifests) > 0 {
+		digest = selectPlatform(m, platform)
+		if m, err = c.getManifest(ref, digest); err != nil {
+			return nil, err
+		}
+	}
+	if m.Config.Digest == "" {
+		return nil, fmt.Errorf("manifest %s@%s has no config", ref, digest)
+	}
+	req, err := http.NewRequest(http.MethodGet, ref.URL("blobs/"+m.Config.Digest), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.Do(ref, req)
+	if err != nil {
+		return nil, err
+	}
+	var config imageConfig
+	if err := decodeResponse(resp, &config); err != nil {
+		return nil, fmt.Errorf("failed to get the config of %s@%s: %v", ref, digest, err)
+	}
+	return config.Config.Labels, nil
+}
+
+func (c *Client) getManifest(ref Reference, digest string) (*manifest, error) {
+	req, err := http.NewRequest(http.MethodGet, ref.URL("manifests/"+digest), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", manifestMediaTypes)
+	resp, err := c.Do(ref, req)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), mediaTypeDockerManifestV1) {
+		drainAndClose(resp.Body)
+		return nil, fmt.Errorf("manifest %s@%s uses the unsupported schema 1", ref, digest)
+	}
+	var m manifest
+	if err := decodeResponse(resp, &m); err != nil {
+		return nil, fmt.Errorf("failed to get the manifest %s@%s: %v", ref, digest, err)
+	}
+	return &m, nil
+}
+
+// selectPlatform returns the digest of the image of the platform in the index.
+// The labels are usually the same for all the platforms, so the first image is used otherwise
+func selectPlatform(index *manifest, platform Platform) string {
+	first := ""
+	for _, m := range index.Manifests {
+		// attestation manifests have an unknown platform
+		if m.Platform != nil && m.Platform.OS == unknownPlatform {
+			continue
+		}
+		if m.Platform != nil && m.Platform.OS == platform.OS && m.Platform.Architecture == platform.Architecture {
+			return m.Digest
+		}
+		if first == "" {
+			first = m.Digest
+		}
+	}
+	if first == "" {
+		return index.Manifests[0].Digest
+	}
+	return first
+}
@@ -0,0 +1,70 @@
+package oci
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientImageLabels(t *testing.T) {
+	const name = "skillz/opvic"
+	index := fmt.Sprintf(`{"mediaType": %q, "manifests": [
+		{"digest": "sha256:attestation", "platform": {"os": "unknown", "architecture": "unknown"}},
+		{"digest": "sha256:image", "platform": {"os": "linux", "architecture": "amd64"}},
+		{"digest": "sha256:arm64", "platform": {"os": "linux", "architecture": "arm64"}}
+	]}`, mediaTypeOCIIndex)
+	manifests := map[string]string{
+		"sha256:index": index,
+		"sha256:image": fmt.Sprintf(`{"mediaType": %q, "config": {"digest": "sha256:config"}}`, mediaTypeOCIManifest),
+		"sha256:arm64": fmt.Sprintf(`{"mediaType": %q, "config": {"digest": "sha256:arm64-config"}}`, mediaTypeOCIManifest),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(fmt.Sprintf("/v2/%s/manifests/", name), func(w http.ResponseWriter, r *http.Request) {
+		m, found := manifests[r.URL.Path[len(fmt.Sprintf("/v2/%s/manifests/", name)):]]
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(m)) // nolint: errcheck
+	})
+	mux.HandleFunc(fmt.Sprintf("/v2/%s/blobs/sha256:config", name), func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"config": {"Labels": {"org.opencontainers.image.version": "1.2.3"}}}`)) // nolint: errcheck
+	})
+	mux.HandleFunc(fmt.Sprintf("/v2/%s/blobs/sha256:arm64-config", name), func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"config": {"Labels": {"org.opencontainers.image.version": "1.2.3-arm64"}}}`)) // nolint: errcheck
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	ref, err := ParseReference(fmt.Sprintf("%s/%s", server.URL, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	amd64 := Platform{OS: "linux", Architecture: "amd64"}
+	tests := []struct {
+		name     string
+		digest   string
+		platform Platform
+		want     string
+		wantErr  bool
+	}{
+		{name: "index", digest: "sha256:index", platform: amd64, want: "1.2.3"},
+		{name: "index_node_platform", digest: "sha256:index", platform: Platform{OS: "linux", Architecture: "arm64"}, want: "1.2.3-arm64"},
+		{name: "index_unknown_platform", digest: "sha256:index", platform: Platform{OS: "windows", Architecture: "amd64"}, want: "1.2.3"},
+		{name: "manifest", digest: "sha256:image", platform: amd64, want: "1.2.3"},
+		{name: "unknown_digest", digest: "sha256:unknown", platform: amd64, wantErr: true},
+	}
+	client := NewClient("", "")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			labels, err := client.ImageLabels(ref, tt.digest, tt.platform)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ImageLabels() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && labels[VersionLabel] != tt.want {
+				t.Errorf("ImageLabels() = %v, want the %s version label", labels, tt.want)
+			}
+		})
+	}
+}